@@ -21,4 +21,26 @@ type UDPConn interface {
 
 	// ID returns the transport endpoint id of UDPConn.
 	ID() *stack.TransportEndpointID
+
+	// WriteFrom writes a packet to the remote address of UDPConn
+	// as if it were sent from the given address rather than the
+	// local one, which allows replies from any remote address.
+	WriteFrom([]byte, net.Addr) (int, error)
+}
+
+// ICMPEcho is an ICMP echo request, which is replied by Reply.
+type ICMPEcho interface {
+	// ID returns the transport endpoint id of ICMPEcho, where
+	// the echo identifier is stored as the remote port.
+	ID() *stack.TransportEndpointID
+
+	// Seq returns the sequence number of ICMPEcho.
+	Seq() uint16
+
+	// Payload returns the data of ICMPEcho.
+	Payload() []byte
+
+	// Reply writes an echo reply carrying the given data back to
+	// the source of ICMPEcho.
+	Reply([]byte) error
 }
@@ -1,8 +1,9 @@
 package adapter
 
-// TransportHandler is a TCP/UDP connection handler that implements
-// HandleTCP and HandleUDP methods.
+// TransportHandler is a TCP/UDP connection and ICMP echo handler
+// that implements HandleTCP, HandleUDP and HandleICMP methods.
 type TransportHandler interface {
 	HandleTCP(TCPConn)
 	HandleUDP(UDPConn)
+	HandleICMP(ICMPEcho)
 }
@@ -0,0 +1,184 @@
+package core
+
+import (
+	"errors"
+
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/nested"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+
+	"github.com/xjasonlyu/tun2socks/v2/core/adapter"
+)
+
+// icmpEndpoint intercepts ICMP echo requests before they are
+// delivered to stack, which would reply them locally otherwise.
+type icmpEndpoint struct {
+	nested.Endpoint
+
+	stack  *stack.Stack
+	handle func(adapter.ICMPEcho)
+}
+
+func newICMPEndpoint(s *stack.Stack, ep stack.LinkEndpoint, handle func(adapter.ICMPEcho)) *icmpEndpoint {
+	e := &icmpEndpoint{
+		stack:  s,
+		handle: handle,
+	}
+	e.Endpoint.Init(ep, e)
+	return e
+}
+
+// DeliverNetworkPacket implements stack.NetworkDispatcher.
+func (e *icmpEndpoint) DeliverNetworkPacket(protocol tcpip.NetworkProtocolNumber, pkt stack.PacketBufferPtr) {
+	if echo := e.parseEcho(protocol, pkt); echo != nil {
+		e.handle(echo)
+		return
+	}
+	e.Endpoint.DeliverNetworkPacket(protocol, pkt)
+}
+
+// parseEcho returns the echo request carried by pkt, or nil if pkt
+// is not a well-formed unicast echo request.
+func (e *icmpEndpoint) parseEcho(protocol tcpip.NetworkProtocolNumber, pkt stack.PacketBufferPtr) *icmpEcho {
+	switch protocol {
+	case header.IPv4ProtocolNumber:
+		hdr, ok := pkt.Data().PullUp(header.IPv4MinimumSize)
+		if !ok || header.IPv4(hdr).TransportProtocol() != header.ICMPv4ProtocolNumber {
+			return nil
+		}
+
+		ip := header.IPv4(pkt.Data().AsRange().ToSlice())
+		if !ip.IsValid(len(ip)) || ip.More() || ip.FragmentOffset() != 0 ||
+			header.IsV4MulticastAddress(ip.DestinationAddress()) ||
+			ip.DestinationAddress() == header.IPv4Broadcast {
+			return nil
+		}
+
+		h := header.ICMPv4(ip.Payload())
+		if len(h) < header.ICMPv4MinimumSize || h.Type() != header.ICMPv4Echo || h.Code() != 0 ||
+			checksum.Checksum(h, 0) != 0xffff {
+			return nil
+		}
+		return &icmpEcho{
+			stack:    e.stack,
+			netProto: protocol,
+			id: stack.TransportEndpointID{
+				LocalAddress:  ip.DestinationAddress(),
+				RemotePort:    h.Ident(),
+				RemoteAddress: ip.SourceAddress(),
+			},
+			seq:     h.Sequence(),
+			payload: h.Payload(),
+		}
+	case header.IPv6ProtocolNumber:
+		hdr, ok := pkt.Data().PullUp(header.IPv6MinimumSize)
+		if !ok || header.IPv6(hdr).TransportProtocol() != header.ICMPv6ProtocolNumber {
+			return nil
+		}
+
+		ip := header.IPv6(pkt.Data().AsRange().ToSlice())
+		if !ip.IsValid(len(ip)) || header.IsV6MulticastAddress(ip.DestinationAddress()) {
+			return nil
+		}
+
+		h := header.ICMPv6(ip.Payload())
+		if len(h) < header.ICMPv6EchoMinimumSize || h.Type() != header.ICMPv6EchoRequest || h.Code() != 0 ||
+			header.ICMPv6Checksum(header.ICMPv6ChecksumParams{
+				Header:      h[:header.ICMPv6EchoMinimumSize],
+				Src:         ip.SourceAddress(),
+				Dst:         ip.DestinationAddress(),
+				PayloadCsum: checksum.Checksum(h.Payload(), 0),
+				PayloadLen:  len(h.Payload()),
+			}) != h.Checksum() {
+			return nil
+		}
+		return &icmpEcho{
+			stack:    e.stack,
+			netProto: protocol,
+			id: stack.TransportEndpointID{
+				LocalAddress:  ip.DestinationAddress(),
+				RemotePort:    h.Ident(),
+				RemoteAddress: ip.SourceAddress(),
+			},
+			seq:     h.Sequence(),
+			payload: h.Payload(),
+		}
+	default:
+		return nil
+	}
+}
+
+type icmpEcho struct {
+	stack    *stack.Stack
+	netProto tcpip.NetworkProtocolNumber
+	id       stack.TransportEndpointID
+	seq      uint16
+	payload  []byte
+}
+
+func (e *icmpEcho) ID() *stack.TransportEndpointID {
+	return &e.id
+}
+
+func (e *icmpEcho) Seq() uint16 {
+	return e.seq
+}
+
+func (e *icmpEcho) Payload() []byte {
+	return e.payload
+}
+
+// Reply writes the echo reply from the destination of echo request,
+// which requires the spoofing to be enabled on the NIC.
+func (e *icmpEcho) Reply(data []byte) error {
+	route, err := e.stack.FindRoute(0, e.id.LocalAddress, e.id.RemoteAddress, e.netProto, false /* multicastLoop */)
+	if err != nil {
+		return errors.New(err.String())
+	}
+	defer route.Release()
+
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: header.ICMPv4MinimumSize + int(route.MaxHeaderLength()),
+		Payload:            buffer.MakeWithData(data),
+	})
+	defer pkt.DecRef()
+
+	var transProto tcpip.TransportProtocolNumber
+	switch e.netProto {
+	case header.IPv4ProtocolNumber:
+		h := header.ICMPv4(pkt.TransportHeader().Push(header.ICMPv4MinimumSize))
+		h.SetType(header.ICMPv4EchoReply)
+		h.SetCode(0)
+		h.SetIdent(e.id.RemotePort)
+		h.SetSequence(e.seq)
+		h.SetChecksum(0)
+		h.SetChecksum(^checksum.Combine(checksum.Checksum(h, 0), pkt.Data().Checksum()))
+		transProto = header.ICMPv4ProtocolNumber
+	case header.IPv6ProtocolNumber:
+		h := header.ICMPv6(pkt.TransportHeader().Push(header.ICMPv6EchoMinimumSize))
+		h.SetType(header.ICMPv6EchoReply)
+		h.SetCode(0)
+		h.SetIdent(e.id.RemotePort)
+		h.SetSequence(e.seq)
+		h.SetChecksum(header.ICMPv6Checksum(header.ICMPv6ChecksumParams{
+			Header:      h,
+			Src:         e.id.LocalAddress,
+			Dst:         e.id.RemoteAddress,
+			PayloadCsum: pkt.Data().Checksum(),
+			PayloadLen:  pkt.Data().Size(),
+		}))
+		transProto = header.ICMPv6ProtocolNumber
+	}
+	pkt.TransportProtocolNumber = transProto
+
+	if err = route.WritePacket(stack.NetworkHeaderParams{
+		Protocol: transProto,
+		TTL:      route.DefaultTTL(),
+	}, pkt); err != nil {
+		return errors.New(err.String())
+	}
+	return nil
+}
@@ -65,8 +65,9 @@ func CreateStack(cfg *Config) (*stack.Stack, error) {
 		withTCPHandler(cfg.TransportHandler.HandleTCP),
 		withUDPHandler(cfg.TransportHandler.HandleUDP),
 
-		// Create stack NIC and then bind link endpoint to it.
-		withCreatingNIC(nicID, cfg.LinkEndpoint),
+		// Create stack NIC and then bind link endpoint to it, the
+		// ICMP echo requests are intercepted and passed to handler.
+		withCreatingNIC(nicID, newICMPEndpoint(s, cfg.LinkEndpoint, cfg.TransportHandler.HandleICMP)),
 
 		// In the past we did s.AddAddressRange to assign 0.0.0.0/0
 		// onto the interface. We need that to be able to terminate
@@ -1,8 +1,16 @@
 package core
 
 import (
+	"errors"
+	"math"
+	"net"
+
+	"gvisor.dev/gvisor/pkg/buffer"
 	glog "gvisor.dev/gvisor/pkg/log"
+	"gvisor.dev/gvisor/pkg/tcpip"
 	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/checksum"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
 	"gvisor.dev/gvisor/pkg/tcpip/stack"
 	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
 	"gvisor.dev/gvisor/pkg/waiter"
@@ -27,6 +35,7 @@ func withUDPHandler(handle func(adapter.UDPConn)) option.Option {
 
 			conn := &udpConn{
 				UDPConn: gonet.NewUDPConn(s, &wq, ep),
+				stack:   s,
 				id:      id,
 			}
 			handle(conn)
@@ -38,9 +47,76 @@ func withUDPHandler(handle func(adapter.UDPConn)) option.Option {
 
 type udpConn struct {
 	*gonet.UDPConn
-	id stack.TransportEndpointID
+	stack *stack.Stack
+	id    stack.TransportEndpointID
 }
 
 func (c *udpConn) ID() *stack.TransportEndpointID {
 	return &c.id
 }
+
+// WriteFrom builds the UDP packet with the given source address and
+// writes it through the route to the remote address, which requires
+// the spoofing to be enabled on the NIC.
+func (c *udpConn) WriteFrom(b []byte, from net.Addr) (int, error) {
+	addr, ok := from.(*net.UDPAddr)
+	if !ok || addr.Port == 0 {
+		return 0, errors.New("invalid source address")
+	}
+
+	var (
+		src      tcpip.Address
+		netProto tcpip.NetworkProtocolNumber
+	)
+	if c.id.RemoteAddress.Len() == net.IPv4len {
+		ip := addr.IP.To4()
+		if ip == nil {
+			return 0, errors.New("source address family mismatch")
+		}
+		src, netProto = tcpip.AddrFromSlice(ip), header.IPv4ProtocolNumber
+	} else {
+		src, netProto = tcpip.AddrFromSlice(addr.IP.To16()), header.IPv6ProtocolNumber
+	}
+
+	route, err := c.stack.FindRoute(0, src, c.id.RemoteAddress, netProto, false /* multicastLoop */)
+	if err != nil {
+		return 0, errors.New(err.String())
+	}
+	defer route.Release()
+
+	pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+		ReserveHeaderBytes: header.UDPMinimumSize + int(route.MaxHeaderLength()),
+		Payload:            buffer.MakeWithData(b),
+	})
+	defer pkt.DecRef()
+
+	h := header.UDP(pkt.TransportHeader().Push(header.UDPMinimumSize))
+	pkt.TransportProtocolNumber = udp.ProtocolNumber
+
+	length := uint16(pkt.Size())
+	h.Encode(&header.UDPFields{
+		SrcPort: uint16(addr.Port),
+		DstPort: c.id.RemotePort,
+		Length:  length,
+	})
+
+	if route.RequiresTXTransportChecksum() {
+		xsum := h.CalculateChecksum(checksum.Combine(
+			route.PseudoHeaderChecksum(udp.ProtocolNumber, length),
+			pkt.Data().Checksum(),
+		))
+		// A zero checksum means no checksum, see RFC 768.
+		if xsum != math.MaxUint16 {
+			xsum = ^xsum
+		}
+		h.SetChecksum(xsum)
+	}
+
+	if err = route.WritePacket(stack.NetworkHeaderParams{
+		Protocol: udp.ProtocolNumber,
+		TTL:      route.DefaultTTL(),
+	}, pkt); err != nil {
+		return 0, errors.New(err.String())
+	}
+	return len(b), nil
+}
@@ -3,6 +3,7 @@ package dialer
 import (
 	"context"
 	"net"
+	"strconv"
 	"syscall"
 
 	"go.uber.org/atomic"
@@ -39,7 +40,40 @@ func DialContext(ctx context.Context, network, address string) (net.Conn, error)
 	})
 }
 
+// DialContextWithOptions resolves the host of address with the default
+// Resolver and preference, and races the TCP connections to the resolved
+// addresses as Happy Eyeballs (RFC 8305). UDP uses the most preferred one.
 func DialContextWithOptions(ctx context.Context, network, address string, opts *Options) (net.Conn, error) {
+	dial := func(ctx context.Context, address string) (net.Conn, error) {
+		return dialSingle(ctx, network, address, opts)
+	}
+
+	switch network {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+	default:
+		return dial(ctx, address)
+	}
+
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return dial(ctx, address)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return dial(ctx, address)
+	}
+
+	addrs, err := lookupAddrs(ctx, network, host, uint16(port))
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+	}
+	if network[:3] == "udp" {
+		return dial(ctx, addrs[0].String())
+	}
+	return dialParallel(ctx, network, host, addrs, dial)
+}
+
+func dialSingle(ctx context.Context, network, address string, opts *Options) (net.Conn, error) {
 	d := &net.Dialer{
 		Control: func(network, address string, c syscall.RawConn) error {
 			return setSocketOptions(network, address, c, opts)
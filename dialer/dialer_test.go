@@ -0,0 +1,118 @@
+package dialer
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticResolver map[string][]netip.Addr
+
+func (r staticResolver) LookupNetIP(_ context.Context, network, host string) ([]netip.Addr, error) {
+	var addrs []netip.Addr
+	for _, addr := range r[host] {
+		if addr.Is4() == (network == "ip4") {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs, nil
+}
+
+func TestSortAddrs(t *testing.T) {
+	addrs := []netip.Addr{
+		netip.MustParseAddr("192.0.2.1"),
+		netip.MustParseAddr("192.0.2.2"),
+		netip.MustParseAddr("2001:db8::1"),
+		netip.MustParseAddr("2001:db8::2"),
+	}
+	assert.Equal(t, []netip.AddrPort{
+		netip.MustParseAddrPort("[2001:db8::1]:80"),
+		netip.MustParseAddrPort("192.0.2.1:80"),
+		netip.MustParseAddrPort("[2001:db8::2]:80"),
+		netip.MustParseAddrPort("192.0.2.2:80"),
+	}, sortAddrs("sort.test", addrs, 80, PreferDual))
+	assert.Equal(t, []netip.AddrPort{
+		netip.MustParseAddrPort("192.0.2.1:80"),
+		netip.MustParseAddrPort("[2001:db8::1]:80"),
+		netip.MustParseAddrPort("192.0.2.2:80"),
+		netip.MustParseAddrPort("[2001:db8::2]:80"),
+	}, sortAddrs("sort.test", addrs, 80, PreferIPv4))
+
+	SetPreference(IPv4Only)
+	defer SetPreference(PreferDual)
+	SetResolver(staticResolver{"sort.test": addrs})
+	defer SetResolver(net.DefaultResolver)
+
+	resolved, err := lookupAddrs(context.Background(), "tcp", "sort.test", 80)
+	require.NoError(t, err)
+	assert.Equal(t, []netip.AddrPort{
+		netip.MustParseAddrPort("192.0.2.1:80"),
+		netip.MustParseAddrPort("192.0.2.2:80"),
+	}, resolved)
+
+	_, err = lookupAddrs(context.Background(), "tcp6", "sort.test", 80)
+	assert.Error(t, err)
+
+	ip, err := LookupIP(context.Background(), "ip4", "sort.test")
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.1", ip.String())
+}
+
+func TestDialFailover(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.2:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	// 127.0.0.1 is refused, and tried last after the failure.
+	SetResolver(staticResolver{"dial.test": {
+		netip.MustParseAddr("127.0.0.1"),
+		netip.MustParseAddr("127.0.0.2"),
+	}})
+	defer SetResolver(net.DefaultResolver)
+
+	c, err := DialContext(context.Background(), "tcp", net.JoinHostPort("dial.test", strconv.Itoa(port)))
+	require.NoError(t, err)
+	c.Close()
+	assert.Equal(t, "127.0.0.2", c.RemoteAddr().(*net.TCPAddr).IP.String())
+
+	addrs, err := lookupAddrs(context.Background(), "tcp", "dial.test", uint16(port))
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.2", addrs[0].Addr().String())
+}
+
+func TestDialTimeout(t *testing.T) {
+	block := func(ctx context.Context, _ string) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := dialParallel(ctx, "tcp", "timeout.test", []netip.AddrPort{netip.MustParseAddrPort("192.0.2.1:80")}, block)
+
+	var opErr *net.OpError
+	require.ErrorAs(t, err, &opErr)
+	assert.Equal(t, "dial", opErr.Op)
+	assert.True(t, opErr.Timeout())
+}
+
+func TestAddrCacheLimit(t *testing.T) {
+	c := &addrCache{
+		failures: make(map[netip.AddrPort]time.Time),
+		last:     make(map[string]netip.AddrPort),
+	}
+	for i := 0; i < maxAddrCacheSize+10; i++ {
+		addr := netip.AddrPortFrom(netip.AddrFrom4([4]byte{192, 0, byte(i >> 8), byte(i)}), 80)
+		c.succeed(addr.Addr().String(), addr)
+		c.fail(addr)
+	}
+	assert.LessOrEqual(t, len(c.failures), maxAddrCacheSize)
+	assert.LessOrEqual(t, len(c.last), maxAddrCacheSize)
+}
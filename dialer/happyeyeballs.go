@@ -0,0 +1,86 @@
+package dialer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// connectionAttemptDelay is the delay between starting connection
+// attempts, if the previous one is neither failed nor succeeded.
+// RFC 8305 section 5
+const connectionAttemptDelay = 250 * time.Millisecond
+
+// dialParallel races the connection attempts to addrs in order, which
+// are started one by one after connectionAttemptDelay, or immediately
+// if the previous one failed. The first connection succeeded is used.
+func dialParallel(ctx context.Context, network, host string, addrs []netip.AddrPort, dial func(context.Context, string) (net.Conn, error)) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		addr netip.AddrPort
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result)
+	attempt := func(addr netip.AddrPort) {
+		c, err := dial(ctx, addr.String())
+		select {
+		case results <- result{addr: addr, conn: c, err: err}:
+		case <-ctx.Done():
+			if c != nil {
+				c.Close()
+			}
+		}
+	}
+
+	var (
+		errs    []error
+		next    int
+		pending int
+		timer   = time.NewTimer(0)
+	)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if next < len(addrs) {
+				pending++
+				go attempt(addrs[next])
+				next++
+				timer.Reset(connectionAttemptDelay)
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				_addrCache.succeed(host, r.addr)
+				return r.conn, nil
+			}
+			// Cancelled attempts are not the fault of the address.
+			if ctx.Err() == nil {
+				_addrCache.fail(r.addr)
+			}
+			errs = append(errs, r.err)
+
+			if next < len(addrs) {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(0)
+			} else if pending == 0 {
+				return nil, errors.Join(errs...)
+			}
+		case <-ctx.Done():
+			// Timeouts are dial errors as net.Dialer, which are
+			// distinguished from the errors after connected.
+			return nil, &net.OpError{Op: "dial", Net: network, Err: ctx.Err()}
+		}
+	}
+}
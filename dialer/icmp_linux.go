@@ -0,0 +1,66 @@
+package dialer
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// ListenICMP listens on an unprivileged ICMP socket for echo, the
+// network must be "ip4" or "ip6". It requires the group of process
+// to be allowed by sysctl net.ipv4.ping_group_range.
+func ListenICMP(network string) (net.PacketConn, error) {
+	return ListenICMPWithOptions(network, &Options{
+		InterfaceName:  DefaultInterfaceName.Load(),
+		InterfaceIndex: int(DefaultInterfaceIndex.Load()),
+		RoutingMark:    int(DefaultRoutingMark.Load()),
+	})
+}
+
+func ListenICMPWithOptions(network string, opts *Options) (net.PacketConn, error) {
+	var (
+		family, proto int
+		sa            unix.Sockaddr
+		udpNetwork    string
+	)
+	switch network {
+	case "ip4":
+		family, proto, sa, udpNetwork = unix.AF_INET, unix.IPPROTO_ICMP, &unix.SockaddrInet4{}, "udp4"
+	case "ip6":
+		family, proto, sa, udpNetwork = unix.AF_INET6, unix.IPPROTO_ICMPV6, &unix.SockaddrInet6{}, "udp6"
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", network)
+	}
+
+	fd, err := unix.Socket(family, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err = unix.Bind(fd, sa); err != nil {
+		unix.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close()
+
+	pc, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ICMP datagram socket is seen as an UDP socket by net
+	// package, so socket options are set as it is.
+	rc, err := pc.(syscall.Conn).SyscallConn()
+	if err == nil {
+		err = setSocketOptions(udpNetwork, "", rc, opts)
+	}
+	if err != nil {
+		pc.Close()
+		return nil, err
+	}
+	return pc, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package dialer
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+func ListenICMP(network string) (net.PacketConn, error) {
+	return ListenICMPWithOptions(network, nil)
+}
+
+func ListenICMPWithOptions(string, *Options) (net.PacketConn, error) {
+	return nil, fmt.Errorf("unprivileged icmp socket is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,324 @@
+package dialer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	// resolutionDelay is how long to wait for the addresses of preferred
+	// family, after the other family is resolved. RFC 8305 section 3
+	resolutionDelay = 50 * time.Millisecond
+
+	// failureCacheTTL is how long a failed address is tried last.
+	failureCacheTTL = 5 * time.Minute
+
+	// maxAddrCacheSize is the max number of entries kept in addrCache
+	// for failures and last addresses each.
+	maxAddrCacheSize = 1024
+)
+
+// Resolver resolves the host names of proxy servers, which is satisfied
+// by *net.Resolver.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+var (
+	_defaultResolver   atomic.Pointer[Resolver]
+	_defaultPreference = atomic.NewUint32(uint32(PreferDual))
+)
+
+func init() {
+	SetResolver(net.DefaultResolver)
+}
+
+// SetResolver sets the Resolver of host names.
+func SetResolver(r Resolver) {
+	_defaultResolver.Store(&r)
+}
+
+// NewResolver returns the Resolver querying the DNS server at address,
+// which is connected with the default options.
+func NewResolver(address string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return DialContext(ctx, network, address)
+		},
+	}
+}
+
+// Preference is the preference of address family.
+type Preference uint32
+
+const (
+	// PreferDual prefers IPv6 and falls back to IPv4, as RFC 8305.
+	PreferDual Preference = iota
+	PreferIPv4
+	PreferIPv6
+	IPv4Only
+	IPv6Only
+)
+
+func (p Preference) String() string {
+	switch p {
+	case PreferDual:
+		return "dual"
+	case PreferIPv4:
+		return "ipv4"
+	case PreferIPv6:
+		return "ipv6"
+	case IPv4Only:
+		return "ipv4-only"
+	case IPv6Only:
+		return "ipv6-only"
+	default:
+		return fmt.Sprintf("preference(%d)", uint32(p))
+	}
+}
+
+// ParsePreference parses the preference of address family.
+func ParsePreference(s string) (Preference, error) {
+	for _, p := range []Preference{PreferDual, PreferIPv4, PreferIPv6, IPv4Only, IPv6Only} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid ip preference: %s", s)
+}
+
+// SetPreference sets the preference of address family.
+func SetPreference(p Preference) {
+	_defaultPreference.Store(uint32(p))
+}
+
+// addrCache remembers the addresses failed recently, and the address
+// connected last for each host.
+type addrCache struct {
+	mu       sync.Mutex
+	failures map[netip.AddrPort]time.Time
+	last     map[string]netip.AddrPort
+}
+
+var _addrCache = &addrCache{
+	failures: make(map[netip.AddrPort]time.Time),
+	last:     make(map[string]netip.AddrPort),
+}
+
+func (c *addrCache) fail(addr netip.AddrPort) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := c.failures[addr]; !ok && len(c.failures) >= maxAddrCacheSize {
+		c.pruneLocked(now)
+	}
+	c.failures[addr] = now
+}
+
+// pruneLocked deletes the expired failures, and the oldest one if the
+// cache is still full, c.mu must be held.
+func (c *addrCache) pruneLocked(now time.Time) {
+	var (
+		oldest   netip.AddrPort
+		oldestAt time.Time
+	)
+	for addr, t := range c.failures {
+		if now.Sub(t) > failureCacheTTL {
+			delete(c.failures, addr)
+			continue
+		}
+		if oldestAt.IsZero() || t.Before(oldestAt) {
+			oldest, oldestAt = addr, t
+		}
+	}
+	if len(c.failures) >= maxAddrCacheSize {
+		delete(c.failures, oldest)
+	}
+}
+
+func (c *addrCache) succeed(host string, addr netip.AddrPort) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.failures, addr)
+
+	key := net.JoinHostPort(host, strconv.Itoa(int(addr.Port())))
+	if _, ok := c.last[key]; !ok && len(c.last) >= maxAddrCacheSize {
+		// The last address is an optimization only, any of them
+		// can be dropped.
+		for k := range c.last {
+			delete(c.last, k)
+			break
+		}
+	}
+	c.last[key] = addr
+}
+
+// failedAt returns when addr failed, zero if it's not failed recently.
+func (c *addrCache) failedAt(addr netip.AddrPort) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t, ok := c.failures[addr]
+	if ok && time.Since(t) > failureCacheTTL {
+		delete(c.failures, addr)
+		return time.Time{}
+	}
+	return t
+}
+
+func (c *addrCache) lastAddr(host string, port uint16) netip.AddrPort {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last[net.JoinHostPort(host, strconv.Itoa(int(port)))]
+}
+
+// lookupAddrs resolves host to the addresses allowed by network and the
+// preference, which are sorted to be connected in order.
+func lookupAddrs(ctx context.Context, network, host string, port uint16) ([]netip.AddrPort, error) {
+	pref := Preference(_defaultPreference.Load())
+
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return []netip.AddrPort{netip.AddrPortFrom(ip.Unmap(), port)}, nil
+	}
+
+	ip4 := pref != IPv6Only && network[len(network)-1] != '6'
+	ip6 := pref != IPv4Only && network[len(network)-1] != '4'
+	if !ip4 && !ip6 {
+		return nil, fmt.Errorf("no address family for %s with preference %s", network, pref)
+	}
+
+	type result struct {
+		ip6   bool
+		addrs []netip.Addr
+		err   error
+	}
+	results := make(chan result, 2)
+	lookup := func(ip6 bool) {
+		network := "ip4"
+		if ip6 {
+			network = "ip6"
+		}
+		addrs, err := (*_defaultResolver.Load()).LookupNetIP(ctx, network, host)
+		results <- result{ip6: ip6, addrs: addrs, err: err}
+	}
+
+	pending := 0
+	if ip4 {
+		pending++
+		go lookup(false)
+	}
+	if ip6 {
+		pending++
+		go lookup(true)
+	}
+
+	var (
+		addrs   []netip.Addr
+		errs    []error
+		timeout <-chan time.Time
+	)
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			addrs = append(addrs, r.addrs...)
+			if r.err != nil {
+				errs = append(errs, r.err)
+			}
+			// The addresses of preferred family are waited briefly.
+			if pending > 0 && len(r.addrs) > 0 && r.ip6 == (pref == PreferIPv4) {
+				timeout = time.After(resolutionDelay)
+			}
+		case <-timeout:
+			pending = 0
+		}
+	}
+
+	if len(addrs) == 0 {
+		if len(errs) == 0 {
+			errs = append(errs, fmt.Errorf("no address for %s", host))
+		}
+		return nil, errors.Join(errs...)
+	}
+	return sortAddrs(host, addrs, port, pref), nil
+}
+
+// sortAddrs interleaves the address families starting with the preferred
+// one, as RFC 8305 section 4. The address connected last is tried first,
+// and the ones failed recently are tried last.
+func sortAddrs(host string, addrs []netip.Addr, port uint16, pref Preference) []netip.AddrPort {
+	last := _addrCache.lastAddr(host, port)
+
+	var primary, secondary, failed []netip.AddrPort
+	failedAt := make(map[netip.AddrPort]time.Time)
+	for _, addr := range addrs {
+		addrPort := netip.AddrPortFrom(addr.Unmap(), port)
+		switch t := _addrCache.failedAt(addrPort); {
+		case !t.IsZero():
+			failedAt[addrPort] = t
+			failed = append(failed, addrPort)
+		case addrPort == last:
+			primary = append([]netip.AddrPort{addrPort}, primary...)
+		case addrPort.Addr().Is6() == (pref != PreferIPv4):
+			primary = append(primary, addrPort)
+		default:
+			secondary = append(secondary, addrPort)
+		}
+	}
+
+	sorted := make([]netip.AddrPort, 0, len(addrs))
+	for i := 0; i < len(primary) || i < len(secondary); i++ {
+		if i < len(primary) {
+			sorted = append(sorted, primary[i])
+		}
+		if i < len(secondary) {
+			sorted = append(sorted, secondary[i])
+		}
+	}
+
+	sort.SliceStable(failed, func(i, j int) bool {
+		return failedAt[failed[i]].Before(failedAt[failed[j]])
+	})
+	return append(sorted, failed...)
+}
+
+// LookupIP resolves host to the most preferred IP address allowed by
+// network, e.g. "ip4", with the default Resolver.
+func LookupIP(ctx context.Context, network, host string) (netip.Addr, error) {
+	addrs, err := lookupAddrs(ctx, network, host, 0)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addrs[0].Addr(), nil
+}
+
+// ResolveUDPAddr resolves address to the most preferred UDP address with
+// the default Resolver.
+func ResolveUDPAddr(ctx context.Context, network, address string) (*net.UDPAddr, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := net.LookupPort(network, portStr)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := lookupAddrs(ctx, network, host, uint16(port))
+	if err != nil {
+		return nil, err
+	}
+	return net.UDPAddrFromAddrPort(addrs[0]), nil
+}
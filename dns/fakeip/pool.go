@@ -0,0 +1,140 @@
+// Package fakeip provides a pool that maps domain names to fake IP addresses.
+package fakeip
+
+import (
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// reservedAddrs is the number of addresses reserved at the beginning
+// of the range, i.e. the network address and the gateway address.
+const reservedAddrs = 2
+
+// Pool allocates fake IPs from an IPv4 range for domain names. When the
+// range is exhausted, the least recently used address is recycled, where
+// an address is used by the lookups of either its host or itself.
+type Pool struct {
+	mu sync.Mutex
+
+	prefix netip.Prefix
+	last   uint32
+	next   uint32
+
+	// lru holds the records in order of use, the least recently used
+	// one in the front.
+	lru      *list.List
+	hostToIP map[string]*list.Element
+	ipToHost map[uint32]*list.Element
+}
+
+type record struct {
+	host string
+	ip   uint32
+}
+
+// New creates a Pool from IPv4 CIDR, e.g. "198.18.0.0/15".
+func New(cidr string) (*Pool, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, err
+	}
+	prefix = prefix.Masked()
+
+	if !prefix.Addr().Is4() {
+		return nil, errors.New("only IPv4 range is supported")
+	}
+
+	bits := 32 - prefix.Bits()
+	if bits < 2 {
+		return nil, errors.New("fake-ip range too small")
+	}
+
+	first := ipToUint32(prefix.Addr()) + reservedAddrs
+	last := ipToUint32(prefix.Addr()) + uint32(1<<bits-1) - 1 /* broadcast */
+
+	return &Pool{
+		prefix:   prefix,
+		last:     last,
+		next:     first,
+		lru:      list.New(),
+		hostToIP: make(map[string]*list.Element),
+		ipToHost: make(map[uint32]*list.Element),
+	}, nil
+}
+
+// Lookup returns the fake IP of host, allocating a new one if needed.
+func (p *Pool) Lookup(host string) net.IP {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.hostToIP[host]; ok {
+		p.lru.MoveToBack(e)
+		return uint32ToIP(e.Value.(*record).ip)
+	}
+
+	var ip uint32
+	if p.next <= p.last {
+		ip = p.next
+		p.next++
+	} else {
+		// recycle the least recently used address.
+		e := p.lru.Front()
+		old := p.lru.Remove(e).(*record)
+		delete(p.hostToIP, old.host)
+		delete(p.ipToHost, old.ip)
+		ip = old.ip
+	}
+
+	e := p.lru.PushBack(&record{host: host, ip: ip})
+	p.hostToIP[host] = e
+	p.ipToHost[ip] = e
+	return uint32ToIP(ip)
+}
+
+// LookBack returns the host that the fake IP is allocated for, which
+// marks the address used by the connection to it.
+func (p *Pool) LookBack(ip net.IP) (string, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok || !p.prefix.Contains(addr.Unmap()) {
+		return "", false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, ok := p.ipToHost[ipToUint32(addr.Unmap())]
+	if !ok {
+		return "", false
+	}
+	p.lru.MoveToBack(e)
+	return e.Value.(*record).host, true
+}
+
+// Contains reports whether ip is in the fake-ip range.
+func (p *Pool) Contains(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	return ok && p.prefix.Contains(addr.Unmap())
+}
+
+// Prefix returns the fake-ip range of Pool.
+func (p *Pool) Prefix() netip.Prefix {
+	return p.prefix
+}
+
+func ipToUint32(addr netip.Addr) uint32 {
+	b := addr.As4()
+	return binary.BigEndian.Uint32(b[:])
+}
+
+func uint32ToIP(v uint32) net.IP {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, v)
+	return ip
+}
@@ -0,0 +1,64 @@
+package fakeip
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolLookup(t *testing.T) {
+	pool, err := New("198.18.0.0/15")
+	require.NoError(t, err)
+
+	ip := pool.Lookup("example.com")
+	assert.Equal(t, net.IPv4(198, 18, 0, 2).To4(), ip)
+	assert.Equal(t, ip, pool.Lookup("Example.COM."))
+	assert.Equal(t, net.IPv4(198, 18, 0, 3).To4(), pool.Lookup("example.org"))
+
+	host, ok := pool.LookBack(ip)
+	assert.True(t, ok)
+	assert.Equal(t, "example.com", host)
+
+	_, ok = pool.LookBack(net.IPv4(198, 18, 0, 100))
+	assert.False(t, ok)
+	_, ok = pool.LookBack(net.IPv4(10, 0, 0, 2))
+	assert.False(t, ok)
+
+	assert.True(t, pool.Contains(net.IPv4(198, 19, 255, 255)))
+	assert.False(t, pool.Contains(net.IPv4(198, 20, 0, 0)))
+}
+
+func TestPoolRecycle(t *testing.T) {
+	// 198.18.0.2 - 198.18.0.6 are available.
+	pool, err := New("198.18.0.0/29")
+	require.NoError(t, err)
+
+	for _, host := range []string{"a", "b", "c", "d", "e"} {
+		pool.Lookup(host)
+	}
+
+	// "a" is queried again, and "b" is in use by connections, so "c"
+	// is the least recently used.
+	pool.Lookup("a")
+	_, ok := pool.LookBack(net.IPv4(198, 18, 0, 3))
+	assert.True(t, ok)
+
+	ip := pool.Lookup("f")
+	assert.Equal(t, net.IPv4(198, 18, 0, 4).To4(), ip)
+
+	host, ok := pool.LookBack(ip)
+	assert.True(t, ok)
+	assert.Equal(t, "f", host)
+	assert.Equal(t, net.IPv4(198, 18, 0, 2).To4(), pool.Lookup("a"))
+	assert.Equal(t, net.IPv4(198, 18, 0, 3).To4(), pool.Lookup("b"))
+	assert.Equal(t, net.IPv4(198, 18, 0, 5).To4(), pool.Lookup("c"))
+}
+
+func TestPoolInvalidRange(t *testing.T) {
+	for _, cidr := range []string{"", "198.18.0.0", "fd00::/64", "198.18.0.0/31"} {
+		_, err := New(cidr)
+		assert.Error(t, err, cidr)
+	}
+}
@@ -0,0 +1,162 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/xjasonlyu/tun2socks/v2/common/pool"
+	"github.com/xjasonlyu/tun2socks/v2/dns/fakeip"
+)
+
+const (
+	// fakeTTL is the TTL of fake records, keep it short so that
+	// clients would not cache the recycled addresses for long.
+	fakeTTL = 1
+
+	// maxMessageSize is the maximum size of DNS message over TCP.
+	maxMessageSize = 65535
+)
+
+// FakeServer is a DNS server answering A queries with fake IPs,
+// which are mapped back to domain names when connections to them
+// are made.
+type FakeServer struct {
+	pool *fakeip.Pool
+}
+
+func NewFakeServer(pool *fakeip.Pool) *FakeServer {
+	return &FakeServer{pool: pool}
+}
+
+// Contains reports whether ip is a fake IP of FakeServer.
+func (s *FakeServer) Contains(ip net.IP) bool {
+	return s.pool.Contains(ip)
+}
+
+// LookBack returns the domain name that the fake IP stands for.
+func (s *FakeServer) LookBack(ip net.IP) (string, bool) {
+	return s.pool.LookBack(ip)
+}
+
+// ServePacket serves DNS queries from pc until read fails,
+// timeout is the read deadline of each query.
+func (s *FakeServer) ServePacket(pc net.PacketConn, timeout time.Duration) error {
+	buf := pool.Get(pool.MaxSegmentSize)
+	defer pool.Put(buf)
+
+	for {
+		pc.SetReadDeadline(time.Now().Add(timeout))
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		resp, err := s.handle(buf[:n])
+		if err != nil {
+			continue /* ignore malformed query */
+		}
+
+		if _, err = pc.WriteTo(resp, addr); err != nil {
+			return err
+		}
+	}
+}
+
+// ServeConn serves length-prefixed DNS queries from c as described
+// in RFC 1035 section 4.2.2 until read fails.
+func (s *FakeServer) ServeConn(c net.Conn, timeout time.Duration) error {
+	buf := make([]byte, 2+maxMessageSize)
+
+	for {
+		c.SetReadDeadline(time.Now().Add(timeout))
+		if _, err := io.ReadFull(c, buf[:2]); err != nil {
+			return err
+		}
+
+		length := int(binary.BigEndian.Uint16(buf[:2]))
+		if _, err := io.ReadFull(c, buf[2:2+length]); err != nil {
+			return err
+		}
+
+		resp, err := s.handle(buf[2 : 2+length])
+		if err != nil {
+			return err
+		}
+
+		binary.BigEndian.PutUint16(buf[:2], uint16(len(resp)))
+		if _, err = c.Write(append(buf[:2], resp...)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *FakeServer) handle(query []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+
+	h, err := p.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	if h.Response {
+		return nil, errors.New("not a query")
+	}
+
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return nil, err
+	}
+
+	if h.OpCode != 0 /* QUERY */ || len(questions) != 1 {
+		b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+			ID:       h.ID,
+			Response: true,
+			OpCode:   h.OpCode,
+			RCode:    dnsmessage.RCodeNotImplemented,
+		})
+		return b.Finish()
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:                 h.ID,
+		Response:           true,
+		OpCode:             h.OpCode,
+		RecursionDesired:   h.RecursionDesired,
+		RecursionAvailable: true,
+		RCode:              dnsmessage.RCodeSuccess,
+	})
+	b.EnableCompression()
+
+	q := questions[0]
+	if err = b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err = b.Question(q); err != nil {
+		return nil, err
+	}
+	if err = b.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	// Only A records are faked, other types of queries are answered
+	// with no records, so that clients would fall back to IPv4.
+	if q.Type == dnsmessage.TypeA && q.Class == dnsmessage.ClassINET {
+		var a dnsmessage.AResource
+		copy(a.A[:], s.pool.Lookup(q.Name.String()).To4())
+
+		if err = b.AResource(dnsmessage.ResourceHeader{
+			Name:  q.Name,
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+			TTL:   fakeTTL,
+		}, a); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.Finish()
+}
@@ -0,0 +1,56 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/xjasonlyu/tun2socks/v2/dns/fakeip"
+)
+
+func TestFakeServerHandle(t *testing.T) {
+	pool, err := fakeip.New("198.18.0.0/15")
+	require.NoError(t, err)
+	s := NewFakeServer(pool)
+
+	query := func(name string, typ dnsmessage.Type) *dnsmessage.Message {
+		msg := dnsmessage.Message{
+			Header: dnsmessage.Header{ID: 0x1234, RecursionDesired: true},
+			Questions: []dnsmessage.Question{{
+				Name:  dnsmessage.MustNewName(name),
+				Type:  typ,
+				Class: dnsmessage.ClassINET,
+			}},
+		}
+		b, err := msg.Pack()
+		require.NoError(t, err)
+
+		resp, err := s.handle(b)
+		require.NoError(t, err)
+
+		var m dnsmessage.Message
+		require.NoError(t, m.Unpack(resp))
+		return &m
+	}
+
+	m := query("example.com.", dnsmessage.TypeA)
+	assert.Equal(t, uint16(0x1234), m.ID)
+	assert.True(t, m.Response)
+	assert.Equal(t, dnsmessage.RCodeSuccess, m.RCode)
+	require.Len(t, m.Answers, 1)
+
+	a := m.Answers[0].Body.(*dnsmessage.AResource)
+	ip := net.IP(a.A[:])
+	assert.True(t, s.Contains(ip))
+
+	host, ok := s.LookBack(ip)
+	assert.True(t, ok)
+	assert.Equal(t, "example.com", host)
+
+	m = query("example.com.", dnsmessage.TypeAAAA)
+	assert.Equal(t, dnsmessage.RCodeSuccess, m.RCode)
+	assert.Empty(t, m.Answers)
+}
@@ -69,6 +69,14 @@ run() {
     ARGS="$ARGS --udp-timeout $UDP_TIMEOUT"
   fi
 
+  if [ -n "$UDP_NAT" ]; then
+    ARGS="$ARGS --udp-nat $UDP_NAT"
+  fi
+
+  if [ -n "$ICMP_MODE" ]; then
+    ARGS="$ARGS --icmp-mode $ICMP_MODE"
+  fi
+
   if [ -n "$TCP_SNDBUF" ]; then
     ARGS="$ARGS --tcp-sndbuf $TCP_SNDBUF"
   fi
@@ -77,6 +85,22 @@ run() {
     ARGS="$ARGS --tcp-rcvbuf $TCP_RCVBUF"
   fi
 
+  if [ -n "$FAKE_IP_RANGE" ]; then
+    ARGS="$ARGS --fake-ip-range $FAKE_IP_RANGE"
+  fi
+
+  if [ -n "$SNIFF_PORTS" ]; then
+    ARGS="$ARGS --sniff-ports $SNIFF_PORTS"
+  fi
+
+  if [ -n "$IP_PREFERENCE" ]; then
+    ARGS="$ARGS --ip-preference $IP_PREFERENCE"
+  fi
+
+  if [ -n "$PROXY_DNS" ]; then
+    ARGS="$ARGS --proxy-dns $PROXY_DNS"
+  fi
+
   if [ "$TCP_AUTO_TUNING" = 1 ]; then
     ARGS="$ARGS --tcp-auto-tuning"
   fi
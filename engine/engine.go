@@ -2,7 +2,9 @@ package engine
 
 import (
 	"errors"
+	"fmt"
 	"net"
+	"net/netip"
 	"os/exec"
 	"strings"
 	"sync"
@@ -16,21 +18,32 @@ import (
 	"github.com/xjasonlyu/tun2socks/v2/core/device"
 	"github.com/xjasonlyu/tun2socks/v2/core/option"
 	"github.com/xjasonlyu/tun2socks/v2/dialer"
+	"github.com/xjasonlyu/tun2socks/v2/dns"
+	"github.com/xjasonlyu/tun2socks/v2/dns/fakeip"
 	"github.com/xjasonlyu/tun2socks/v2/engine/mirror"
 	"github.com/xjasonlyu/tun2socks/v2/log"
 	"github.com/xjasonlyu/tun2socks/v2/proxy"
 	"github.com/xjasonlyu/tun2socks/v2/restapi"
+	"github.com/xjasonlyu/tun2socks/v2/rule"
 	"github.com/xjasonlyu/tun2socks/v2/tunnel"
 )
 
+// Built-in outbound names that rules can refer to.
+const (
+	directOutbound = "DIRECT"
+	rejectOutbound = "REJECT"
+	proxyOutbound  = "PROXY"
+)
+
 var (
 	_engineMu sync.Mutex
 
 	// _defaultKey holds the default key for the engine.
 	_defaultKey *Key
 
-	// _defaultProxy holds the default proxy for the engine.
-	_defaultProxy proxy.Proxy
+	// _defaultProxies holds the named proxies for the engine, which
+	// are closed on stop.
+	_defaultProxies map[string]proxy.Proxy
 
 	// _defaultDevice holds the default device for the engine.
 	_defaultDevice device.Device
@@ -88,6 +101,10 @@ func stop() (err error) {
 		_defaultStack.Close()
 		_defaultStack.Wait()
 	}
+	for _, p := range _defaultProxies {
+		closeProxies(p)
+	}
+	_defaultProxies = nil
 	_engineMu.Unlock()
 	return err
 }
@@ -123,12 +140,80 @@ func general(k *Key) error {
 		log.Infof("[DIALER] set fwmark: %#x", k.Mark)
 	}
 
+	if k.IPPreference != "" {
+		pref, err := dialer.ParsePreference(k.IPPreference)
+		if err != nil {
+			return err
+		}
+		dialer.SetPreference(pref)
+		log.Infof("[DIALER] ip preference: %s", pref)
+	}
+
+	if k.ProxyDNS != "" {
+		// The DNS server is an IP address, which needs no resolving.
+		if _, err := netip.ParseAddrPort(k.ProxyDNS); err != nil {
+			return fmt.Errorf("invalid proxy dns: %w", err)
+		}
+		dialer.SetResolver(dialer.NewResolver(k.ProxyDNS))
+		log.Infof("[DIALER] resolve proxy servers with: %s", k.ProxyDNS)
+	}
+
+	// UDP over TCP is probed with the DNS server of proxy servers, if
+	// no other one is set.
+	if probe := k.UoTProbe; probe != "" || k.ProxyDNS != "" {
+		if probe == "" {
+			probe = k.ProxyDNS
+		}
+		addr, err := netip.ParseAddrPort(probe)
+		if err != nil {
+			return fmt.Errorf("invalid uot probe: %w", err)
+		}
+		proxy.SetUoTProbeAddr(net.UDPAddrFromAddrPort(addr))
+		log.Infof("[UOT] probe UDP with: %s", addr)
+	}
+
 	if k.UDPTimeout > 0 {
 		if k.UDPTimeout < time.Second {
 			return errors.New("invalid udp timeout value")
 		}
 		tunnel.SetUDPTimeout(k.UDPTimeout)
 	}
+
+	if k.UDPNAT != "" {
+		nat, err := tunnel.ParseNATType(k.UDPNAT)
+		if err != nil {
+			return err
+		}
+		tunnel.SetNATType(nat)
+		log.Infof("[UDP] nat type: %s", nat)
+	}
+
+	if k.ICMPMode != "" {
+		mode, err := tunnel.ParseICMPMode(k.ICMPMode)
+		if err != nil {
+			return err
+		}
+		tunnel.SetICMPMode(mode)
+		log.Infof("[ICMP] echo mode: %s", mode)
+	}
+
+	if k.FakeIPRange != "" {
+		pool, err := fakeip.New(k.FakeIPRange)
+		if err != nil {
+			return err
+		}
+		tunnel.SetFakeDNS(dns.NewFakeServer(pool))
+		log.Infof("[DNS] fake-ip range: %s", pool.Prefix())
+	}
+
+	if k.SniffPorts != "" {
+		matcher, err := rule.NewPort(k.SniffPorts, "", false)
+		if err != nil {
+			return err
+		}
+		tunnel.SetSniffing(matcher, k.SniffTimeout)
+		log.Infof("[SNIFF] enabled on ports: %s", k.SniffPorts)
+	}
 	return nil
 }
 
@@ -162,7 +247,7 @@ func restAPI(k *Key) error {
 }
 
 func netstack(k *Key) (err error) {
-	if k.Proxy == "" {
+	if k.Proxy == "" && len(k.Outbounds) == 0 && len(k.Groups) == 0 {
 		return errors.New("empty proxy")
 	}
 	if k.Device == "" {
@@ -184,10 +269,39 @@ func netstack(k *Key) (err error) {
 		}
 	}()
 
-	if _defaultProxy, err = parseProxy(k.Proxy); err != nil {
+	var (
+		proxies     map[string]proxy.Proxy
+		defaultName string
+	)
+	if proxies, defaultName, err = parseOutbounds(k.Proxy, k.Outbounds, k.Groups); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			for _, p := range proxies {
+				closeProxies(p)
+			}
+			_defaultProxies = nil
+		}
+	}()
+	// The default proxy is switched by tunnel at runtime, which is
+	// looked up by tunnel.Default rather than kept here.
+	_defaultProxies = proxies
+
+	var rules []rule.Rule
+	if rules, err = parseRules(k.Rules, proxies); err != nil {
+		return
+	}
+	var policies map[string]tunnel.RetryPolicy
+	if policies, err = parsePolicies(k.Outbounds, proxies); err != nil {
+		return
+	}
+	tunnel.UpdateProxies(proxies)
+	tunnel.UpdatePolicies(policies)
+	tunnel.UpdateRules(rules)
+	if _, err = tunnel.SetDefault(defaultName); err != nil {
 		return
 	}
-	proxy.SetDialer(_defaultProxy)
 
 	if _defaultDevice, err = parseDevice(k.Device, uint32(k.MTU)); err != nil {
 		return
@@ -229,9 +343,9 @@ func netstack(k *Key) (err error) {
 	}
 
 	log.Infof(
-		"[STACK] %s://%s <-> %s://%s",
+		"[STACK] %s://%s <-> %s://%s (%s)",
 		_defaultDevice.Type(), _defaultDevice.Name(),
-		_defaultProxy.Proto(), _defaultProxy.Addr(),
+		proxies[defaultName].Proto(), proxies[defaultName].Addr(), defaultName,
 	)
 	return nil
 }
@@ -10,6 +10,9 @@ type Key struct {
 	Device                   string        `yaml:"device"`
 	LogLevel                 string        `yaml:"loglevel"`
 	Interface                string        `yaml:"interface"`
+	IPPreference             string        `yaml:"ip-preference"`
+	ProxyDNS                 string        `yaml:"proxy-dns"`
+	UoTProbe                 string        `yaml:"uot-probe"`
 	TCPModerateReceiveBuffer bool          `yaml:"tcp-moderate-receive-buffer"`
 	TCPSendBufferSize        string        `yaml:"tcp-send-buffer-size"`
 	TCPReceiveBufferSize     string        `yaml:"tcp-receive-buffer-size"`
@@ -17,4 +20,34 @@ type Key struct {
 	TUNPreUp                 string        `yaml:"tun-pre-up"`
 	TUNPostUp                string        `yaml:"tun-post-up"`
 	UDPTimeout               time.Duration `yaml:"udp-timeout"`
+	UDPNAT                   string        `yaml:"udp-nat"`
+	ICMPMode                 string        `yaml:"icmp-mode"`
+	FakeIPRange              string        `yaml:"fake-ip-range"`
+	SniffPorts               string        `yaml:"sniff-ports"`
+	SniffTimeout             time.Duration `yaml:"sniff-timeout"`
+	Outbounds                []Outbound    `yaml:"outbounds"`
+	Groups                   []Group       `yaml:"groups"`
+	Rules                    []string      `yaml:"rules"`
+}
+
+// Outbound is a named proxy declared in the configuration. The TCP
+// dials failed on connecting are retried Retry times every RetryInterval,
+// each timed out after RetryTimeout, and then through Fallbacks in order.
+type Outbound struct {
+	Name          string        `yaml:"name"`
+	URL           string        `yaml:"url"`
+	Retry         int           `yaml:"retry"`
+	RetryInterval time.Duration `yaml:"retry-interval"`
+	RetryTimeout  time.Duration `yaml:"retry-timeout"`
+	Fallbacks     []string      `yaml:"fallbacks"`
+}
+
+// Group is a named policy group over outbounds or other groups, or a
+// relay chaining the outbounds in order if Type is "relay".
+type Group struct {
+	Name      string        `yaml:"name"`
+	Type      string        `yaml:"type"`
+	Outbounds []string      `yaml:"outbounds"`
+	URL       string        `yaml:"url"`
+	Interval  time.Duration `yaml:"interval"`
 }
@@ -16,3 +16,7 @@ func (*Tunnel) HandleTCP(conn adapter.TCPConn) {
 func (*Tunnel) HandleUDP(conn adapter.UDPConn) {
 	tunnel.UDPIn() <- conn
 }
+
+func (*Tunnel) HandleICMP(echo adapter.ICMPEcho) {
+	tunnel.ICMPIn() <- echo
+}
@@ -3,15 +3,27 @@ package engine
 import (
 	"encoding/base64"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/netip"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/xjasonlyu/tun2socks/v2/core/device"
 	"github.com/xjasonlyu/tun2socks/v2/core/device/fdbased"
 	"github.com/xjasonlyu/tun2socks/v2/core/device/tun"
+	"github.com/xjasonlyu/tun2socks/v2/log"
 	"github.com/xjasonlyu/tun2socks/v2/proxy"
 	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+	"github.com/xjasonlyu/tun2socks/v2/rule"
+	"github.com/xjasonlyu/tun2socks/v2/transport/h2"
+	"github.com/xjasonlyu/tun2socks/v2/transport/mux"
+	"github.com/xjasonlyu/tun2socks/v2/transport/wireguard"
+	"github.com/xjasonlyu/tun2socks/v2/transport/ws"
+	"github.com/xjasonlyu/tun2socks/v2/tunnel"
 )
 
 func parseRestAPI(s string) (*url.URL, error) {
@@ -64,6 +76,12 @@ func parseDevice(s string, mtu uint32) (device.Device, error) {
 	}
 }
 
+// Schemes of the proxies over TLS.
+const (
+	httpsScheme     = "https"
+	socks5TLSScheme = "socks5+tls"
+)
+
 func parseProxy(s string) (proxy.Proxy, error) {
 	if !strings.Contains(s, "://") {
 		s = fmt.Sprintf("%s://%s", proto.Socks5 /* default protocol */, s)
@@ -74,6 +92,28 @@ func parseProxy(s string) (proxy.Proxy, error) {
 		return nil, err
 	}
 
+	p, err := newProxy(u)
+	if err != nil {
+		return nil, err
+	}
+
+	poolOpts, err := parsePool(u.Query())
+	if err != nil {
+		return nil, err
+	}
+	if poolOpts.Size > 0 {
+		if err = proxy.EnablePool(p, poolOpts); err != nil {
+			return nil, err
+		}
+	}
+
+	if config, ok := parseMux(u.Query()); ok {
+		return proxy.NewMux(p, config), nil
+	}
+	return p, nil
+}
+
+func newProxy(u *url.URL) (proxy.Proxy, error) {
 	protocol := strings.ToLower(u.Scheme)
 
 	switch protocol {
@@ -81,22 +121,238 @@ func parseProxy(s string) (proxy.Proxy, error) {
 		return proxy.NewDirect(), nil
 	case proto.Reject.String():
 		return proxy.NewReject(), nil
-	case proto.HTTP.String():
+	case proto.HTTP.String(), httpsScheme:
 		return proxy.NewHTTP(parseHTTP(u))
 	case proto.Socks4.String():
 		return proxy.NewSocks4(parseSocks4(u))
-	case proto.Socks5.String():
+	case proto.Socks5.String(), socks5TLSScheme:
 		return proxy.NewSocks5(parseSocks5(u))
 	case proto.Shadowsocks.String():
 		return proxy.NewShadowsocks(parseShadowsocks(u))
+	case proto.Trojan.String():
+		return proxy.NewTrojan(parseTrojan(u))
+	case proto.VLESS.String():
+		return proxy.NewVLESS(parseVLESS(u))
+	case proto.VMess.String():
+		return proxy.NewVMess(parseVMess(u))
+	case proto.WireGuard.String():
+		cfg, err := parseWireGuard(u)
+		if err != nil {
+			return nil, err
+		}
+		return proxy.NewWireGuard(cfg)
+	case proto.SSH.String():
+		return proxy.NewSSH(parseSSH(u))
 	default:
 		return nil, fmt.Errorf("unsupported protocol: %s", protocol)
 	}
 }
 
-func parseHTTP(u *url.URL) (address, username, password string) {
+// parseMux parses the mux settings, where "mux" is either a boolean or
+// the max number of connections, and "mux-streams" is the number of
+// streams per connection.
+func parseMux(query url.Values) (config mux.PoolConfig, ok bool) {
+	s := query.Get("mux")
+	if n, err := strconv.Atoi(s); err == nil {
+		config.MaxConnections, ok = n, n > 0
+	} else {
+		ok, _ = strconv.ParseBool(s)
+	}
+	config.MaxStreams, _ = strconv.Atoi(query.Get("mux-streams"))
+	return
+}
+
+// parsePool parses the connection pool settings, where "pool" is the
+// number of idle connections, "pool-idle" and "pool-probe" are the idle
+// timeout and probe interval.
+func parsePool(query url.Values) (opts proxy.PoolOptions, err error) {
+	if s := query.Get("pool"); s != "" {
+		if opts.Size, err = strconv.Atoi(s); err != nil {
+			return opts, fmt.Errorf("invalid pool size: %s", s)
+		}
+	}
+	if s := query.Get("pool-idle"); s != "" {
+		if opts.IdleTimeout, err = time.ParseDuration(s); err != nil {
+			return opts, fmt.Errorf("invalid pool idle timeout: %s", s)
+		}
+	}
+	if s := query.Get("pool-probe"); s != "" {
+		if opts.ProbeInterval, err = time.ParseDuration(s); err != nil {
+			return opts, fmt.Errorf("invalid pool probe interval: %s", s)
+		}
+	}
+	return opts, nil
+}
+
+// parseOutbounds parses the proxy shortcut, the declared outbounds and
+// groups into named proxies along with the built-in ones. The proxy
+// shortcut, if given, is the default outbound, otherwise the first
+// declared outbound or group.
+func parseOutbounds(s string, outbounds []Outbound, groups []Group) (proxies map[string]proxy.Proxy, defaultName string, err error) {
+	proxies = map[string]proxy.Proxy{
+		directOutbound: proxy.NewDirect(),
+		rejectOutbound: proxy.NewReject(),
+	}
+
+	// The proxies created are closed on error, as proxies is nil then.
+	created := proxies
+	defer func() {
+		if err != nil {
+			for _, p := range created {
+				closeProxies(p)
+			}
+		}
+	}()
+
+	if s != "" {
+		outbounds = append([]Outbound{{Name: proxyOutbound, URL: s}}, outbounds...)
+	}
+
+	// urls are kept for relays to create their own hops.
+	urls := make(map[string]string, len(outbounds))
+
+	for _, o := range outbounds {
+		if o.Name == "" {
+			return nil, "", fmt.Errorf("empty outbound name: %s", o.URL)
+		}
+		if _, ok := proxies[o.Name]; ok {
+			return nil, "", fmt.Errorf("duplicate outbound name: %s", o.Name)
+		}
+
+		p, err := parseProxy(o.URL)
+		if err != nil {
+			return nil, "", fmt.Errorf("outbound %s: %w", o.Name, err)
+		}
+		proxies[o.Name] = p
+		urls[o.Name] = o.URL
+
+		if defaultName == "" {
+			defaultName = o.Name
+		}
+	}
+
+	// Groups may refer to the groups declared before them.
+	for _, g := range groups {
+		if g.Name == "" {
+			return nil, "", fmt.Errorf("empty group name: %s", g.Type)
+		}
+		if _, ok := proxies[g.Name]; ok {
+			return nil, "", fmt.Errorf("duplicate outbound name: %s", g.Name)
+		}
+
+		var p proxy.Proxy
+		if strings.EqualFold(g.Type, proto.Relay.String()) {
+			p, err = parseRelay(g, proxies, urls)
+		} else {
+			p, err = parseGroup(g, proxies)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("group %s: %w", g.Name, err)
+		}
+		proxies[g.Name] = p
+
+		if defaultName == "" {
+			defaultName = g.Name
+		}
+	}
+	return
+}
+
+func parseGroup(g Group, proxies map[string]proxy.Proxy) (proxy.Group, error) {
+	members := make([]proxy.Member, 0, len(g.Outbounds))
+	for _, name := range g.Outbounds {
+		p, ok := proxies[name]
+		if !ok {
+			return nil, fmt.Errorf("outbound %s not found", name)
+		}
+		members = append(members, proxy.Member{Name: name, Proxy: p})
+	}
+
+	switch typ := strings.ToLower(g.Type); typ {
+	case proto.URLTest.String():
+		return proxy.NewURLTest(members, g.URL, g.Interval)
+	case proto.Fallback.String():
+		return proxy.NewFallback(members, g.URL, g.Interval)
+	case proto.LoadBalance.String():
+		return proxy.NewLoadBalance(members, g.URL, g.Interval)
+	default:
+		return nil, fmt.Errorf("unsupported group type: %s", g.Type)
+	}
+}
+
+// closeProxies closes the proxies holding resources, e.g. the plugins.
+func closeProxies(proxies ...proxy.Proxy) {
+	for _, p := range proxies {
+		if c, ok := p.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				log.Warnf("[ENGINE] failed to close %s %s: %v", p.Proto(), p.Addr(), err)
+			}
+		}
+	}
+}
+
+// parseRelay creates the hops of relay, where the hops other than the
+// first are created from their outbound URLs, so that the outbounds
+// themselves are not modified.
+func parseRelay(g Group, proxies map[string]proxy.Proxy, urls map[string]string) (proxy.Proxy, error) {
+	hops := make([]proxy.Proxy, 0, len(g.Outbounds))
+	// owned are the hops created for relay, which are closed on error.
+	var owned []proxy.Proxy
+	for i, name := range g.Outbounds {
+		if i == 0 {
+			p, ok := proxies[name]
+			if !ok {
+				return nil, fmt.Errorf("outbound %s not found", name)
+			}
+			hops = append(hops, p)
+			continue
+		}
+
+		u, ok := urls[name]
+		if !ok {
+			closeProxies(owned...)
+			return nil, fmt.Errorf("outbound %s not found or not chainable", name)
+		}
+		// The plugin is rejected before it's started for nothing.
+		if hasPlugin(u) {
+			closeProxies(owned...)
+			return nil, fmt.Errorf("outbound %s: sip003 plugin cannot be chained", name)
+		}
+		p, err := parseProxy(u)
+		if err != nil {
+			closeProxies(owned...)
+			return nil, fmt.Errorf("outbound %s: %w", name, err)
+		}
+		hops = append(hops, p)
+		owned = append(owned, p)
+	}
+
+	r, err := proxy.NewRelay(hops)
+	if err != nil {
+		closeProxies(owned...)
+		return nil, err
+	}
+	return r, nil
+}
+
+// hasPlugin reports whether s is the URL of shadowsocks with a SIP003
+// plugin, which connects to the server by itself.
+func hasPlugin(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || !strings.EqualFold(u.Scheme, proto.Shadowsocks.String()) {
+		return false
+	}
+	_, _, _, opts := parseShadowsocks(u)
+	return opts.Plugin != ""
+}
+
+func parseHTTP(u *url.URL) (address, username, password string, tlsOpts *proxy.TLSOptions) {
 	address, username = u.Host, u.User.Username()
 	password, _ = u.User.Password()
+
+	if strings.EqualFold(u.Scheme, httpsScheme) {
+		tlsOpts = parseTLSOptions(u.Query())
+	}
 	return
 }
 
@@ -105,7 +361,7 @@ func parseSocks4(u *url.URL) (address, username string) {
 	return
 }
 
-func parseSocks5(u *url.URL) (address, username, password string) {
+func parseSocks5(u *url.URL) (address, username, password string, opts proxy.StreamOptions, uot proxy.UoT) {
 	address, username = u.Host, u.User.Username()
 	password, _ = u.User.Password()
 
@@ -113,10 +369,16 @@ func parseSocks5(u *url.URL) (address, username, password string) {
 	if address == "" {
 		address = u.Path
 	}
+
+	opts = parseStreamOptions(u.Query())
+	if strings.EqualFold(u.Scheme, socks5TLSScheme) && opts.TLS == nil {
+		opts.TLS = parseTLSOptions(u.Query())
+	}
+	uot = parseUoT(u.Query().Get("uot"))
 	return
 }
 
-func parseShadowsocks(u *url.URL) (address, method, password, obfsMode, obfsHost string) {
+func parseShadowsocks(u *url.URL) (address, method, password string, opts proxy.ShadowsocksOptions) {
 	address = u.Host
 
 	if pass, set := u.User.Password(); set {
@@ -131,26 +393,252 @@ func parseShadowsocks(u *url.URL) (address, method, password, obfsMode, obfsHost
 		}
 	}
 
-	rawQuery, _ := url.QueryUnescape(u.RawQuery)
-	for _, s := range strings.Split(rawQuery, ";") {
-		data := strings.SplitN(s, "=", 2)
-		if len(data) != 2 {
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		param, _ = url.QueryUnescape(param)
+		key, value, _ := strings.Cut(param, "=")
+
+		switch key {
+		case "plugin":
+			// The plugin options may follow the plugin name as SIP002.
+			var pluginOpts string
+			opts.Plugin, pluginOpts, _ = strings.Cut(value, ";")
+			if pluginOpts != "" {
+				opts.PluginOpts = pluginOpts
+			}
+		case "plugin-opts":
+			opts.PluginOpts = value
+		default:
+			// The simple-obfs options are separated by ';' rather than '&'.
+			parseShadowsocksOptions(param, &opts)
+		}
+	}
+
+	opts.Stream = parseStreamOptions(u.Query())
+
+	// simple-obfs is built in rather than started as a plugin.
+	switch opts.Plugin {
+	case "obfs-local", "simple-obfs":
+		parseShadowsocksOptions(opts.PluginOpts, &opts)
+		opts.Plugin, opts.PluginOpts = "", ""
+	}
+	return
+}
+
+// parseShadowsocksOptions parses the ';' separated options of simple-obfs
+// and UDP over TCP.
+func parseShadowsocksOptions(s string, opts *proxy.ShadowsocksOptions) {
+	for _, option := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(option, "=")
+		if !ok {
 			continue
 		}
-		key := data[0]
-		value := data[1]
 
 		switch key {
 		case "obfs":
-			obfsMode = value
+			opts.ObfsMode = value
 		case "obfs-host":
-			obfsHost = value
+			opts.ObfsHost = value
+		case "uot":
+			opts.UoT = parseUoT(value)
+		}
+	}
+}
+
+// parseUoT parses the UDP-over-TCP mode, which is either "auto" or
+// a boolean.
+func parseUoT(s string) proxy.UoT {
+	if strings.EqualFold(s, proxy.UoTAuto.String()) {
+		return proxy.UoTAuto
+	}
+	if on, _ := strconv.ParseBool(s); on {
+		return proxy.UoTOn
+	}
+	return proxy.UoTOff
+}
+
+func parseTrojan(u *url.URL) (address, password string, opts proxy.StreamOptions) {
+	address, password = u.Host, u.User.Username()
+	opts = parseStreamOptions(u.Query())
+	return
+}
+
+func parseVLESS(u *url.URL) (address, id string, opts proxy.StreamOptions) {
+	address, id = u.Host, u.User.Username()
+	opts = parseStreamOptions(u.Query())
+	return
+}
+
+func parseVMess(u *url.URL) (address, id, security string, opts proxy.StreamOptions) {
+	query := u.Query()
+	address, id = u.Host, u.User.Username()
+	security = query.Get("encryption")
+	opts = parseStreamOptions(query)
+	return
+}
+
+func parseSSH(u *url.URL) (address string, opts proxy.SSHOptions) {
+	query := u.Query()
+
+	address = u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "22")
+	}
+
+	opts.User = u.User.Username()
+	opts.Password, _ = u.User.Password()
+	opts.KeyFile = query.Get("key")
+	opts.Passphrase = query.Get("passphrase")
+	opts.Agent, _ = strconv.ParseBool(query.Get("agent"))
+	opts.KnownHosts = query.Get("known-hosts")
+	return
+}
+
+func parseWireGuard(u *url.URL) (*wireguard.Config, error) {
+	query := u.Query()
+
+	// The '+' in base64 keys may be unescaped as space in query.
+	key := func(name string) string {
+		return strings.ReplaceAll(query.Get(name), " ", "+")
+	}
+
+	cfg := &wireguard.Config{
+		PrivateKey:   u.User.Username(),
+		PublicKey:    key("publickey"),
+		PresharedKey: key("presharedkey"),
+		Endpoint:     u.Host,
+	}
+
+	prefixes := func(name string) (prefixes []netip.Prefix, _ error) {
+		for _, s := range strings.Split(query.Get(name), ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			prefix, err := netip.ParsePrefix(s)
+			if err != nil {
+				// A single address is taken as a host prefix.
+				addr, err := netip.ParseAddr(s)
+				if err != nil {
+					return nil, fmt.Errorf("invalid %s: %s", name, s)
+				}
+				prefix = netip.PrefixFrom(addr, addr.BitLen())
+			}
+			prefixes = append(prefixes, prefix)
+		}
+		return
+	}
+
+	var err error
+	if cfg.Addresses, err = prefixes("address"); err != nil {
+		return nil, err
+	}
+	if cfg.AllowedIPs, err = prefixes("allowed-ips"); err != nil {
+		return nil, err
+	}
+
+	// The hosts are resolved outside the tunnel without DNS.
+	for _, s := range strings.Split(query.Get("dns"), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
 		}
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dns: %s", s)
+		}
+		cfg.DNS = append(cfg.DNS, addr)
+	}
+
+	if s := query.Get("reserved"); s != "" {
+		reserved := strings.Split(s, ",")
+		if len(reserved) != len(cfg.Reserved) {
+			return nil, fmt.Errorf("invalid reserved: %s", s)
+		}
+		for i, r := range reserved {
+			v, err := strconv.ParseUint(strings.TrimSpace(r), 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid reserved: %s", s)
+			}
+			cfg.Reserved[i] = byte(v)
+		}
+	}
+
+	if s := query.Get("mtu"); s != "" {
+		if cfg.MTU, err = strconv.Atoi(s); err != nil {
+			return nil, fmt.Errorf("invalid mtu: %s", s)
+		}
+	}
+	return cfg, nil
+}
+
+// parseStreamOptions parses the transport options in the query of
+// share link, e.g. "security=tls&sni=example.com&type=ws&path=/ws".
+func parseStreamOptions(query url.Values) (opts proxy.StreamOptions) {
+	if query.Get("security") == "tls" {
+		opts.TLS = parseTLSOptions(query)
 	}
 
+	switch query.Get("type") {
+	case "ws":
+		opts.WebSocket = &ws.Config{
+			Host:            query.Get("host"),
+			Path:            query.Get("path"),
+			Headers:         parseHeaders(query["header"]),
+			EarlyDataHeader: query.Get("eh"),
+		}
+		opts.WebSocket.MaxEarlyData, _ = strconv.Atoi(query.Get("ed"))
+
+		// The early data length may be in path as Xray, e.g. "/ws?ed=2048".
+		if u, err := url.Parse(opts.WebSocket.Path); err == nil && u.Query().Has("ed") {
+			q := u.Query()
+			opts.WebSocket.MaxEarlyData, _ = strconv.Atoi(q.Get("ed"))
+			q.Del("ed")
+			u.RawQuery = q.Encode()
+			opts.WebSocket.Path = u.String()
+		}
+	case "h2", "http":
+		opts.HTTP2 = &h2.Config{
+			Host:    query.Get("host"),
+			Path:    query.Get("path"),
+			Headers: parseHeaders(query["header"]),
+		}
+	}
 	return
 }
 
+// parseHeaders parses the headers in the form of "Name: Value".
+func parseHeaders(ss []string) http.Header {
+	if len(ss) == 0 {
+		return nil
+	}
+
+	header := http.Header{}
+	for _, s := range ss {
+		name, value, ok := strings.Cut(s, ":")
+		if !ok {
+			continue
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return header
+}
+
+func parseTLSOptions(query url.Values) *proxy.TLSOptions {
+	opts := &proxy.TLSOptions{
+		SNI:  query.Get("sni"),
+		CA:   query.Get("ca"),
+		Cert: query.Get("cert"),
+		Key:  query.Get("key"),
+	}
+	opts.SkipVerify, _ = strconv.ParseBool(query.Get("allowInsecure"))
+
+	for _, pin := range strings.Split(query.Get("pin"), ",") {
+		// The '+' in base64 pins may be unescaped as space in query.
+		if pin = strings.ReplaceAll(pin, " ", "+"); pin != "" {
+			opts.Pins = append(opts.Pins, pin)
+		}
+	}
+	return opts
+}
+
 func parseMulticastGroups(s string) (multicastGroups []net.IP, _ error) {
 	ipStrings := strings.Split(s, ",")
 	for _, ipString := range ipStrings {
@@ -168,3 +656,52 @@ func parseMulticastGroups(s string) (multicastGroups []net.IP, _ error) {
 	}
 	return
 }
+
+// parsePolicies parses the retry policies of the declared outbounds,
+// whose fallbacks must be other outbounds in proxies.
+func parsePolicies(outbounds []Outbound, proxies map[string]proxy.Proxy) (map[string]tunnel.RetryPolicy, error) {
+	policies := make(map[string]tunnel.RetryPolicy)
+	for _, o := range outbounds {
+		if o.Retry < 0 {
+			return nil, fmt.Errorf("outbound %s: invalid retry: %d", o.Name, o.Retry)
+		}
+		if o.RetryInterval < 0 {
+			return nil, fmt.Errorf("outbound %s: invalid retry interval: %s", o.Name, o.RetryInterval)
+		}
+		if o.RetryTimeout < 0 {
+			return nil, fmt.Errorf("outbound %s: invalid retry timeout: %s", o.Name, o.RetryTimeout)
+		}
+		for _, name := range o.Fallbacks {
+			if name == o.Name {
+				return nil, fmt.Errorf("outbound %s: fallback to itself", o.Name)
+			}
+			if _, ok := proxies[name]; !ok {
+				return nil, fmt.Errorf("outbound %s: fallback %s not found", o.Name, name)
+			}
+		}
+		if o.Retry == 0 && o.RetryTimeout == 0 && len(o.Fallbacks) == 0 {
+			continue
+		}
+		policies[o.Name] = tunnel.RetryPolicy{
+			Retries:   o.Retry,
+			Interval:  o.RetryInterval,
+			Timeout:   o.RetryTimeout,
+			Fallbacks: o.Fallbacks,
+		}
+	}
+	return policies, nil
+}
+
+func parseRules(ss []string, proxies map[string]proxy.Proxy) (rules []rule.Rule, _ error) {
+	for _, s := range ss {
+		r, err := rule.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := proxies[r.Outbound()]; !ok {
+			return nil, fmt.Errorf("outbound %s not found: %s", r.Outbound(), s)
+		}
+		rules = append(rules, r)
+	}
+	return
+}
@@ -27,16 +27,24 @@ func init() {
 	flag.IntVar(&key.Mark, "fwmark", 0, "Set firewall MARK (Linux only)")
 	flag.IntVar(&key.MTU, "mtu", 0, "Set device maximum transmission unit (MTU)")
 	flag.DurationVar(&key.UDPTimeout, "udp-timeout", 0, "Set timeout for each UDP session")
+	flag.StringVar(&key.ICMPMode, "icmp-mode", "", "Set ICMP echo mode for proxies: fake, drop or tcp-ping")
+	flag.StringVar(&key.UDPNAT, "udp-nat", "", "Set UDP NAT type: symmetric, port-restricted or full-cone")
 	flag.StringVar(&configFile, "config", "", "YAML format configuration file")
 	flag.StringVar(&key.Device, "device", "", "Use this device [driver://]name")
+	flag.StringVar(&key.FakeIPRange, "fake-ip-range", "", "Enable fake-ip DNS with this IPv4 CIDR")
 	flag.StringVar(&key.Interface, "interface", "", "Use network INTERFACE (Linux/MacOS only)")
+	flag.StringVar(&key.IPPreference, "ip-preference", "", "Set IP preference for proxy servers: dual, ipv4, ipv6, ipv4-only or ipv6-only")
 	flag.StringVar(&key.LogLevel, "loglevel", "info", "Log level [debug|info|warning|error|silent]")
 	flag.StringVar(&key.Proxy, "proxy", "", "Use this proxy [protocol://]host[:port]")
+	flag.StringVar(&key.ProxyDNS, "proxy-dns", "", "Resolve proxy servers with this DNS server ip:port")
+	flag.StringVar(&key.UoTProbe, "uot-probe", "", "Probe UDP over TCP with this DNS server ip:port, or proxy-dns if unset")
 	flag.StringVar(&key.RestAPI, "restapi", "", "HTTP statistic server listen address")
 	flag.StringVar(&key.TCPSendBufferSize, "tcp-sndbuf", "", "Set TCP send buffer size for netstack")
 	flag.StringVar(&key.TCPReceiveBufferSize, "tcp-rcvbuf", "", "Set TCP receive buffer size for netstack")
 	flag.BoolVar(&key.TCPModerateReceiveBuffer, "tcp-auto-tuning", false, "Enable TCP receive buffer auto-tuning")
 	flag.StringVar(&key.MulticastGroups, "multicast-groups", "", "Set multicast groups, separated by commas")
+	flag.StringVar(&key.SniffPorts, "sniff-ports", "", "Sniff domains on these ports, e.g. 80,443")
+	flag.DurationVar(&key.SniffTimeout, "sniff-timeout", 0, "Set timeout for waiting client data to sniff")
 	flag.StringVar(&key.TUNPreUp, "tun-pre-up", "", "Execute a command before TUN device setup")
 	flag.StringVar(&key.TUNPostUp, "tun-post-up", "", "Execute a command after TUN device setup")
 	flag.BoolVar(&versionFlag, "version", false, "Show version and then quit")
@@ -14,10 +14,17 @@ type Metadata struct {
 	SrcPort uint16  `json:"sourcePort"`
 	MidPort uint16  `json:"dialerPort"`
 	DstPort uint16  `json:"destinationPort"`
+	Host    string  `json:"host"`
 }
 
+// DestinationAddress returns the destination address, the host
+// is used in preference to the IP if it is available.
 func (m *Metadata) DestinationAddress() string {
-	return net.JoinHostPort(m.DstIP.String(), strconv.FormatUint(uint64(m.DstPort), 10))
+	host := m.DstIP.String()
+	if m.Host != "" {
+		host = m.Host
+	}
+	return net.JoinHostPort(host, strconv.FormatUint(uint64(m.DstPort), 10))
 }
 
 func (m *Metadata) SourceAddress() string {
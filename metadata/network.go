@@ -7,6 +7,7 @@ import (
 const (
 	TCP Network = iota
 	UDP
+	ICMP
 )
 
 type Network uint8
@@ -17,6 +18,8 @@ func (n Network) String() string {
 		return "tcp"
 	case UDP:
 		return "udp"
+	case ICMP:
+		return "icmp"
 	default:
 		return fmt.Sprintf("network(%d)", n)
 	}
@@ -3,8 +3,12 @@ package proxy
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
+	"strconv"
+	"sync"
 
+	"github.com/xjasonlyu/tun2socks/v2/dialer"
 	M "github.com/xjasonlyu/tun2socks/v2/metadata"
 	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
 )
@@ -14,6 +18,16 @@ var _ Proxy = (*Base)(nil)
 type Base struct {
 	addr  string
 	proto proto.Proto
+
+	// dialer is the underlying Dialer to the server, e.g. the previous
+	// hop of Relay, the system dialer is used if nil.
+	dialer Dialer
+
+	// poolOpts enables the connection pool, which is created on the
+	// first dialPooled.
+	poolMu   sync.Mutex
+	poolOpts *PoolOptions
+	pool     *connPool
 }
 
 func (b *Base) Addr() string {
@@ -31,3 +45,137 @@ func (b *Base) DialContext(context.Context, *M.Metadata) (net.Conn, error) {
 func (b *Base) DialUDP(*M.Metadata) (net.PacketConn, error) {
 	return nil, errors.New("not supported")
 }
+
+// Close closes the connection pool if any.
+func (b *Base) Close() error {
+	b.poolMu.Lock()
+	defer b.poolMu.Unlock()
+
+	b.poolOpts = nil
+	if b.pool != nil {
+		b.pool.close()
+	}
+	return nil
+}
+
+func (b *Base) setPool(opts PoolOptions) {
+	b.poolMu.Lock()
+	b.poolOpts = &opts
+	b.poolMu.Unlock()
+}
+
+func (b *Base) poolStats() (PoolStats, bool) {
+	b.poolMu.Lock()
+	defer b.poolMu.Unlock()
+
+	if b.pool != nil {
+		return b.pool.stats(), true
+	}
+	if b.poolOpts != nil {
+		return PoolStats{Size: b.poolOpts.Size}, true
+	}
+	return PoolStats{}, false
+}
+
+// dialPooled takes a connection of dial from the pool if enabled, where
+// dial connects to the server regardless of destination.
+func (b *Base) dialPooled(ctx context.Context, dial func(context.Context) (net.Conn, error)) (net.Conn, error) {
+	b.poolMu.Lock()
+	if b.pool == nil && b.poolOpts != nil {
+		b.pool = newConnPool(dial, *b.poolOpts)
+	}
+	pool := b.pool
+	b.poolMu.Unlock()
+
+	if pool == nil {
+		return dial(ctx)
+	}
+	return pool.get(ctx)
+}
+
+// setUnderlyingDialer sets the underlying Dialer to the server.
+func (b *Base) setUnderlyingDialer(d Dialer) {
+	b.dialer = d
+}
+
+// dialServer connects to address with the underlying Dialer.
+func (b *Base) dialServer(ctx context.Context, network, address string) (net.Conn, error) {
+	if b.dialer == nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	metadata, err := serverMetadata(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return b.dialer.DialContext(ctx, metadata)
+}
+
+// listenServer listens a packet conn with the underlying Dialer, which
+// is used to send packets to address.
+func (b *Base) listenServer(address string) (net.PacketConn, error) {
+	if b.dialer == nil {
+		return dialer.ListenPacket("udp", "")
+	}
+
+	metadata, err := serverMetadata("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return b.dialer.DialUDP(metadata)
+}
+
+// resolveServer returns the UDP address of the server at address, which
+// is resolved by the underlying Dialer if set.
+func (b *Base) resolveServer(address string) (net.Addr, error) {
+	if b.dialer == nil {
+		udpAddr, err := dialer.ResolveUDPAddr(context.Background(), "udp", address)
+		if err != nil {
+			return nil, fmt.Errorf("resolve udp address %s: %w", address, err)
+		}
+		return udpAddr, nil
+	}
+
+	metadata, err := serverMetadata("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	if udpAddr := metadata.UDPAddr(); udpAddr != nil {
+		return udpAddr, nil
+	}
+	return metadata.Addr(), nil
+}
+
+// serverMetadata returns the metadata to the server at address, which
+// is dialed through the underlying Dialer.
+func serverMetadata(network, address string) (*M.Metadata, error) {
+	var n M.Network
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		n = M.TCP
+	case "udp", "udp4", "udp6":
+		n = M.UDP
+	default:
+		return nil, fmt.Errorf("%s is not supported by underlying dialer", network)
+	}
+
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port: %s", portStr)
+	}
+
+	metadata := &M.Metadata{
+		Network: n,
+		DstPort: uint16(port),
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		metadata.DstIP = ip
+	} else {
+		metadata.Host = host
+	}
+	return metadata, nil
+}
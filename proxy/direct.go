@@ -3,6 +3,7 @@ package proxy
 import (
 	"context"
 	"net"
+	"sync"
 
 	"github.com/xjasonlyu/tun2socks/v2/dialer"
 	M "github.com/xjasonlyu/tun2socks/v2/metadata"
@@ -24,7 +25,7 @@ func NewDirect() *Direct {
 }
 
 func (d *Direct) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
-	c, err := dialer.DialContext(ctx, "tcp", metadata.DestinationAddress())
+	c, err := d.dialServer(ctx, "tcp", metadata.DestinationAddress())
 	if err != nil {
 		return nil, err
 	}
@@ -42,6 +43,11 @@ func (d *Direct) DialUDP(*M.Metadata) (net.PacketConn, error) {
 
 type directPacketConn struct {
 	net.PacketConn
+
+	// resolved caches resolved addresses of the session, so that
+	// hosts are not resolved again for each packet.
+	mu       sync.Mutex
+	resolved map[string]*net.UDPAddr
 }
 
 func (pc *directPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
@@ -49,9 +55,29 @@ func (pc *directPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
 		return pc.PacketConn.WriteTo(b, udpAddr)
 	}
 
-	udpAddr, err := net.ResolveUDPAddr("udp", addr.String())
+	udpAddr, err := pc.resolveUDPAddr(addr.String())
 	if err != nil {
 		return 0, err
 	}
 	return pc.PacketConn.WriteTo(b, udpAddr)
 }
+
+func (pc *directPacketConn) resolveUDPAddr(address string) (*net.UDPAddr, error) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if udpAddr, ok := pc.resolved[address]; ok {
+		return udpAddr, nil
+	}
+
+	udpAddr, err := dialer.ResolveUDPAddr(context.Background(), "udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if pc.resolved == nil {
+		pc.resolved = make(map[string]*net.UDPAddr)
+	}
+	pc.resolved[address] = udpAddr
+	return udpAddr, nil
+}
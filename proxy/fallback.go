@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"time"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+)
+
+var _ Group = (*Fallback)(nil)
+
+// Fallback uses the first alive member in order.
+type Fallback struct {
+	*groupBase
+}
+
+func NewFallback(members []Member, url string, interval time.Duration) (*Fallback, error) {
+	g, err := newGroupBase(proto.Fallback, members, url, interval)
+	if err != nil {
+		return nil, err
+	}
+	return &Fallback{groupBase: g}, nil
+}
+
+func (f *Fallback) Addr() string {
+	return f.first().Proxy.Addr()
+}
+
+func (f *Fallback) Now() string {
+	return f.first().Name
+}
+
+func (f *Fallback) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
+	return f.first().Proxy.DialContext(ctx, metadata)
+}
+
+func (f *Fallback) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
+	return f.first().Proxy.DialUDP(metadata)
+}
+
+func (f *Fallback) first() *member {
+	for _, m := range f.members {
+		if m.alive.Load() {
+			return m
+		}
+	}
+	return f.members[0]
+}
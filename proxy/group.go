@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+)
+
+const (
+	defaultHealthCheckURL      = "http://www.gstatic.com/generate_204"
+	defaultHealthCheckInterval = 300 * time.Second
+	healthCheckTimeout         = 5 * time.Second
+)
+
+// Group is a Proxy that dispatches connections to its members.
+type Group interface {
+	Proxy
+
+	// Now returns the name of the member in use, it's empty if
+	// the member is chosen for each connection.
+	Now() string
+
+	// Members returns the states of members in order.
+	Members() []MemberState
+
+	// HealthCheck measures the latency through each member.
+	HealthCheck(context.Context)
+}
+
+// Member is a named Proxy in Group.
+type Member struct {
+	Name  string
+	Proxy Proxy
+}
+
+// MemberState is the health state of Member.
+type MemberState struct {
+	Name      string    `json:"name"`
+	Alive     bool      `json:"alive"`
+	Delay     int64     `json:"delay"` /* milliseconds */
+	LastCheck time.Time `json:"lastCheck"`
+}
+
+type member struct {
+	Member
+
+	alive     *atomic.Bool
+	delay     *atomic.Duration
+	lastCheck *atomic.Time
+}
+
+// groupBase implements the health check shared by groups.
+type groupBase struct {
+	*Base
+
+	url     string
+	members []*member
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newGroupBase(p proto.Proto, members []Member, testURL string, interval time.Duration) (*groupBase, error) {
+	if len(members) == 0 {
+		return nil, errors.New("empty group")
+	}
+	if testURL == "" {
+		testURL = defaultHealthCheckURL
+	}
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+
+	g := &groupBase{
+		Base: &Base{proto: p},
+		url:  testURL,
+		done: make(chan struct{}),
+	}
+	for _, m := range members {
+		g.members = append(g.members, &member{
+			Member: m,
+			// Members are assumed alive before the first check.
+			alive:     atomic.NewBool(true),
+			delay:     atomic.NewDuration(0),
+			lastCheck: atomic.NewTime(time.Time{}),
+		})
+	}
+
+	go g.loop(interval)
+	return g, nil
+}
+
+func (g *groupBase) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// The running health check is cancelled on Close.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-g.done
+		cancel()
+	}()
+
+	for {
+		g.HealthCheck(ctx)
+		select {
+		case <-ticker.C:
+		case <-g.done:
+			return
+		}
+	}
+}
+
+// SupportsMultiDestUDP reports whether all members support it, as the
+// member in use may change.
+func (g *groupBase) SupportsMultiDestUDP() bool {
+	for _, m := range g.members {
+		if !SupportsMultiDestUDP(m.Proxy) {
+			return false
+		}
+	}
+	return true
+}
+
+// Close stops the health check, the members are not closed as they
+// are owned by the caller.
+func (g *groupBase) Close() error {
+	g.closeOnce.Do(func() { close(g.done) })
+	return g.Base.Close()
+}
+
+func (g *groupBase) HealthCheck(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	for _, m := range g.members {
+		wg.Add(1)
+		go func(m *member) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			delay, err := URLDelay(ctx, m.Proxy, g.url)
+			m.alive.Store(err == nil)
+			m.delay.Store(delay)
+			m.lastCheck.Store(time.Now())
+		}(m)
+	}
+	wg.Wait()
+}
+
+func (g *groupBase) Members() []MemberState {
+	states := make([]MemberState, 0, len(g.members))
+	for _, m := range g.members {
+		state := MemberState{
+			Name:      m.Name,
+			Alive:     m.alive.Load(),
+			LastCheck: m.lastCheck.Load(),
+		}
+		if state.Alive {
+			state.Delay = m.delay.Load().Milliseconds()
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// URLDelay measures the latency of an HTTP request to url through
+// Proxy p, the request is sent with HEAD method.
+func URLDelay(ctx context.Context, p Proxy, rawURL string) (time.Duration, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, err
+	}
+
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https":
+			port = "443"
+		case "http":
+			port = "80"
+		default:
+			return 0, errors.New("unsupported scheme: " + u.Scheme)
+		}
+	}
+	dstPort, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return 0, err
+	}
+
+	metadata := &M.Metadata{
+		Network: M.TCP,
+		DstPort: uint16(dstPort),
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		metadata.DstIP = ip
+	} else {
+		metadata.Host = u.Hostname()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return p.DialContext(ctx, metadata)
+			},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return time.Since(start), nil
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+func TestGroup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	members := []Member{
+		{Name: "REJECT", Proxy: NewReject()},
+		{Name: "DIRECT", Proxy: NewDirect()},
+	}
+
+	urlTest, err := NewURLTest(members, server.URL, time.Hour)
+	require.NoError(t, err)
+	defer urlTest.Close()
+	fallback, err := NewFallback(members, server.URL, time.Hour)
+	require.NoError(t, err)
+	defer fallback.Close()
+	loadBalance, err := NewLoadBalance(members, server.URL, time.Hour)
+	require.NoError(t, err)
+	defer loadBalance.Close()
+
+	for _, g := range []Group{urlTest, fallback, loadBalance} {
+		g.HealthCheck(context.Background())
+
+		states := g.Members()
+		if assert.Len(t, states, 2) {
+			assert.False(t, states[0].Alive)
+			assert.True(t, states[1].Alive)
+		}
+	}
+
+	assert.Equal(t, "DIRECT", urlTest.Now())
+	assert.Equal(t, "DIRECT", fallback.Now())
+	assert.Equal(t, "", loadBalance.Now())
+
+	for i := 0; i < 16; i++ {
+		metadata := &M.Metadata{
+			SrcIP: net.IPv4(192, 168, 1, byte(i)),
+			DstIP: net.IPv4(10, 0, 0, byte(i)),
+		}
+		assert.Equal(t, "DIRECT", loadBalance.pick(metadata).Name)
+	}
+}
+
+func TestGroupClose(t *testing.T) {
+	checks := atomic.NewInt32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checks.Inc()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	g, err := NewURLTest([]Member{{Name: "DIRECT", Proxy: NewDirect()}}, server.URL, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return checks.Load() >= 2 }, time.Second, 10*time.Millisecond)
+
+	// The health check stops after Close.
+	require.NoError(t, g.Close())
+	time.Sleep(20 * time.Millisecond)
+	n := checks.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, n, checks.Load())
+}
+
+func TestJumpHash(t *testing.T) {
+	for key := uint64(0); key < 1000; key++ {
+		b := jumpHash(key, 5)
+		assert.True(t, b >= 0 && b < 5)
+		// Growing buckets only moves keys to the new bucket.
+		if c := jumpHash(key, 6); c != b {
+			assert.Equal(t, 5, c)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package proxy
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -10,10 +11,11 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"time"
 
-	"github.com/xjasonlyu/tun2socks/v2/dialer"
 	M "github.com/xjasonlyu/tun2socks/v2/metadata"
 	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+	"github.com/xjasonlyu/tun2socks/v2/transport/masque"
 )
 
 type HTTP struct {
@@ -21,30 +23,121 @@ type HTTP struct {
 
 	user string
 	pass string
+
+	// tlsConfig is the TLS config of HTTPS proxy, nil if disabled.
+	tlsConfig *tls.Config
 }
 
-func NewHTTP(addr, user, pass string) (*HTTP, error) {
+// NewHTTP returns an HTTP proxy, which is HTTPS if tlsOpts is not nil.
+func NewHTTP(addr, user, pass string, tlsOpts *TLSOptions) (*HTTP, error) {
+	var tlsConfig *tls.Config
+	if tlsOpts != nil {
+		var err error
+		if tlsConfig, err = newTLSConfig(addr, tlsOpts); err != nil {
+			return nil, fmt.Errorf("http initialize: %w", err)
+		}
+	}
+
 	return &HTTP{
 		Base: &Base{
 			addr:  addr,
 			proto: proto.HTTP,
 		},
-		user: user,
-		pass: pass,
+		user:      user,
+		pass:      pass,
+		tlsConfig: tlsConfig,
 	}, nil
 }
 
-func (h *HTTP) DialContext(ctx context.Context, metadata *M.Metadata) (c net.Conn, err error) {
-	c, err = dialer.DialContext(ctx, "tcp", h.Addr())
+// dialHTTP connects to the HTTP proxy, and wraps the connection in TLS
+// with config if it's not nil.
+func (h *HTTP) dialHTTP(ctx context.Context, config *tls.Config) (net.Conn, error) {
+	c, err := h.dialServer(ctx, "tcp", h.Addr())
 	if err != nil {
 		return nil, fmt.Errorf("connect to %s: %w", h.Addr(), err)
 	}
 	setKeepAlive(c)
 
-	defer safeConnClose(c, err)
+	if config != nil {
+		tc, err := tlsHandshake(ctx, c, config)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c = tc
+	}
+	return c, nil
+}
+
+func (h *HTTP) DialContext(ctx context.Context, metadata *M.Metadata) (c net.Conn, err error) {
+	c, err = h.dialPooled(ctx, func(ctx context.Context) (net.Conn, error) {
+		return h.dialHTTP(ctx, h.tlsConfig)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+	if err = h.shakeHand(metadata, c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// SupportsMultiDestUDP returns false, as CONNECT-UDP is bound to the
+// target at dial.
+func (h *HTTP) SupportsMultiDestUDP() bool {
+	return false
+}
+
+// DialUDP proxies UDP with CONNECT-UDP, which is over HTTP/2 extended
+// CONNECT if h2 is negotiated with HTTPS proxy, otherwise over HTTP/1.1
+// upgrade.
+func (h *HTTP) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TCPConnectTimeout)
+	defer cancel()
+
+	var config *tls.Config
+	if h.tlsConfig != nil {
+		config = h.tlsConfig.Clone()
+		config.NextProtos = []string{"h2", "http/1.1"}
+	}
+
+	c, err := h.dialHTTP(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &masque.Request{
+		Authority: h.Addr(),
+		Target:    metadata.DestinationAddress(),
+		Header:    http.Header{},
+	}
+	if h.user != "" && h.pass != "" {
+		req.Header.Set("Proxy-Authorization", fmt.Sprintf("Basic %s", basicAuth(h.user, h.pass)))
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+
+	var mc net.Conn
+	if tc, ok := c.(*tls.Conn); ok && tc.ConnectionState().NegotiatedProtocol == "h2" {
+		mc, err = masque.ClientHandshakeH2(c, req)
+	} else {
+		mc, err = masque.ClientHandshake(c, req)
+	}
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("connect-udp: %w", err)
+	}
+	c.SetDeadline(time.Time{})
 
-	err = h.shakeHand(metadata, c)
-	return
+	return newStreamPacketConn(mc, metadata, masque.WriteDatagram, masque.ReadDatagram), nil
 }
 
 func (h *HTTP) shakeHand(metadata *M.Metadata, rw io.ReadWriter) error {
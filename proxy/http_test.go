@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/transport/masque"
+)
+
+func TestHTTPConnectUDP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	// A CONNECT-UDP proxy over HTTP/1.1 upgrade, which echoes the
+	// datagrams back.
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+
+				r := bufio.NewReader(c)
+				req, err := http.ReadRequest(r)
+				if err != nil {
+					return
+				}
+				if req.URL.Path != "/.well-known/masque/udp/1.1.1.1/53/" ||
+					req.Header.Get("Proxy-Authorization") != "Basic "+basicAuth("user", "pass") {
+					io.WriteString(c, "HTTP/1.1 403 Forbidden\r\n\r\n")
+					return
+				}
+				io.WriteString(c, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: connect-udp\r\n\r\n")
+
+				payload := make([]byte, 1024)
+				for {
+					n, err := masque.ReadDatagram(r, payload)
+					if err != nil {
+						return
+					}
+					if _, err = masque.WriteDatagram(c, payload[:n]); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	p, err := NewHTTP(ln.Addr().String(), "user", "pass", nil)
+	require.NoError(t, err)
+
+	metadata := &M.Metadata{Network: M.UDP, DstIP: net.IPv4(1, 1, 1, 1), DstPort: 53}
+	pc, err := p.DialUDP(metadata)
+	require.NoError(t, err)
+	defer pc.Close()
+
+	to := metadata.UDPAddr()
+	_, err = pc.WriteTo([]byte("query"), to)
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	n, from, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "query", string(buf[:n]))
+	assert.Equal(t, to.String(), from.String())
+
+	p, err = NewHTTP(ln.Addr().String(), "user", "wrong", nil)
+	require.NoError(t, err)
+	_, err = p.DialUDP(metadata)
+	assert.Error(t, err)
+}
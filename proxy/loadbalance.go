@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"hash/fnv"
+	"net"
+	"time"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+)
+
+var _ Group = (*LoadBalance)(nil)
+
+// LoadBalance spreads connections across alive members by consistent
+// hashing on source IP and destination host, so that connections from
+// the same source to the same destination use the same member.
+type LoadBalance struct {
+	*groupBase
+}
+
+func NewLoadBalance(members []Member, url string, interval time.Duration) (*LoadBalance, error) {
+	g, err := newGroupBase(proto.LoadBalance, members, url, interval)
+	if err != nil {
+		return nil, err
+	}
+	return &LoadBalance{groupBase: g}, nil
+}
+
+func (lb *LoadBalance) Now() string {
+	return ""
+}
+
+func (lb *LoadBalance) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
+	return lb.pick(metadata).Proxy.DialContext(ctx, metadata)
+}
+
+func (lb *LoadBalance) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
+	return lb.pick(metadata).Proxy.DialUDP(metadata)
+}
+
+func (lb *LoadBalance) pick(metadata *M.Metadata) *member {
+	host := metadata.Host
+	if host == "" {
+		host = metadata.DstIP.String()
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(metadata.SrcIP.String()))
+	h.Write([]byte{0})
+	h.Write([]byte(host))
+	key := h.Sum64()
+
+	// Rehash on dead members, which moves only the connections
+	// of dead members to others.
+	for i := 0; i < len(lb.members); i++ {
+		m := lb.members[jumpHash(key, len(lb.members))]
+		if m.alive.Load() {
+			return m
+		}
+		key++
+	}
+
+	for _, m := range lb.members {
+		if m.alive.Load() {
+			return m
+		}
+	}
+	return lb.members[0]
+}
+
+// jumpHash is the jump consistent hash algorithm by Lamping and Veach.
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/transport/mux"
+)
+
+var _ Proxy = (*Mux)(nil)
+
+// Mux multiplexes the TCP connections of Proxy over a few connections
+// to mux.MagicAddress through it with sing-mux, which saves the round
+// trips of connecting to the proxy server. UDP is relayed by Proxy as
+// usual.
+type Mux struct {
+	Proxy
+
+	pool *mux.Pool
+}
+
+func NewMux(p Proxy, config mux.PoolConfig) *Mux {
+	dial := func(ctx context.Context) (net.Conn, error) {
+		return p.DialContext(ctx, &M.Metadata{Network: M.TCP, Host: mux.MagicAddress, DstPort: mux.MagicPort})
+	}
+	return &Mux{
+		Proxy: p,
+		pool:  mux.NewPool(dial, config),
+	}
+}
+
+func (m *Mux) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
+	return m.pool.DialContext(ctx, serializeSocksAddr(metadata))
+}
+
+// SupportsMultiDestUDP reports whether Proxy supports it, which relays
+// UDP.
+func (m *Mux) SupportsMultiDestUDP() bool {
+	return SupportsMultiDestUDP(m.Proxy)
+}
+
+// Close closes the mux sessions and the Proxy if it's io.Closer.
+func (m *Mux) Close() error {
+	err := m.pool.Close()
+	if c, ok := m.Proxy.(io.Closer); ok {
+		err = errors.Join(err, c.Close())
+	}
+	return err
+}
@@ -0,0 +1,289 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+
+	"github.com/xjasonlyu/tun2socks/v2/log"
+	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+)
+
+const (
+	defaultPoolIdleTimeout   = 30 * time.Second
+	defaultPoolProbeInterval = 10 * time.Second
+
+	// poolProbeTimeout is how long an idle connection is read to check
+	// whether it's closed by the server.
+	poolProbeTimeout = time.Millisecond
+)
+
+// PoolOptions is the options of the pre-warmed connection pool, which
+// keeps the connections to the server connected (and TLS handshaked)
+// before the destinations are known.
+type PoolOptions struct {
+	// Size is the number of idle connections kept.
+	Size int
+
+	// IdleTimeout is how long a connection is kept idle.
+	IdleTimeout time.Duration
+
+	// ProbeInterval is the interval to check whether the idle
+	// connections are closed by the server.
+	ProbeInterval time.Duration
+}
+
+// PoolStats is the statistics of connection pool.
+type PoolStats struct {
+	Size   int    `json:"size"`
+	Idle   int    `json:"idle"`
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// EnablePool enables the connection pool of p, which supports HTTP and
+// the protocols over stream transport. The pool is filled on the first
+// dial, after which each dial takes an idle connection if any.
+func EnablePool(p Proxy, opts PoolOptions) error {
+	switch p.Proto() {
+	case proto.HTTP, proto.Socks5, proto.Shadowsocks, proto.Trojan, proto.VLESS, proto.VMess:
+	default:
+		return fmt.Errorf("%s does not support connection pool", p.Proto())
+	}
+	if opts.Size <= 0 {
+		return errors.New("invalid pool size")
+	}
+
+	b, ok := p.(interface{ setPool(PoolOptions) })
+	if !ok {
+		return fmt.Errorf("%s does not support connection pool", p.Proto())
+	}
+	b.setPool(opts)
+	return nil
+}
+
+// PoolStatsOf returns the pool statistics of p, false if the pool is
+// not enabled.
+func PoolStatsOf(p Proxy) (PoolStats, bool) {
+	if m, ok := p.(*Mux); ok {
+		p = m.Proxy
+	}
+	if b, ok := p.(interface{ poolStats() (PoolStats, bool) }); ok {
+		return b.poolStats()
+	}
+	return PoolStats{}, false
+}
+
+type idleConn struct {
+	net.Conn
+	since time.Time
+}
+
+// connPool keeps idle connections of dial, which are taken by get.
+type connPool struct {
+	dial func(context.Context) (net.Conn, error)
+	opts PoolOptions
+
+	mu      sync.Mutex
+	idle    []idleConn
+	filling bool
+	closed  bool
+
+	hits   *atomic.Uint64
+	misses *atomic.Uint64
+
+	done chan struct{}
+}
+
+func newConnPool(dial func(context.Context) (net.Conn, error), opts PoolOptions) *connPool {
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = defaultPoolIdleTimeout
+	}
+	if opts.ProbeInterval <= 0 {
+		opts.ProbeInterval = defaultPoolProbeInterval
+	}
+
+	p := &connPool{
+		dial:   dial,
+		opts:   opts,
+		hits:   atomic.NewUint64(0),
+		misses: atomic.NewUint64(0),
+		done:   make(chan struct{}),
+	}
+	go p.probeLoop()
+	return p
+}
+
+// get takes the most recent idle connection, or dials if none, and
+// refills the pool in the background.
+func (p *connPool) get(ctx context.Context) (net.Conn, error) {
+	p.mu.Lock()
+	p.evictLocked(time.Now())
+
+	var c net.Conn
+	if n := len(p.idle); n > 0 {
+		c = p.idle[n-1].Conn
+		p.idle = p.idle[:n-1]
+	}
+	p.mu.Unlock()
+
+	p.fill()
+	if c != nil {
+		p.hits.Inc()
+		return c, nil
+	}
+	p.misses.Inc()
+	return p.dial(ctx)
+}
+
+// fill dials until the pool is full in the background, and stops on
+// error until the next get.
+func (p *connPool) fill() {
+	p.mu.Lock()
+	if p.filling || p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.filling = true
+	p.mu.Unlock()
+
+	go func() {
+		defer func() {
+			p.mu.Lock()
+			p.filling = false
+			p.mu.Unlock()
+		}()
+
+		for {
+			p.mu.Lock()
+			full := p.closed || len(p.idle) >= p.opts.Size
+			p.mu.Unlock()
+			if full {
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), TCPConnectTimeout)
+			c, err := p.dial(ctx)
+			cancel()
+			if err != nil {
+				log.Debugf("[POOL] failed to dial: %v", err)
+				return
+			}
+
+			p.mu.Lock()
+			if p.closed {
+				p.mu.Unlock()
+				c.Close()
+				return
+			}
+			p.idle = append(p.idle, idleConn{Conn: c, since: time.Now()})
+			p.mu.Unlock()
+		}
+	}()
+}
+
+// evictLocked closes the connections idle for longer than IdleTimeout,
+// p.mu must be held.
+func (p *connPool) evictLocked(now time.Time) {
+	idle := p.idle[:0]
+	for _, c := range p.idle {
+		if now.Sub(c.since) > p.opts.IdleTimeout {
+			c.Close()
+			continue
+		}
+		idle = append(idle, c)
+	}
+	p.idle = idle
+}
+
+func (p *connPool) probeLoop() {
+	ticker := time.NewTicker(p.opts.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.probe()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// probe closes the idle connections closed by the server, which are
+// taken out of the pool during probing.
+func (p *connPool) probe() {
+	p.mu.Lock()
+	p.evictLocked(time.Now())
+	conns := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	alive := conns[:0]
+	for _, c := range conns {
+		if isConnAlive(c.Conn) {
+			alive = append(alive, c)
+		} else {
+			c.Close()
+		}
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		for _, c := range alive {
+			c.Close()
+		}
+		return
+	}
+	// The connections added meanwhile are more recent.
+	p.idle = append(alive, p.idle...)
+	p.mu.Unlock()
+}
+
+// isConnAlive reads c briefly, the connection is alive if the read
+// times out, rather than gets EOF or unexpected data.
+func isConnAlive(c net.Conn) bool {
+	c.SetReadDeadline(time.Now().Add(poolProbeTimeout))
+	defer c.SetReadDeadline(time.Time{})
+
+	var b [1]byte
+	_, err := c.Read(b[:])
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (p *connPool) stats() PoolStats {
+	p.mu.Lock()
+	idle := len(p.idle)
+	p.mu.Unlock()
+
+	return PoolStats{
+		Size:   p.opts.Size,
+		Idle:   idle,
+		Hits:   p.hits.Load(),
+		Misses: p.misses.Load(),
+	}
+}
+
+func (p *connPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.done)
+
+	for _, c := range p.idle {
+		c.Close()
+	}
+	p.idle = nil
+}
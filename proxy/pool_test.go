@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+func TestPool(t *testing.T) {
+	ln := serveTrojan(t, "password")
+	defer ln.Close()
+
+	p, err := NewTrojan(ln.Addr().String(), "password", StreamOptions{TLS: &TLSOptions{SkipVerify: true}})
+	require.NoError(t, err)
+	defer p.Close()
+	require.NoError(t, EnablePool(p, PoolOptions{Size: 2}))
+
+	stats, ok := PoolStatsOf(p)
+	require.True(t, ok)
+	assert.Equal(t, PoolStats{Size: 2}, stats)
+
+	metadata := &M.Metadata{Host: "example.com", DstPort: 80}
+	for i := 0; i < 2; i++ {
+		c, err := p.DialContext(context.Background(), metadata)
+		require.NoError(t, err)
+
+		_, err = c.Write([]byte("hello"))
+		require.NoError(t, err)
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(c, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(buf))
+		c.Close()
+
+		// The pool is filled after the first dial.
+		assert.Eventually(t, func() bool {
+			stats, _ := PoolStatsOf(p)
+			return stats.Idle == 2
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	stats, _ = PoolStatsOf(p)
+	assert.Equal(t, PoolStats{Size: 2, Idle: 2, Hits: 1, Misses: 1}, stats)
+
+	assert.Error(t, EnablePool(NewDirect(), PoolOptions{Size: 2}))
+}
+
+func TestPoolEvict(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	var (
+		mu    sync.Mutex
+		conns []net.Conn
+	)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, c)
+			mu.Unlock()
+		}
+	}()
+
+	dial := func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", ln.Addr().String())
+	}
+	idle := func(pool *connPool) func() bool {
+		return func() bool { return pool.stats().Idle == 2 }
+	}
+
+	// The connections closed by the server are evicted by probing.
+	pool := newConnPool(dial, PoolOptions{Size: 2, ProbeInterval: 10 * time.Millisecond})
+	defer pool.close()
+	pool.fill()
+	require.Eventually(t, idle(pool), time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	for _, c := range conns {
+		c.Close()
+	}
+	mu.Unlock()
+	assert.Eventually(t, func() bool { return pool.stats().Idle == 0 }, time.Second, 10*time.Millisecond)
+
+	// The connections idle for too long are evicted on get.
+	pool = newConnPool(dial, PoolOptions{Size: 2, IdleTimeout: 50 * time.Millisecond})
+	defer pool.close()
+	pool.fill()
+	require.Eventually(t, idle(pool), time.Second, 10*time.Millisecond)
+
+	time.Sleep(100 * time.Millisecond)
+	c, err := pool.get(context.Background())
+	require.NoError(t, err)
+	c.Close()
+	assert.Equal(t, uint64(0), pool.stats().Hits)
+	assert.Equal(t, uint64(1), pool.stats().Misses)
+}
@@ -9,6 +9,15 @@ const (
 	Socks4
 	Socks5
 	Shadowsocks
+	Trojan
+	VLESS
+	VMess
+	WireGuard
+	SSH
+	URLTest
+	Fallback
+	LoadBalance
+	Relay
 )
 
 type Proto uint8
@@ -27,6 +36,24 @@ func (proto Proto) String() string {
 		return "socks5"
 	case Shadowsocks:
 		return "ss"
+	case Trojan:
+		return "trojan"
+	case VLESS:
+		return "vless"
+	case VMess:
+		return "vmess"
+	case WireGuard:
+		return "wireguard"
+	case SSH:
+		return "ssh"
+	case URLTest:
+		return "url-test"
+	case Fallback:
+		return "fallback"
+	case LoadBalance:
+		return "load-balance"
+	case Relay:
+		return "relay"
 	default:
 		return fmt.Sprintf("proto(%d)", proto)
 	}
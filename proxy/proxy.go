@@ -6,15 +6,22 @@ import (
 	"net"
 	"time"
 
+	"go.uber.org/atomic"
+
 	M "github.com/xjasonlyu/tun2socks/v2/metadata"
 	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
 )
 
-const (
-	tcpConnectTimeout = 5 * time.Second
-)
+// TCPConnectTimeout is the default timeout for TCP dialing.
+const TCPConnectTimeout = 5 * time.Second
 
-var _defaultDialer Dialer = &Base{}
+// _defaultDialer is replaced atomically, so that it's safe to
+// be switched at runtime while dialing.
+var _defaultDialer atomic.Pointer[Dialer]
+
+func init() {
+	SetDialer(&Base{})
+}
 
 type Dialer interface {
 	DialContext(context.Context, *M.Metadata) (net.Conn, error)
@@ -27,24 +34,39 @@ type Proxy interface {
 	Proto() proto.Proto
 }
 
+// SupportsMultiDestUDP reports whether the packet conns of d can send to
+// any destination, so that one may be shared by the flows of cone NAT.
+// It's true unless d tells otherwise with SupportsMultiDestUDP() bool.
+func SupportsMultiDestUDP(d Dialer) bool {
+	if s, ok := d.(interface{ SupportsMultiDestUDP() bool }); ok {
+		return s.SupportsMultiDestUDP()
+	}
+	return true
+}
+
 // SetDialer sets default Dialer.
 func SetDialer(d Dialer) {
-	_defaultDialer = d
+	_defaultDialer.Store(&d)
+}
+
+// DefaultDialer returns default Dialer.
+func DefaultDialer() Dialer {
+	return *_defaultDialer.Load()
 }
 
 // Dial uses default Dialer to dial TCP.
 func Dial(metadata *M.Metadata) (net.Conn, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), tcpConnectTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), TCPConnectTimeout)
 	defer cancel()
-	return _defaultDialer.DialContext(ctx, metadata)
+	return DefaultDialer().DialContext(ctx, metadata)
 }
 
 // DialContext uses default Dialer to dial TCP with context.
 func DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
-	return _defaultDialer.DialContext(ctx, metadata)
+	return DefaultDialer().DialContext(ctx, metadata)
 }
 
 // DialUDP uses default Dialer to dial UDP.
 func DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
-	return _defaultDialer.DialUDP(metadata)
+	return DefaultDialer().DialUDP(metadata)
 }
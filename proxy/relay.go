@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+)
+
+var _ Proxy = (*Relay)(nil)
+
+// chainable is implemented by the proxies embedding Base, whose server
+// is connected through the underlying Dialer.
+type chainable interface {
+	Proxy
+	setUnderlyingDialer(Dialer)
+}
+
+// Relay chains proxies in order, where each hop connects to its server
+// through the previous hop, and the last hop connects to the destination.
+type Relay struct {
+	*Base
+
+	hops []Proxy
+}
+
+// NewRelay returns Relay over hops, which are modified to dial through
+// the previous hop and must not be used elsewhere, except the first.
+func NewRelay(hops []Proxy) (*Relay, error) {
+	if len(hops) == 0 {
+		return nil, errors.New("empty relay")
+	}
+
+	for i := 1; i < len(hops); i++ {
+		// Groups dial through their members, so they can only be the first hop.
+		c, ok := hops[i].(chainable)
+		if _, isGroup := hops[i].(Group); !ok || isGroup {
+			return nil, fmt.Errorf("%s %s cannot be chained", hops[i].Proto(), hops[i].Addr())
+		}
+		c.setUnderlyingDialer(hops[i-1])
+	}
+
+	last := hops[len(hops)-1]
+	return &Relay{
+		Base: &Base{
+			addr:  last.Addr(),
+			proto: proto.Relay,
+		},
+		hops: hops,
+	}, nil
+}
+
+// Close closes the hops other than the first, which are owned by Relay.
+func (r *Relay) Close() error {
+	var errs []error
+	for _, hop := range r.hops[1:] {
+		if c, ok := hop.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Relay) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
+	return r.hops[len(r.hops)-1].DialContext(ctx, metadata)
+}
+
+func (r *Relay) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
+	return r.hops[len(r.hops)-1].DialUDP(metadata)
+}
+
+// SupportsMultiDestUDP reports whether the last hop supports it.
+func (r *Relay) SupportsMultiDestUDP() bool {
+	return SupportsMultiDestUDP(r.hops[len(r.hops)-1])
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+// serveHTTPConnect runs an HTTP proxy handling CONNECT only.
+func serveHTTPConnect(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+
+				r := bufio.NewReader(c)
+				req, err := http.ReadRequest(r)
+				if err != nil || req.Method != http.MethodConnect {
+					return
+				}
+				rc, err := net.Dial("tcp", req.Host)
+				if err != nil {
+					io.WriteString(c, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer rc.Close()
+
+				io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go io.Copy(rc, r)
+				io.Copy(c, rc)
+			}()
+		}
+	}()
+	return ln
+}
+
+func TestRelay(t *testing.T) {
+	httpLn := serveHTTPConnect(t)
+	defer httpLn.Close()
+	trojanLn := serveTrojan(t, "password")
+	defer trojanLn.Close()
+
+	first, err := NewHTTP(httpLn.Addr().String(), "", "", nil)
+	require.NoError(t, err)
+	second, err := NewTrojan(trojanLn.Addr().String(), "password", StreamOptions{TLS: &TLSOptions{SkipVerify: true}})
+	require.NoError(t, err)
+
+	r, err := NewRelay([]Proxy{first, second})
+	require.NoError(t, err)
+	assert.Equal(t, trojanLn.Addr().String(), r.Addr())
+
+	metadata := &M.Metadata{Host: "example.com", DstPort: 80}
+
+	c, err := r.DialContext(context.Background(), metadata)
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	// UDP of Trojan is over the stream through the HTTP proxy.
+	pc, err := r.DialUDP(metadata)
+	require.NoError(t, err)
+	defer pc.Close()
+
+	to := &net.UDPAddr{IP: net.IPv4(1, 1, 1, 1), Port: 53}
+	_, err = pc.WriteTo([]byte("query"), to)
+	require.NoError(t, err)
+	n, from, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "query", string(buf[:n]))
+	assert.Equal(t, to.String(), from.String())
+
+	// CONNECT-UDP is not supported by the HTTP proxy.
+	first, err = NewHTTP(httpLn.Addr().String(), "", "", nil)
+	require.NoError(t, err)
+	r, err = NewRelay([]Proxy{NewDirect(), first})
+	require.NoError(t, err)
+	_, err = r.DialUDP(metadata)
+	assert.Error(t, err)
+}
+
+func TestRelayGroup(t *testing.T) {
+	g, err := NewFallback([]Member{{Name: "direct", Proxy: NewDirect()}}, "", 0)
+	require.NoError(t, err)
+
+	_, err = NewRelay([]Proxy{g, NewDirect()})
+	assert.NoError(t, err)
+	_, err = NewRelay([]Proxy{NewDirect(), g})
+	assert.Error(t, err)
+}
@@ -8,11 +8,13 @@ import (
 
 	"github.com/Dreamacro/go-shadowsocks2/core"
 
-	"github.com/xjasonlyu/tun2socks/v2/dialer"
 	M "github.com/xjasonlyu/tun2socks/v2/metadata"
 	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
 	obfs "github.com/xjasonlyu/tun2socks/v2/transport/simple-obfs"
+	"github.com/xjasonlyu/tun2socks/v2/transport/sip003"
 	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+	"github.com/xjasonlyu/tun2socks/v2/transport/ss2022"
+	"github.com/xjasonlyu/tun2socks/v2/transport/uot"
 )
 
 var _ Proxy = (*Shadowsocks)(nil)
@@ -24,31 +26,98 @@ type Shadowsocks struct {
 
 	// simple-obfs plugin
 	obfsMode, obfsHost string
+
+	// plugin is the SIP003 plugin relaying the streams, if any.
+	plugin *sip003.Plugin
+
+	stream *streamDialer
+
+	uot uotSelector
+}
+
+// ShadowsocksOptions is the transport, plugin and UDP settings of
+// Shadowsocks.
+type ShadowsocksOptions struct {
+	// ObfsMode and ObfsHost are the settings of built-in simple-obfs.
+	ObfsMode, ObfsHost string
+
+	// Plugin is the SIP003 plugin executable, which is started with
+	// PluginOpts as SS_PLUGIN_OPTIONS.
+	Plugin, PluginOpts string
+
+	// Stream is the transport to the server, e.g. WebSocket, which is
+	// not used with Plugin.
+	Stream StreamOptions
+
+	UoT UoT
 }
 
-func NewShadowsocks(addr, method, password, obfsMode, obfsHost string) (*Shadowsocks, error) {
-	cipher, err := core.PickCipher(method, nil, password)
+func NewShadowsocks(addr, method, password string, opts ShadowsocksOptions) (*Shadowsocks, error) {
+	var (
+		cipher core.Cipher
+		err    error
+	)
+	if ss2022.IsMethod(method) {
+		cipher, err = ss2022.NewCipher(method, password)
+	} else {
+		cipher, err = core.PickCipher(method, nil, password)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("ss initialize: %w", err)
 	}
 
+	base := &Base{
+		addr:  addr,
+		proto: proto.Shadowsocks,
+	}
+
+	stream, err := newStreamDialer(base, &opts.Stream)
+	if err != nil {
+		return nil, fmt.Errorf("ss initialize: %w", err)
+	}
+
+	var plugin *sip003.Plugin
+	if opts.Plugin != "" {
+		if plugin, err = sip003.Start(opts.Plugin, opts.PluginOpts, addr); err != nil {
+			return nil, fmt.Errorf("ss initialize: %w", err)
+		}
+	}
+
 	return &Shadowsocks{
-		Base: &Base{
-			addr:  addr,
-			proto: proto.Shadowsocks,
-		},
+		Base:     base,
 		cipher:   cipher,
-		obfsMode: obfsMode,
-		obfsHost: obfsHost,
+		obfsMode: opts.ObfsMode,
+		obfsHost: opts.ObfsHost,
+		plugin:   plugin,
+		stream:   stream,
+		uot:      uotSelector{mode: opts.UoT},
 	}, nil
 }
 
-func (ss *Shadowsocks) DialContext(ctx context.Context, metadata *M.Metadata) (c net.Conn, err error) {
-	c, err = dialer.DialContext(ctx, "tcp", ss.Addr())
-	if err != nil {
-		return nil, fmt.Errorf("connect to %s: %w", ss.Addr(), err)
+// Close stops the SIP003 plugin and the connection pool if any.
+func (ss *Shadowsocks) Close() error {
+	err := ss.Base.Close()
+	if ss.plugin != nil {
+		err = errors.Join(err, ss.plugin.Close())
+	}
+	return err
+}
+
+func (ss *Shadowsocks) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
+	return ss.dialStream(ctx, serializeSocksAddr(metadata))
+}
+
+// dialStream connects to addr over the shadowsocks stream.
+func (ss *Shadowsocks) dialStream(ctx context.Context, addr socks5.Addr) (c net.Conn, err error) {
+	if ss.plugin != nil {
+		c, err = ss.dialPlugin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("connect to %s: %w", ss.Addr(), err)
+		}
+		setKeepAlive(c)
+	} else if c, err = ss.stream.DialContext(ctx); err != nil {
+		return nil, err
 	}
-	setKeepAlive(c)
 
 	defer safeConnClose(c, err)
 
@@ -61,23 +130,56 @@ func (ss *Shadowsocks) DialContext(ctx context.Context, metadata *M.Metadata) (c
 	}
 
 	c = ss.cipher.StreamConn(c)
-	_, err = c.Write(serializeSocksAddr(metadata))
+	_, err = c.Write(addr)
 	return
 }
 
-func (ss *Shadowsocks) DialUDP(*M.Metadata) (net.PacketConn, error) {
-	pc, err := dialer.ListenPacket("udp", "")
+// dialPlugin connects to the local port of plugin, which connects to
+// the server itself, so that it can't be chained.
+func (ss *Shadowsocks) dialPlugin(ctx context.Context) (net.Conn, error) {
+	if ss.dialer != nil {
+		return nil, errors.New("sip003 plugin cannot be chained")
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", ss.plugin.LocalAddr())
+}
+
+func (ss *Shadowsocks) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
+	return ss.uot.dialUDP(ss.dialUDP, func() (net.PacketConn, error) {
+		return ss.dialUoT(metadata)
+	})
+}
+
+// dialUoT relays UDP over the stream to the UDP-over-TCP magic address.
+func (ss *Shadowsocks) dialUoT(metadata *M.Metadata) (net.PacketConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TCPConnectTimeout)
+	defer cancel()
+
+	c, err := ss.dialStream(ctx, uot.MagicAddr())
 	if err != nil {
-		return nil, fmt.Errorf("listen packet: %w", err)
+		return nil, err
 	}
 
-	udpAddr, err := net.ResolveUDPAddr("udp", ss.Addr())
+	if err = uot.WriteRequest(c, false, serializeSocksAddr(metadata)); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("write request: %w", err)
+	}
+	return newUoTPacketConn(c), nil
+}
+
+func (ss *Shadowsocks) dialUDP() (net.PacketConn, error) {
+	rAddr, err := ss.resolveServer(ss.Addr())
 	if err != nil {
-		return nil, fmt.Errorf("resolve udp address %s: %w", ss.Addr(), err)
+		return nil, err
+	}
+
+	pc, err := ss.listenServer(ss.Addr())
+	if err != nil {
+		return nil, fmt.Errorf("listen packet: %w", err)
 	}
 
 	pc = ss.cipher.PacketConn(pc)
-	return &ssPacketConn{PacketConn: pc, rAddr: udpAddr}, nil
+	return &ssPacketConn{PacketConn: pc, rAddr: rAddr}, nil
 }
 
 type ssPacketConn struct {
@@ -6,11 +6,12 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 
-	"github.com/xjasonlyu/tun2socks/v2/dialer"
 	M "github.com/xjasonlyu/tun2socks/v2/metadata"
 	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
 	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+	"github.com/xjasonlyu/tun2socks/v2/transport/uot"
 )
 
 var _ Proxy = (*Socks5)(nil)
@@ -23,60 +24,109 @@ type Socks5 struct {
 
 	// unix indicates if socks5 over UDS is enabled.
 	unix bool
+
+	// stream is the transport of socks5, e.g. over TLS or WebSocket.
+	stream *streamDialer
+
+	uot uotSelector
 }
 
-func NewSocks5(addr, user, pass string) (*Socks5, error) {
+// NewSocks5 returns a socks5 proxy over the stream transport of opts.
+// The UDP packets are relayed in plaintext as usual, or over TCP
+// according to uotMode.
+func NewSocks5(addr, user, pass string, opts StreamOptions, uotMode UoT) (*Socks5, error) {
+	base := &Base{
+		addr:  addr,
+		proto: proto.Socks5,
+	}
+
+	stream, err := newStreamDialer(base, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("socks5 initialize: %w", err)
+	}
+
+	unix := len(addr) > 0 && addr[0] == '/'
+	if unix {
+		stream.network = "unix"
+	}
+
 	return &Socks5{
-		Base: &Base{
-			addr:  addr,
-			proto: proto.Socks5,
-		},
-		user: user,
-		pass: pass,
-		unix: len(addr) > 0 && addr[0] == '/',
+		Base:   base,
+		user:   user,
+		pass:   pass,
+		unix:   unix,
+		stream: stream,
+		uot:    uotSelector{mode: uotMode},
 	}, nil
 }
 
-func (ss *Socks5) DialContext(ctx context.Context, metadata *M.Metadata) (c net.Conn, err error) {
-	network := "tcp"
-	if ss.unix {
-		network = "unix"
-	}
+// dialSocks5 connects to the socks5 server over the stream transport.
+func (ss *Socks5) dialSocks5(ctx context.Context) (net.Conn, error) {
+	return ss.stream.DialContext(ctx)
+}
 
-	c, err = dialer.DialContext(ctx, network, ss.Addr())
+func (ss *Socks5) DialContext(ctx context.Context, metadata *M.Metadata) (c net.Conn, err error) {
+	c, err = ss.dialSocks5(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("connect to %s: %w", ss.Addr(), err)
+		return nil, err
 	}
-	setKeepAlive(c)
 
 	defer safeConnClose(c, err)
 
-	var user *socks5.User
-	if ss.user != "" {
-		user = &socks5.User{
-			Username: ss.user,
-			Password: ss.pass,
-		}
+	_, err = socks5.ClientHandshake(c, serializeSocksAddr(metadata), socks5.CmdConnect, ss.socksUser())
+	return
+}
+
+func (ss *Socks5) socksUser() *socks5.User {
+	if ss.user == "" {
+		return nil
 	}
+	return &socks5.User{
+		Username: ss.user,
+		Password: ss.pass,
+	}
+}
 
-	_, err = socks5.ClientHandshake(c, serializeSocksAddr(metadata), socks5.CmdConnect, user)
-	return
+func (ss *Socks5) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
+	return ss.uot.dialUDP(ss.dialUDP, func() (net.PacketConn, error) {
+		return ss.dialUoT(metadata)
+	})
+}
+
+// dialUoT relays UDP over the stream to the UDP-over-TCP magic address.
+func (ss *Socks5) dialUoT(metadata *M.Metadata) (net.PacketConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TCPConnectTimeout)
+	defer cancel()
+
+	c, err := ss.dialSocks5(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = socks5.ClientHandshake(c, uot.MagicAddr(), socks5.CmdConnect, ss.socksUser()); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("client handshake: %w", err)
+	}
+	if err = uot.WriteRequest(c, false, serializeSocksAddr(metadata)); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("write request: %w", err)
+	}
+	return newUoTPacketConn(c), nil
 }
 
-func (ss *Socks5) DialUDP(*M.Metadata) (_ net.PacketConn, err error) {
+// dialUDP relays UDP with UDP ASSOCIATE.
+func (ss *Socks5) dialUDP() (_ net.PacketConn, err error) {
 	if ss.unix {
 		return nil, errors.New("not supported when unix domain socket is enabled")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), tcpConnectTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), TCPConnectTimeout)
 	defer cancel()
 
-	c, err := dialer.DialContext(ctx, "tcp", ss.Addr())
+	c, err := ss.dialSocks5(ctx)
 	if err != nil {
-		err = fmt.Errorf("connect to %s: %w", ss.Addr(), err)
 		return
 	}
-	setKeepAlive(c)
 
 	defer func() {
 		if err != nil && c != nil {
@@ -84,14 +134,6 @@ func (ss *Socks5) DialUDP(*M.Metadata) (_ net.PacketConn, err error) {
 		}
 	}()
 
-	var user *socks5.User
-	if ss.user != "" {
-		user = &socks5.User{
-			Username: ss.user,
-			Password: ss.pass,
-		}
-	}
-
 	// The UDP ASSOCIATE request is used to establish an association within
 	// the UDP relay process to handle UDP datagrams.  The DST.ADDR and
 	// DST.PORT fields contain the address and port that the client expects
@@ -102,12 +144,28 @@ func (ss *Socks5) DialUDP(*M.Metadata) (_ net.PacketConn, err error) {
 	// zeros. RFC1928
 	var targetAddr socks5.Addr = []byte{socks5.AtypIPv4, 0, 0, 0, 0, 0, 0}
 
-	addr, err := socks5.ClientHandshake(c, targetAddr, socks5.CmdUDPAssociate, user)
+	addr, err := socks5.ClientHandshake(c, targetAddr, socks5.CmdUDPAssociate, ss.socksUser())
 	if err != nil {
 		return nil, fmt.Errorf("client handshake: %w", err)
 	}
 
-	pc, err := dialer.ListenPacket("udp", "")
+	bindAddr := addr.UDPAddr()
+	if bindAddr == nil {
+		return nil, fmt.Errorf("invalid UDP binding address: %#v", addr)
+	}
+
+	udpAddress := bindAddr.String()
+	if bindAddr.IP.IsUnspecified() { /* e.g. "0.0.0.0" or "::" */
+		host, _, _ := net.SplitHostPort(ss.Addr())
+		udpAddress = net.JoinHostPort(host, strconv.Itoa(bindAddr.Port))
+	}
+
+	rAddr, err := ss.resolveServer(udpAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := ss.listenServer(udpAddress)
 	if err != nil {
 		return nil, fmt.Errorf("listen packet: %w", err)
 	}
@@ -120,20 +178,7 @@ func (ss *Socks5) DialUDP(*M.Metadata) (_ net.PacketConn, err error) {
 		pc.Close()
 	}()
 
-	bindAddr := addr.UDPAddr()
-	if bindAddr == nil {
-		return nil, fmt.Errorf("invalid UDP binding address: %#v", addr)
-	}
-
-	if bindAddr.IP.IsUnspecified() { /* e.g. "0.0.0.0" or "::" */
-		udpAddr, err := net.ResolveUDPAddr("udp", ss.Addr())
-		if err != nil {
-			return nil, fmt.Errorf("resolve udp address %s: %w", ss.Addr(), err)
-		}
-		bindAddr.IP = udpAddr.IP
-	}
-
-	return &socksPacketConn{PacketConn: pc, rAddr: bindAddr, tcpConn: c}, nil
+	return &socksPacketConn{PacketConn: pc, rAddr: rAddr, tcpConn: c}, nil
 }
 
 type socksPacketConn struct {
@@ -184,5 +229,5 @@ func (pc *socksPacketConn) Close() error {
 }
 
 func serializeSocksAddr(m *M.Metadata) socks5.Addr {
-	return socks5.SerializeAddr("", m.DstIP, m.DstPort)
+	return socks5.SerializeAddr(m.Host, m.DstIP, m.DstPort)
 }
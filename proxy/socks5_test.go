@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+	"github.com/xjasonlyu/tun2socks/v2/transport/uot"
+)
+
+// serveSocks5UoT runs a socks5 server without authentication, whose UDP
+// relay drops all packets, while UDP over TCP echoes the packets back.
+// The DNS queries are echoed as responses.
+func serveSocks5UoT(t *testing.T) net.Listener {
+	relay, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { relay.Close() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+
+				r := bufio.NewReader(c)
+				buf := make([]byte, socks5.MaxAddrLen)
+				if _, err := io.ReadFull(r, buf[:2]); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(r, buf[:buf[1]]); err != nil {
+					return
+				}
+				c.Write([]byte{socks5.Version, 0x00})
+
+				if _, err := io.ReadFull(r, buf[:3]); err != nil {
+					return
+				}
+				cmd := socks5.Command(buf[1])
+				addr, err := socks5.ReadAddr(r, buf)
+				if err != nil {
+					return
+				}
+
+				switch {
+				case cmd == socks5.CmdUDPAssociate:
+					bindAddr := socks5.ParseAddr(relay.LocalAddr())
+					c.Write(append([]byte{socks5.Version, 0x00, 0x00}, bindAddr...))
+					io.Copy(io.Discard, r)
+				case cmd == socks5.CmdConnect && addr.String() == uot.MagicAddr().String():
+					c.Write([]byte{socks5.Version, 0x00, 0x00, socks5.AtypIPv4, 0, 0, 0, 0, 0, 0})
+					// IsConnect, and the IPv4 destination of UoT address.
+					if _, err = io.ReadFull(r, buf[:1+1+4+2]); err != nil || buf[0] != 0 /* non-connect */ {
+						return
+					}
+
+					payload := make([]byte, 1024)
+					for {
+						addr, n, err := uot.ReadPacket(r, payload)
+						if err != nil {
+							return
+						}
+						if addr.String() == uotProbeAddr().String() {
+							payload[2] |= 0x80 /* QR */
+						}
+						if _, err = uot.WritePacket(c, addr, payload[:n]); err != nil {
+							return
+						}
+					}
+				}
+			}()
+		}
+	}()
+	return ln
+}
+
+func TestSocks5UoT(t *testing.T) {
+	ln := serveSocks5UoT(t)
+	defer ln.Close()
+
+	defer func(addr *net.UDPAddr, timeout time.Duration) {
+		SetUoTProbeAddr(addr)
+		uotProbeTimeout = timeout
+	}(uotProbeAddr(), uotProbeTimeout)
+	SetUoTProbeAddr(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53})
+	uotProbeTimeout = 100 * time.Millisecond
+
+	metadata := &M.Metadata{Network: M.UDP, DstIP: net.IPv4(1, 1, 1, 1), DstPort: 53}
+
+	for _, mode := range []UoT{UoTOn, UoTAuto} {
+		p, err := NewSocks5(ln.Addr().String(), "", "", StreamOptions{}, mode)
+		require.NoError(t, err)
+
+		if mode == UoTAuto {
+			// The native UDP is used until the probe is done.
+			pc, err := p.DialUDP(metadata)
+			require.NoError(t, err)
+			assert.IsType(t, &socksPacketConn{}, pc)
+			pc.Close()
+			require.Eventually(t, func() bool {
+				p.uot.mu.Lock()
+				defer p.uot.mu.Unlock()
+				return !p.uot.probed.IsZero()
+			}, time.Second, 10*time.Millisecond)
+		}
+
+		pc, err := p.DialUDP(metadata)
+		require.NoError(t, err)
+		assert.IsType(t, &uotPacketConn{}, pc)
+
+		to := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 443}
+		_, err = pc.WriteTo([]byte("hello"), to)
+		require.NoError(t, err)
+		buf := make([]byte, 16)
+		n, from, err := pc.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(buf[:n]))
+		assert.Equal(t, to.String(), from.String())
+		pc.Close()
+	}
+
+	p, err := NewSocks5(ln.Addr().String(), "", "", StreamOptions{}, UoTOff)
+	require.NoError(t, err)
+	pc, err := p.DialUDP(metadata)
+	require.NoError(t, err)
+	assert.IsType(t, &socksPacketConn{}, pc)
+	pc.Close()
+}
@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/xjasonlyu/tun2socks/v2/log"
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+)
+
+var _ Proxy = (*SSH)(nil)
+
+// SSH opens direct-tcpip channels over a single SSH client connection,
+// which is reconnected on the next dial after it's lost.
+type SSH struct {
+	*Base
+
+	config *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// SSHOptions are the authentication options of SSH, the methods are
+// tried in the order of password, key and agent.
+type SSHOptions struct {
+	User     string
+	Password string
+
+	// KeyFile is the path of private key, which is decrypted
+	// with the Passphrase if set.
+	KeyFile    string
+	Passphrase string
+
+	// Agent enables authentication with the agent of SSH_AUTH_SOCK.
+	Agent bool
+
+	// KnownHosts is the path of known_hosts file to verify the host
+	// key, defaults to ~/.ssh/known_hosts.
+	KnownHosts string
+}
+
+func NewSSH(addr string, opts SSHOptions) (*SSH, error) {
+	config := &ssh.ClientConfig{
+		User:    opts.User,
+		Timeout: TCPConnectTimeout,
+	}
+
+	if opts.Password != "" {
+		config.Auth = append(config.Auth, ssh.Password(opts.Password))
+	}
+
+	if opts.KeyFile != "" {
+		data, err := os.ReadFile(opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("ssh initialize: %w", err)
+		}
+
+		var signer ssh.Signer
+		if opts.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(opts.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ssh initialize: parse key: %w", err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+
+	if opts.Agent {
+		config.Auth = append(config.Auth, ssh.PublicKeysCallback(agentSigners))
+	}
+
+	if len(config.Auth) == 0 {
+		return nil, errors.New("ssh initialize: no authentication method")
+	}
+
+	knownHosts := opts.KnownHosts
+	if knownHosts == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("ssh initialize: %w", err)
+		}
+		knownHosts = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, fmt.Errorf("ssh initialize: known hosts: %w", err)
+	}
+	config.HostKeyCallback = hostKeyCallback
+
+	return &SSH{
+		Base: &Base{
+			addr:  addr,
+			proto: proto.SSH,
+		},
+		config: config,
+	}, nil
+}
+
+// agentSigners returns the signers of agent at SSH_AUTH_SOCK.
+func agentSigners() ([]ssh.Signer, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil, errors.New("SSH_AUTH_SOCK is not set")
+	}
+
+	c, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil, err
+	}
+	// The agent connection is only used during authentication.
+	signers, err := agent.NewClient(c).Signers()
+	c.Close()
+	return signers, err
+}
+
+// getClient returns the client connected, or connects a new one.
+func (s *SSH) getClient(ctx context.Context) (*ssh.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	c, err := s.dialServer(ctx, "tcp", s.Addr())
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", s.Addr(), err)
+	}
+	setKeepAlive(c)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+	conn, chans, reqs, err := ssh.NewClientConn(c, s.Addr(), s.config)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("ssh handshake: %w", err)
+	}
+	c.SetDeadline(time.Time{})
+
+	client := ssh.NewClient(conn, chans, reqs)
+	go func() {
+		err := client.Wait()
+		log.Infof("[SSH] connection to %s closed: %v", s.Addr(), err)
+
+		s.mu.Lock()
+		if s.client == client {
+			s.client = nil
+		}
+		s.mu.Unlock()
+	}()
+
+	s.client = client
+	return client, nil
+}
+
+// resetClient closes client if it's still in use.
+func (s *SSH) resetClient(client *ssh.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client == client {
+		s.client = nil
+		client.Close()
+	}
+}
+
+func (s *SSH) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
+	// The dial is retried on a new client, in case of the connection
+	// is broken without being noticed.
+	for retry := 0; ; retry++ {
+		client, err := s.getClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := dialChannel(ctx, client, metadata.DestinationAddress())
+		if err == nil {
+			return c, nil
+		}
+
+		var openErr *ssh.OpenChannelError
+		if errors.As(err, &openErr) || ctx.Err() != nil || retry > 0 {
+			return nil, err
+		}
+		s.resetClient(client)
+	}
+}
+
+// dialChannel opens a direct-tcpip channel to addr, which is abandoned
+// when ctx is done.
+func dialChannel(ctx context.Context, client *ssh.Client, addr string) (net.Conn, error) {
+	type result struct {
+		c   net.Conn
+		err error
+	}
+
+	ch := make(chan result, 1)
+	go func() {
+		c, err := client.Dial("tcp", addr)
+		ch <- result{c, err}
+	}()
+
+	select {
+	case r := <-ch:
+		return r.c, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-ch; r.c != nil {
+				r.c.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func (s *SSH) DialUDP(*M.Metadata) (net.PacketConn, error) {
+	return nil, errors.New("ssh does not support UDP")
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+// serveSSH runs an SSH server accepting password, which echoes the data
+// of direct-tcpip channels back. The host key is written to a known_hosts
+// file, whose path is returned.
+func serveSSH(t *testing.T, password string) (net.Listener, string) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, p []byte) (*ssh.Permissions, error) {
+			if string(p) != password {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(ln.Addr().String())}, signer.PublicKey())
+	require.NoError(t, os.WriteFile(knownHosts, []byte(line+"\n"), 0o600))
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(c, config)
+				if err != nil {
+					c.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+
+				for newChannel := range chans {
+					extra := newChannel.ExtraData()
+					if newChannel.ChannelType() != "direct-tcpip" || len(extra) < 4 ||
+						string(extra[4:4+binary.BigEndian.Uint32(extra)]) != "example.com" {
+						newChannel.Reject(ssh.ConnectionFailed, "unexpected destination")
+						continue
+					}
+					ch, reqs, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+					go ssh.DiscardRequests(reqs)
+					go func() {
+						defer ch.Close()
+						io.Copy(ch, ch)
+					}()
+				}
+			}()
+		}
+	}()
+	return ln, knownHosts
+}
+
+func TestSSH(t *testing.T) {
+	ln, knownHosts := serveSSH(t, "password")
+	defer ln.Close()
+
+	p, err := NewSSH(ln.Addr().String(), SSHOptions{User: "user", Password: "password", KnownHosts: knownHosts})
+	require.NoError(t, err)
+
+	dial := func(host string) (net.Conn, error) {
+		return p.DialContext(context.Background(), &M.Metadata{Host: host, DstPort: 80})
+	}
+
+	c, err := dial("example.com")
+	require.NoError(t, err)
+
+	_, err = c.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+	c.Close()
+
+	_, err = dial("example.org")
+	assert.Error(t, err)
+
+	// Reconnects after the connection is lost.
+	p.mu.Lock()
+	p.client.Close()
+	p.mu.Unlock()
+
+	c, err = dial("example.com")
+	require.NoError(t, err)
+	c.Close()
+
+	_, err = p.DialUDP(&M.Metadata{})
+	assert.Error(t, err)
+}
+
+func TestSSHUnknownHost(t *testing.T) {
+	ln, _ := serveSSH(t, "password")
+	defer ln.Close()
+
+	other, knownHosts := serveSSH(t, "password")
+	other.Close()
+
+	p, err := NewSSH(ln.Addr().String(), SSHOptions{User: "user", Password: "password", KnownHosts: knownHosts})
+	require.NoError(t, err)
+
+	_, err = p.DialContext(context.Background(), &M.Metadata{Host: "example.com", DstPort: 80})
+	assert.Error(t, err)
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"golang.org/x/net/http2"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/transport/h2"
+	"github.com/xjasonlyu/tun2socks/v2/transport/ws"
+)
+
+// StreamOptions are the options of the stream transport to the proxy
+// server, which is wrapped in TLS and then WebSocket or HTTP/2 if enabled.
+type StreamOptions struct {
+	// TLS is the TLS options, nil if disabled.
+	TLS *TLSOptions
+
+	// WebSocket is the handshake options, nil if disabled.
+	WebSocket *ws.Config
+
+	// HTTP2 is the request options, nil if disabled. It's exclusive
+	// with WebSocket.
+	HTTP2 *h2.Config
+}
+
+// streamDialer connects to the proxy server with the stream transport.
+type streamDialer struct {
+	base      *Base
+	network   string
+	addr      string
+	tlsConfig *tls.Config
+	wsConfig  *ws.Config
+	h2Config  *h2.Config
+}
+
+func newStreamDialer(base *Base, opts *StreamOptions) (*streamDialer, error) {
+	if opts.WebSocket != nil && opts.HTTP2 != nil {
+		return nil, errors.New("websocket and http/2 are exclusive")
+	}
+
+	d := &streamDialer{
+		base:     base,
+		network:  "tcp",
+		addr:     base.Addr(),
+		wsConfig: opts.WebSocket,
+		h2Config: opts.HTTP2,
+	}
+	if opts.TLS != nil {
+		config, err := newTLSConfig(d.addr, opts.TLS)
+		if err != nil {
+			return nil, err
+		}
+		if d.h2Config != nil {
+			config.NextProtos = []string{http2.NextProtoTLS}
+		}
+		d.tlsConfig = config
+	}
+	return d, nil
+}
+
+func (d *streamDialer) DialContext(ctx context.Context) (net.Conn, error) {
+	c, err := d.base.dialPooled(ctx, d.dialTLS)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.wsConfig != nil {
+		wc, err := ws.StreamConn(ctx, c, d.addr, d.wsConfig)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("websocket handshake: %w", err)
+		}
+		c = wc
+	}
+
+	if d.h2Config != nil {
+		hc, err := h2.StreamConn(c, d.addr, d.h2Config)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("http/2 handshake: %w", err)
+		}
+		c = hc
+	}
+	return c, nil
+}
+
+// dialTLS connects to the server, and wraps the connection in TLS if
+// enabled, which may be done before the destination is known.
+func (d *streamDialer) dialTLS(ctx context.Context) (net.Conn, error) {
+	c, err := d.base.dialServer(ctx, d.network, d.addr)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", d.addr, err)
+	}
+	setKeepAlive(c)
+
+	if d.tlsConfig != nil {
+		tc, err := tlsHandshake(ctx, c, d.tlsConfig)
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		c = tc
+	}
+	return c, nil
+}
+
+// streamPacketConn relays UDP packets over the stream, which is bound
+// to the destination at dial, e.g. UDP of VLESS and VMess.
+type streamPacketConn struct {
+	net.Conn
+
+	rAddr net.Addr
+
+	writePacket func(io.Writer, []byte) (int, error)
+	readPacket  func(io.Reader, []byte) (int, error)
+}
+
+func newStreamPacketConn(c net.Conn, metadata *M.Metadata,
+	writePacket func(io.Writer, []byte) (int, error), readPacket func(io.Reader, []byte) (int, error),
+) *streamPacketConn {
+	var rAddr net.Addr
+	if udpAddr := metadata.UDPAddr(); udpAddr != nil && metadata.Host == "" {
+		rAddr = udpAddr
+	} else {
+		rAddr = metadata.Addr()
+	}
+	return &streamPacketConn{
+		Conn:        c,
+		rAddr:       rAddr,
+		writePacket: writePacket,
+		readPacket:  readPacket,
+	}
+}
+
+func (pc *streamPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if addr.String() != pc.rAddr.String() {
+		return 0, errors.New("destination mismatch")
+	}
+	return pc.writePacket(pc.Conn, b)
+}
+
+func (pc *streamPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, err := pc.readPacket(pc.Conn, b)
+	return n, pc.rAddr, err
+}
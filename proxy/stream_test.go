@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xjasonlyu/tun2socks/v2/transport/h2"
+	"github.com/xjasonlyu/tun2socks/v2/transport/ws"
+)
+
+// echoStream writes "hello" through the stream, and expects reply.
+func echoStream(t *testing.T, d *streamDialer, reply string) {
+	c, err := d.DialContext(context.Background())
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, len(reply))
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+	assert.Equal(t, reply, string(buf))
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	// The server sends the early data back, and then echoes.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ws" || r.Header.Get("X-Test") != "1" {
+			http.NotFound(w, r)
+			return
+		}
+		early, _ := base64.RawURLEncoding.DecodeString(r.Header.Get("Sec-WebSocket-Protocol"))
+
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		if len(early) > 0 {
+			c.WriteMessage(websocket.BinaryMessage, []byte("early:"))
+			c.WriteMessage(websocket.BinaryMessage, early)
+		}
+		for {
+			typ, b, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.WriteMessage(typ, b)
+		}
+	}))
+	defer ts.Close()
+
+	for _, ed := range []int{0, 2} {
+		d, err := newStreamDialer(&Base{addr: ts.Listener.Addr().String()}, &StreamOptions{
+			WebSocket: &ws.Config{
+				Path:         "/ws",
+				Headers:      http.Header{"X-Test": {"1"}},
+				MaxEarlyData: ed,
+			},
+		})
+		require.NoError(t, err)
+
+		if ed > 0 {
+			// "he" is sent as early data, and "llo" as message.
+			echoStream(t, d, "early:hello")
+		} else {
+			echoStream(t, d, "hello")
+		}
+	}
+}
+
+func TestStreamHTTP2(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/h2" || r.Header.Get("X-Test") != "1" || r.ProtoMajor != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		buf := make([]byte, 1024)
+		for {
+			n, err := r.Body.Read(buf)
+			if n > 0 {
+				w.Write(buf[:n])
+				w.(http.Flusher).Flush()
+			}
+			if err != nil {
+				return
+			}
+		}
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	d, err := newStreamDialer(&Base{addr: ts.Listener.Addr().String()}, &StreamOptions{
+		TLS: &TLSOptions{SkipVerify: true},
+		HTTP2: &h2.Config{
+			Host:    "example.com",
+			Path:    "/h2",
+			Headers: http.Header{"X-Test": {"1"}},
+		},
+	})
+	require.NoError(t, err)
+	echoStream(t, d, "hello")
+
+	d, err = newStreamDialer(&Base{addr: ts.Listener.Addr().String()}, &StreamOptions{
+		TLS:   &TLSOptions{SkipVerify: true},
+		HTTP2: &h2.Config{Path: "/not-found"},
+	})
+	require.NoError(t, err)
+
+	c, err := d.DialContext(context.Background())
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Read(make([]byte, 1))
+	assert.ErrorContains(t, err, "404")
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// TLSOptions are the TLS options to the proxy server.
+type TLSOptions struct {
+	// SNI is the server name, the host of server address is used if empty.
+	SNI        string
+	SkipVerify bool
+
+	// CA is the path of PEM encoded CA bundle to verify the server,
+	// the system roots are used if empty.
+	CA string
+
+	// Cert and Key are the paths of PEM encoded client certificate
+	// and private key for mutual TLS.
+	Cert string
+	Key  string
+
+	// Pins are the base64 encoded SHA256 of server public keys (SPKI),
+	// one of which must be matched by the server certificate if set.
+	Pins []string
+}
+
+// newTLSConfig builds the client config to the server at addr.
+func newTLSConfig(addr string, opts *TLSOptions) (*tls.Config, error) {
+	serverName := opts.SNI
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(addr)
+	}
+
+	config := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: opts.SkipVerify,
+	}
+
+	if opts.CA != "" {
+		data, err := os.ReadFile(opts.CA)
+		if err != nil {
+			return nil, fmt.Errorf("load ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("load ca: no certificate found in %s", opts.CA)
+		}
+		config.RootCAs = pool
+	}
+
+	if opts.Cert != "" || opts.Key != "" {
+		cert, err := tls.LoadX509KeyPair(opts.Cert, opts.Key)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(opts.Pins) > 0 {
+		pins := make([][]byte, 0, len(opts.Pins))
+		for _, pin := range opts.Pins {
+			hash, err := base64.StdEncoding.DecodeString(pin)
+			if err != nil || len(hash) != sha256.Size {
+				return nil, fmt.Errorf("invalid pin: %s", pin)
+			}
+			pins = append(pins, hash)
+		}
+		// VerifyConnection is called even if InsecureSkipVerify is set.
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("no server certificate")
+			}
+			hash := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+			for _, pin := range pins {
+				if subtle.ConstantTimeCompare(hash[:], pin) == 1 {
+					return nil
+				}
+			}
+			return errors.New("server public key is not pinned")
+		}
+	}
+	return config, nil
+}
+
+// tlsHandshake wraps c in TLS with config, c is not closed on error.
+func tlsHandshake(ctx context.Context, c net.Conn, config *tls.Config) (net.Conn, error) {
+	tc := tls.Client(c, config)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("tls handshake: %w", err)
+	}
+	return tc, nil
+}
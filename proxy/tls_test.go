@@ -0,0 +1,149 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+// testCert issues a certificate of name signed by parent, which is
+// self-signed if parent is nil.
+func testCert(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := template, any(key)
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writeCert writes cert and its key in PEM to dir, and returns the paths.
+func writeCert(t *testing.T, dir, name string, cert tls.Certificate) (certFile, keyFile string) {
+	der, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	return
+}
+
+func TestHTTPS(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := testCert(t, "ca", nil)
+	caFile, _ := writeCert(t, dir, "ca", ca)
+	serverCert := testCert(t, "proxy.example.com", &ca)
+	clientCert := testCert(t, "client", &ca)
+	certFile, keyFile := writeCert(t, dir, "client", clientCert)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	// An HTTPS proxy requiring client certificate, which echoes the
+	// data of CONNECT back.
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+
+				r := bufio.NewReader(c)
+				req, err := http.ReadRequest(r)
+				if err != nil || req.Method != http.MethodConnect || req.Host != "example.com:80" {
+					return
+				}
+				io.WriteString(c, "HTTP/1.1 200 Connection established\r\n\r\n")
+				io.Copy(c, r)
+			}()
+		}
+	}()
+
+	spki := sha256.Sum256(serverCert.Leaf.RawSubjectPublicKeyInfo)
+	pin := base64.StdEncoding.EncodeToString(spki[:])
+
+	dial := func(opts *TLSOptions) error {
+		p, err := NewHTTP(ln.Addr().String(), "", "", opts)
+		if err != nil {
+			return err
+		}
+
+		c, err := p.DialContext(context.Background(), &M.Metadata{Host: "example.com", DstPort: 80})
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+
+		if _, err = c.Write([]byte("hello")); err != nil {
+			return err
+		}
+		buf := make([]byte, 5)
+		if _, err = io.ReadFull(c, buf); err != nil {
+			return err
+		}
+		assert.Equal(t, "hello", string(buf))
+		return nil
+	}
+
+	assert.NoError(t, dial(&TLSOptions{SNI: "proxy.example.com", CA: caFile, Cert: certFile, Key: keyFile, Pins: []string{pin}}))
+	assert.NoError(t, dial(&TLSOptions{SkipVerify: true, Cert: certFile, Key: keyFile, Pins: []string{pin}}))
+
+	// Unknown authority.
+	assert.Error(t, dial(&TLSOptions{SNI: "proxy.example.com", Cert: certFile, Key: keyFile}))
+	// Public key not pinned.
+	other := sha256.Sum256(ca.Leaf.RawSubjectPublicKeyInfo)
+	assert.Error(t, dial(&TLSOptions{SkipVerify: true, Cert: certFile, Key: keyFile,
+		Pins: []string{base64.StdEncoding.EncodeToString(other[:])}}))
+	// Client certificate required.
+	assert.Error(t, dial(&TLSOptions{SNI: "proxy.example.com", CA: caFile}))
+}
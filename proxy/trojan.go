@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+	"github.com/xjasonlyu/tun2socks/v2/transport/trojan"
+)
+
+var _ Proxy = (*Trojan)(nil)
+
+type Trojan struct {
+	*Base
+
+	key    []byte
+	stream *streamDialer
+}
+
+func NewTrojan(addr, password string, opts StreamOptions) (*Trojan, error) {
+	if password == "" {
+		return nil, errors.New("trojan initialize: empty password")
+	}
+
+	// Trojan is always over TLS.
+	if opts.TLS == nil {
+		opts.TLS = &TLSOptions{}
+	}
+
+	base := &Base{
+		addr:  addr,
+		proto: proto.Trojan,
+	}
+
+	stream, err := newStreamDialer(base, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("trojan initialize: %w", err)
+	}
+
+	return &Trojan{
+		Base:   base,
+		key:    trojan.Key(password),
+		stream: stream,
+	}, nil
+}
+
+func (t *Trojan) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
+	c, err := t.stream.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = trojan.WriteHeader(c, t.key, socks5.CmdConnect, serializeSocksAddr(metadata)); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+	return c, nil
+}
+
+func (t *Trojan) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TCPConnectTimeout)
+	defer cancel()
+
+	c, err := t.stream.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = trojan.WriteHeader(c, t.key, socks5.CmdUDPAssociate, serializeSocksAddr(metadata)); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+	return &trojanPacketConn{Conn: c, reader: bufio.NewReader(c)}, nil
+}
+
+// trojanPacketConn relays UDP packets over the Trojan stream.
+type trojanPacketConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+	rMu    sync.Mutex
+}
+
+func (pc *trojanPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if ma, ok := addr.(*M.Addr); ok {
+		return trojan.WritePacket(pc.Conn, serializeSocksAddr(ma.Metadata()), b)
+	}
+	return trojan.WritePacket(pc.Conn, socks5.ParseAddr(addr), b)
+}
+
+func (pc *trojanPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	pc.rMu.Lock()
+	defer pc.rMu.Unlock()
+
+	addr, n, err := trojan.ReadPacket(pc.reader, b)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	udpAddr := addr.UDPAddr()
+	if udpAddr == nil {
+		return 0, nil, fmt.Errorf("convert %s to UDPAddr is nil", addr)
+	}
+	return n, udpAddr, nil
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+	"github.com/xjasonlyu/tun2socks/v2/transport/trojan"
+)
+
+// serveTrojan runs a Trojan stand-in server, which echoes the data of
+// CONNECT and the packets of UDP ASSOCIATE back.
+func serveTrojan(t *testing.T, password string) net.Listener {
+	ts := httptest.NewTLSServer(nil)
+	cert := ts.TLS.Certificates[0]
+	ts.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+
+				r := bufio.NewReader(c)
+				header := make([]byte, trojan.KeyLength+3)
+				if _, err := io.ReadFull(r, header); err != nil {
+					return
+				}
+				if !bytes.Equal(header[:trojan.KeyLength], trojan.Key(password)) {
+					return
+				}
+
+				buf := make([]byte, socks5.MaxAddrLen)
+				addr, err := socks5.ReadAddr(r, buf)
+				if err != nil || addr.String() != "example.com:80" {
+					return
+				}
+				if _, err = io.ReadFull(r, make([]byte, 2)); err != nil {
+					return
+				}
+
+				switch socks5.Command(header[trojan.KeyLength+2]) {
+				case socks5.CmdConnect:
+					io.Copy(c, r)
+				case socks5.CmdUDPAssociate:
+					payload := make([]byte, 1024)
+					for {
+						addr, n, err := trojan.ReadPacket(r, payload)
+						if err != nil {
+							return
+						}
+						if _, err = trojan.WritePacket(c, addr, payload[:n]); err != nil {
+							return
+						}
+					}
+				}
+			}()
+		}
+	}()
+	return ln
+}
+
+func TestTrojan(t *testing.T) {
+	ln := serveTrojan(t, "password")
+	defer ln.Close()
+
+	metadata := &M.Metadata{Host: "example.com", DstPort: 80}
+
+	p, err := NewTrojan(ln.Addr().String(), "password", StreamOptions{TLS: &TLSOptions{SNI: "example.com", SkipVerify: true}})
+	require.NoError(t, err)
+
+	c, err := p.DialContext(context.Background(), metadata)
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	pc, err := p.DialUDP(metadata)
+	require.NoError(t, err)
+	defer pc.Close()
+
+	to := &net.UDPAddr{IP: net.IPv4(1, 1, 1, 1), Port: 53}
+	_, err = pc.WriteTo([]byte("query"), to)
+	require.NoError(t, err)
+	n, from, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "query", string(buf[:n]))
+	assert.Equal(t, to.String(), from.String())
+}
+
+func TestTrojanWrongPassword(t *testing.T) {
+	ln := serveTrojan(t, "password")
+	defer ln.Close()
+
+	p, err := NewTrojan(ln.Addr().String(), "wrong", StreamOptions{TLS: &TLSOptions{SkipVerify: true}})
+	require.NoError(t, err)
+
+	c, err := p.DialContext(context.Background(), &M.Metadata{Host: "example.com", DstPort: 80})
+	require.NoError(t, err)
+	defer c.Close()
+
+	c.Write([]byte("hello"))
+	_, err = c.Read(make([]byte, 5))
+	assert.Error(t, err)
+}
@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/xjasonlyu/tun2socks/v2/log"
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+	"github.com/xjasonlyu/tun2socks/v2/transport/uot"
+)
+
+const uotProbeInterval = 10 * time.Minute
+
+var (
+	// _uotProbeAddr is the DNS server queried to probe UDP.
+	_uotProbeAddr atomic.Pointer[net.UDPAddr]
+
+	uotProbeTimeout = 3 * time.Second
+)
+
+func init() {
+	SetUoTProbeAddr(&net.UDPAddr{IP: net.IPv4(8, 8, 8, 8), Port: 53})
+}
+
+// SetUoTProbeAddr sets the DNS server queried to probe whether the native
+// UDP or UDP over TCP works, which is 8.8.8.8:53 by default.
+func SetUoTProbeAddr(addr *net.UDPAddr) {
+	_uotProbeAddr.Store(addr)
+}
+
+func uotProbeAddr() *net.UDPAddr {
+	return _uotProbeAddr.Load()
+}
+
+// UoT is the mode of UDP over TCP, which relays UDP packets over the
+// TCP stream to the proxy server if UDP is blocked.
+type UoT uint8
+
+const (
+	// UoTOff uses the native UDP of proxy protocol.
+	UoTOff UoT = iota
+	// UoTOn always uses UDP over TCP.
+	UoTOn
+	// UoTAuto uses UDP over TCP if the native UDP doesn't work but
+	// UDP over TCP does, which is probed periodically.
+	UoTAuto
+)
+
+func (u UoT) String() string {
+	switch u {
+	case UoTOff:
+		return "off"
+	case UoTOn:
+		return "on"
+	case UoTAuto:
+		return "auto"
+	default:
+		return fmt.Sprintf("uot(%d)", u)
+	}
+}
+
+// uotSelector selects between the native UDP and UDP over TCP.
+type uotSelector struct {
+	mode UoT
+
+	mu      sync.Mutex
+	probed  time.Time
+	probing bool
+	useUoT  bool
+}
+
+func (s *uotSelector) dialUDP(native, uot func() (net.PacketConn, error)) (net.PacketConn, error) {
+	switch s.mode {
+	case UoTOn:
+		return uot()
+	case UoTAuto:
+		if s.selected(native, uot) {
+			return uot()
+		}
+	}
+	return native()
+}
+
+// selected returns whether UDP over TCP is used. The result is probed in
+// background every uotProbeInterval, and the last one, or the native UDP
+// before the first probe is done, is used meanwhile.
+func (s *uotSelector) selected(native, uot func() (net.PacketConn, error)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.probing && (s.probed.IsZero() || time.Since(s.probed) >= uotProbeInterval) {
+		s.probing = true
+		go s.probe(native, uot)
+	}
+	return s.useUoT
+}
+
+// probe probes the native UDP, and UDP over TCP if the former fails.
+func (s *uotSelector) probe(native, uot func() (net.PacketConn, error)) {
+	useUoT := false
+	if err := probeUDP(native); err != nil {
+		uotErr := probeUDP(uot)
+		useUoT = uotErr == nil
+		log.Infof("[UOT] native UDP probe: %v, UDP over TCP probe: %v", err, uotErr)
+	}
+
+	s.mu.Lock()
+	s.useUoT = useUoT
+	s.probed = time.Now()
+	s.probing = false
+	s.mu.Unlock()
+}
+
+// probeUDP checks if the packet conn of dial works by a DNS query.
+func probeUDP(dial func() (net.PacketConn, error)) error {
+	pc, err := dial()
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	id := uint16(rand.Uint32())
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName("."),
+			Type:  dnsmessage.TypeNS,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	query, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+
+	pc.SetReadDeadline(time.Now().Add(uotProbeTimeout))
+	if _, err = pc.WriteTo(query, uotProbeAddr()); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 512)
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		var p dnsmessage.Parser
+		if h, err := p.Start(buf[:n]); err == nil && h.ID == id && h.Response {
+			return nil
+		}
+	}
+}
+
+// uotPacketConn relays UDP packets over the stream of UDP over TCP.
+type uotPacketConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+	rMu    sync.Mutex
+}
+
+func newUoTPacketConn(c net.Conn) *uotPacketConn {
+	return &uotPacketConn{Conn: c, reader: bufio.NewReader(c)}
+}
+
+func (pc *uotPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if ma, ok := addr.(*M.Addr); ok {
+		return uot.WritePacket(pc.Conn, serializeSocksAddr(ma.Metadata()), b)
+	}
+	return uot.WritePacket(pc.Conn, socks5.ParseAddr(addr), b)
+}
+
+func (pc *uotPacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	pc.rMu.Lock()
+	defer pc.rMu.Unlock()
+
+	addr, n, err := uot.ReadPacket(pc.reader, b)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	udpAddr := addr.UDPAddr()
+	if udpAddr == nil {
+		return 0, nil, fmt.Errorf("convert %s to UDPAddr is nil", addr)
+	}
+	return n, udpAddr, nil
+}
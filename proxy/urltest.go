@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"time"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+)
+
+var _ Group = (*URLTest)(nil)
+
+// URLTest uses the alive member with the lowest latency.
+type URLTest struct {
+	*groupBase
+}
+
+func NewURLTest(members []Member, url string, interval time.Duration) (*URLTest, error) {
+	g, err := newGroupBase(proto.URLTest, members, url, interval)
+	if err != nil {
+		return nil, err
+	}
+	return &URLTest{groupBase: g}, nil
+}
+
+func (u *URLTest) Addr() string {
+	return u.fastest().Proxy.Addr()
+}
+
+func (u *URLTest) Now() string {
+	return u.fastest().Name
+}
+
+func (u *URLTest) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
+	return u.fastest().Proxy.DialContext(ctx, metadata)
+}
+
+func (u *URLTest) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
+	return u.fastest().Proxy.DialUDP(metadata)
+}
+
+func (u *URLTest) fastest() *member {
+	var fastest *member
+	for _, m := range u.members {
+		if !m.alive.Load() {
+			continue
+		}
+		if fastest == nil || m.delay.Load() < fastest.delay.Load() {
+			fastest = m
+		}
+	}
+	if fastest == nil {
+		return u.members[0]
+	}
+	return fastest
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+	"github.com/xjasonlyu/tun2socks/v2/transport/vless"
+)
+
+var _ Proxy = (*VLESS)(nil)
+
+type VLESS struct {
+	*Base
+
+	client *vless.Client
+	stream *streamDialer
+}
+
+func NewVLESS(addr, id string, opts StreamOptions) (*VLESS, error) {
+	client, err := vless.NewClient(id)
+	if err != nil {
+		return nil, fmt.Errorf("vless initialize: %w", err)
+	}
+
+	base := &Base{
+		addr:  addr,
+		proto: proto.VLESS,
+	}
+
+	stream, err := newStreamDialer(base, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("vless initialize: %w", err)
+	}
+
+	return &VLESS{
+		Base:   base,
+		client: client,
+		stream: stream,
+	}, nil
+}
+
+func (v *VLESS) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
+	c, err := v.stream.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vc, err := v.client.StreamConn(c, vless.CommandTCP, serializeSocksAddr(metadata))
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return vc, nil
+}
+
+// SupportsMultiDestUDP returns false, as the UDP stream is bound to the
+// destination at dial.
+func (v *VLESS) SupportsMultiDestUDP() bool {
+	return false
+}
+
+func (v *VLESS) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TCPConnectTimeout)
+	defer cancel()
+
+	c, err := v.stream.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vc, err := v.client.StreamConn(c, vless.CommandUDP, serializeSocksAddr(metadata))
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return newStreamPacketConn(vc, metadata, vless.WritePacket, vless.ReadPacket), nil
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/transport/vless"
+	"github.com/xjasonlyu/tun2socks/v2/transport/ws"
+)
+
+// serveVLESS is a minimal VLESS over WebSocket server, which echoes
+// the data of requests back.
+func serveVLESS(t *testing.T, id uuid.UUID) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !assert.Equal(t, "/vless", r.URL.Path) {
+			return
+		}
+		wsConn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer wsConn.Close()
+
+		_, msg, err := wsConn.ReadMessage()
+		if err != nil {
+			return
+		}
+		// Version, UUID, Addons, Command, Port, Atyp, Address
+		if !assert.Equal(t, id[:], msg[1:17]) ||
+			!assert.Equal(t, []byte{0, 80, vless.AtypDomainName, 11}, msg[19:23]) {
+			return
+		}
+		if err = wsConn.WriteMessage(websocket.BinaryMessage, []byte{vless.Version, 0}); err != nil {
+			return
+		}
+
+		for {
+			_, msg, err = wsConn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = wsConn.WriteMessage(websocket.BinaryMessage, msg); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func TestVLESS(t *testing.T) {
+	id := uuid.New()
+	server := serveVLESS(t, id)
+	defer server.Close()
+
+	metadata := &M.Metadata{Host: "example.com", DstPort: 80}
+
+	p, err := NewVLESS(strings.TrimPrefix(server.URL, "http://"), id.String(), StreamOptions{
+		WebSocket: &ws.Config{Path: "/vless"},
+	})
+	require.NoError(t, err)
+
+	c, err := p.DialContext(context.Background(), metadata)
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	pc, err := p.DialUDP(metadata)
+	require.NoError(t, err)
+	defer pc.Close()
+
+	_, err = pc.WriteTo([]byte("query"), metadata.Addr())
+	require.NoError(t, err)
+	_, err = pc.WriteTo([]byte("query"), &net.UDPAddr{IP: net.IPv4(1, 1, 1, 1), Port: 53})
+	assert.Error(t, err)
+
+	buf = make([]byte, 1024)
+	n, from, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal([]byte("query"), buf[:n]))
+	assert.Equal(t, metadata.Addr().String(), from.String())
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+	"github.com/xjasonlyu/tun2socks/v2/transport/vmess"
+)
+
+var _ Proxy = (*VMess)(nil)
+
+type VMess struct {
+	*Base
+
+	client *vmess.Client
+	stream *streamDialer
+}
+
+func NewVMess(addr, id, security string, opts StreamOptions) (*VMess, error) {
+	s, err := vmess.ParseSecurity(security)
+	if err != nil {
+		return nil, fmt.Errorf("vmess initialize: %w", err)
+	}
+
+	client, err := vmess.NewClient(id, s)
+	if err != nil {
+		return nil, fmt.Errorf("vmess initialize: %w", err)
+	}
+
+	base := &Base{
+		addr:  addr,
+		proto: proto.VMess,
+	}
+
+	stream, err := newStreamDialer(base, &opts)
+	if err != nil {
+		return nil, fmt.Errorf("vmess initialize: %w", err)
+	}
+
+	return &VMess{
+		Base:   base,
+		client: client,
+		stream: stream,
+	}, nil
+}
+
+func (v *VMess) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
+	c, err := v.stream.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vc, err := v.client.StreamConn(c, vmess.CommandTCP, serializeSocksAddr(metadata))
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return vc, nil
+}
+
+// SupportsMultiDestUDP returns false, as the UDP stream is bound to the
+// destination at dial.
+func (v *VMess) SupportsMultiDestUDP() bool {
+	return false
+}
+
+func (v *VMess) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TCPConnectTimeout)
+	defer cancel()
+
+	c, err := v.stream.DialContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vc, err := v.client.StreamConn(c, vmess.CommandUDP, serializeSocksAddr(metadata))
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	// Each chunk of VMess UDP stream carries exactly one packet.
+	return newStreamPacketConn(vc, metadata,
+		func(w io.Writer, b []byte) (int, error) { return w.Write(b) },
+		func(r io.Reader, b []byte) (int, error) { return r.Read(b) },
+	), nil
+}
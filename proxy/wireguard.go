@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/xjasonlyu/tun2socks/v2/dialer"
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+	"github.com/xjasonlyu/tun2socks/v2/transport/wireguard"
+)
+
+var _ Proxy = (*WireGuard)(nil)
+
+type WireGuard struct {
+	*Base
+
+	cfg *wireguard.Config
+
+	// device is created on the first dial, so that the endpoint
+	// is resolved after the network is ready.
+	mu     sync.Mutex
+	device *wireguard.Device
+}
+
+func NewWireGuard(cfg *wireguard.Config) (*WireGuard, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("wireguard initialize: empty endpoint")
+	}
+
+	return &WireGuard{
+		Base: &Base{
+			addr:  cfg.Endpoint,
+			proto: proto.WireGuard,
+		},
+		cfg: cfg,
+	}, nil
+}
+
+func (w *WireGuard) getDevice() (*wireguard.Device, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.device != nil {
+		return w.device, nil
+	}
+
+	cfg := w.cfg
+	if w.dialer != nil {
+		// The packets are sent to the resolved endpoint only.
+		udpAddr, err := dialer.ResolveUDPAddr(context.Background(), "udp", cfg.Endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("resolve endpoint: %w", err)
+		}
+
+		c := *cfg
+		c.ListenPacket = func(string, string) (net.PacketConn, error) {
+			return w.listenServer(udpAddr.String())
+		}
+		cfg = &c
+	}
+
+	d, err := wireguard.NewDevice(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("wireguard device: %w", err)
+	}
+	w.device = d
+	return d, nil
+}
+
+// Close closes the device, which is created again on the next dial.
+func (w *WireGuard) Close() error {
+	w.mu.Lock()
+	if w.device != nil {
+		w.device.Close()
+		w.device = nil
+	}
+	w.mu.Unlock()
+	return w.Base.Close()
+}
+
+// resolve returns the destination address of metadata, the host is
+// resolved by the DNS servers of device.
+func (w *WireGuard) resolve(ctx context.Context, d *wireguard.Device, metadata *M.Metadata) (netip.Addr, error) {
+	if metadata.Host != "" {
+		return d.LookupHost(ctx, metadata.Host)
+	}
+	addr, ok := netip.AddrFromSlice(metadata.DstIP)
+	if !ok {
+		return netip.Addr{}, fmt.Errorf("invalid address: %s", metadata.DstIP)
+	}
+	return addr.Unmap(), nil
+}
+
+func (w *WireGuard) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
+	d, err := w.getDevice()
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := w.resolve(ctx, d, metadata)
+	if err != nil {
+		return nil, err
+	}
+	return d.DialContextTCP(ctx, netip.AddrPortFrom(addr, metadata.DstPort))
+}
+
+func (w *WireGuard) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
+	d, err := w.getDevice()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TCPConnectTimeout)
+	defer cancel()
+
+	addr, err := w.resolve(ctx, d, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	pc, err := d.ListenUDP(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &wgPacketConn{PacketConn: pc, proxy: w, device: d}, nil
+}
+
+type wgPacketConn struct {
+	net.PacketConn
+
+	proxy  *WireGuard
+	device *wireguard.Device
+}
+
+func (pc *wgPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	var udpAddr *net.UDPAddr
+	switch v := addr.(type) {
+	case *net.UDPAddr:
+		udpAddr = v
+	case *M.Addr:
+		ctx, cancel := context.WithTimeout(context.Background(), TCPConnectTimeout)
+		ip, err := pc.proxy.resolve(ctx, pc.device, v.Metadata())
+		cancel()
+		if err != nil {
+			return 0, err
+		}
+		udpAddr = net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip, v.Metadata().DstPort))
+	default:
+		return 0, fmt.Errorf("unsupported address: %s", addr)
+	}
+
+	// The IPv4 addresses must be in 4-byte form for netstack.
+	if ip4 := udpAddr.IP.To4(); ip4 != nil {
+		udpAddr = &net.UDPAddr{IP: ip4, Port: udpAddr.Port}
+	}
+	return pc.PacketConn.WriteTo(b, udpAddr)
+}
@@ -2,6 +2,7 @@ package restapi
 
 var (
 	ErrBadRequest    = newError("Body invalid")
+	ErrNotFound      = newError("Resource not found")
 	ErrUnauthorized  = newError("Unauthorized")
 	ErrUninitialized = newError("Uninitialized")
 )
@@ -0,0 +1,57 @@
+package restapi
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+
+	"github.com/xjasonlyu/tun2socks/v2/proxy"
+	"github.com/xjasonlyu/tun2socks/v2/tunnel"
+)
+
+func init() {
+	registerMountPoint("/groups", groupRouter())
+}
+
+func groupRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", getGroups)
+	r.Get("/{name}", getGroup)
+	return r
+}
+
+type groupInfo struct {
+	Type    string              `json:"type"`
+	Now     string              `json:"now"`
+	Members []proxy.MemberState `json:"members"`
+}
+
+func newGroupInfo(g proxy.Group) *groupInfo {
+	return &groupInfo{
+		Type:    g.Proto().String(),
+		Now:     g.Now(),
+		Members: g.Members(),
+	}
+}
+
+func getGroups(w http.ResponseWriter, r *http.Request) {
+	groups := make(map[string]*groupInfo)
+	for name, p := range tunnel.Proxies() {
+		if g, ok := p.(proxy.Group); ok {
+			groups[name] = newGroupInfo(g)
+		}
+	}
+	render.JSON(w, r, render.M{"groups": groups})
+}
+
+func getGroup(w http.ResponseWriter, r *http.Request) {
+	p, _ := tunnel.Proxy(chi.URLParam(r, "name"))
+	g, ok := p.(proxy.Group)
+	if !ok {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, ErrNotFound)
+		return
+	}
+	render.JSON(w, r, newGroupInfo(g))
+}
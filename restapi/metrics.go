@@ -0,0 +1,127 @@
+package restapi
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gvisor.dev/gvisor/pkg/tcpip"
+
+	"github.com/xjasonlyu/tun2socks/v2/tunnel/statistic"
+)
+
+const metricsNamespace = "tun2socks"
+
+// _labelValueEscaper escapes label values as required by exposition format.
+var _labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// _netstackMetrics are the curated counters of tcpip.Stats, which
+// are looked up by their field paths.
+var _netstackMetrics = []struct {
+	name string
+	path string
+	help string
+}{
+	{"dropped_packets_total", "DroppedPackets", "Packets dropped by netstack."},
+	{"ip_malformed_packets_total", "IP.MalformedPacketsReceived", "IP packets dropped due to malformed header."},
+	{"ip_invalid_destination_total", "IP.InvalidDestinationAddressesReceived", "IP packets dropped due to invalid destination."},
+	{"ip_outgoing_errors_total", "IP.OutgoingPacketErrors", "IP packets failed to be written."},
+	{"tcp_retransmits_total", "TCP.Retransmits", "TCP segments retransmitted."},
+	{"tcp_checksum_errors_total", "TCP.ChecksumErrors", "TCP segments dropped due to bad checksum."},
+	{"tcp_resets_sent_total", "TCP.ResetsSent", "TCP resets sent."},
+	{"udp_checksum_errors_total", "UDP.ChecksumErrors", "UDP packets dropped due to bad checksum."},
+	{"udp_receive_buffer_errors_total", "UDP.ReceiveBufferErrors", "UDP packets dropped due to full receive buffer."},
+	{"udp_malformed_packets_total", "UDP.MalformedPacketsReceived", "UDP packets dropped due to malformed header."},
+}
+
+func init() {
+	registerMountPoint("/metrics", http.HandlerFunc(getMetrics))
+}
+
+func getMetrics(w http.ResponseWriter, r *http.Request) {
+	b := &bytes.Buffer{}
+	writeMetrics(b, statistic.DefaultManager, _stackStatsFunc)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(b.Bytes())
+}
+
+// writeMetrics writes metrics in Prometheus text exposition format.
+func writeMetrics(b *bytes.Buffer, m *statistic.Manager, statsFunc func() tcpip.Stats) {
+	up, down := m.Total()
+	writeHeader(b, "upload_bytes_total", "counter", "Total bytes uploaded.")
+	writeSample(b, "upload_bytes_total", "", up)
+	writeHeader(b, "download_bytes_total", "counter", "Total bytes downloaded.")
+	writeSample(b, "download_bytes_total", "", down)
+
+	tcp, udp := m.Count()
+	writeHeader(b, "connections", "gauge", "Active connections.")
+	writeSample(b, "connections", labels("network", "tcp"), tcp)
+	writeSample(b, "connections", labels("network", "udp"), udp)
+
+	dials := m.DialSnapshot()
+	writeHeader(b, "dials_total", "counter", "Dials through outbounds.")
+	for _, d := range dials {
+		writeSample(b, "dials_total", labels("outbound", d.Outbound, "result", "success"), d.Success)
+		writeSample(b, "dials_total", labels("outbound", d.Outbound, "result", "failure"), d.Failure)
+	}
+	writeHeader(b, "dial_duration_seconds", "histogram", "Latency of successful dials through outbounds.")
+	for _, d := range dials {
+		for i, bound := range statistic.DialBuckets {
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			writeSample(b, "dial_duration_seconds_bucket", labels("outbound", d.Outbound, "le", le), d.Buckets[i])
+		}
+		writeSample(b, "dial_duration_seconds_bucket", labels("outbound", d.Outbound, "le", "+Inf"), d.Success)
+		writeSample(b, "dial_duration_seconds_sum", labels("outbound", d.Outbound), d.Sum.Seconds())
+		writeSample(b, "dial_duration_seconds_count", labels("outbound", d.Outbound), d.Success)
+	}
+
+	if statsFunc == nil {
+		return
+	}
+	stats := statsFunc()
+	for _, metric := range _netstackMetrics {
+		counter := lookupStatCounter(reflect.ValueOf(&stats).Elem(), metric.path)
+		if counter == nil {
+			continue
+		}
+		name := "netstack_" + metric.name
+		writeHeader(b, name, "counter", metric.help)
+		writeSample(b, name, "", counter.Value())
+	}
+}
+
+// lookupStatCounter looks up the *tcpip.StatCounter by field path.
+func lookupStatCounter(value reflect.Value, path string) *tcpip.StatCounter {
+	for _, name := range strings.Split(path, ".") {
+		if value.Kind() != reflect.Struct {
+			return nil
+		}
+		if value = value.FieldByName(name); !value.IsValid() {
+			return nil
+		}
+	}
+	counter, _ := value.Interface().(*tcpip.StatCounter)
+	return counter
+}
+
+func writeHeader(b *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s_%s %s\n", metricsNamespace, name, help)
+	fmt.Fprintf(b, "# TYPE %s_%s %s\n", metricsNamespace, name, typ)
+}
+
+func writeSample(b *bytes.Buffer, name, labels string, value any) {
+	fmt.Fprintf(b, "%s_%s%s %v\n", metricsNamespace, name, labels, value)
+}
+
+// labels formats key-value pairs as Prometheus labels.
+func labels(kv ...string) string {
+	pairs := make([]string, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		pairs = append(pairs, kv[i]+`="`+_labelValueEscaper.Replace(kv[i+1])+`"`)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,47 @@
+package restapi
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gvisor.dev/gvisor/pkg/tcpip"
+
+	"github.com/xjasonlyu/tun2socks/v2/tunnel/statistic"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	m := statistic.NewManager()
+	m.ObserveDial("PROXY", 30*time.Millisecond, nil)
+	m.ObserveDial("PROXY", 2*time.Second, nil)
+	m.ObserveDial("PROXY", time.Second, errors.New("refused"))
+	m.ObserveDial(`a"b`, time.Millisecond, nil)
+
+	stats := tcpip.Stats{}.FillIn()
+	stats.TCP.Retransmits.IncrementBy(3)
+
+	b := &bytes.Buffer{}
+	writeMetrics(b, m, func() tcpip.Stats { return stats })
+	out := b.String()
+
+	for _, line := range []string{
+		"# TYPE tun2socks_upload_bytes_total counter\n",
+		"tun2socks_connections{network=\"tcp\"} 0\n",
+		"tun2socks_dials_total{outbound=\"PROXY\",result=\"success\"} 2\n",
+		"tun2socks_dials_total{outbound=\"PROXY\",result=\"failure\"} 1\n",
+		"# TYPE tun2socks_dial_duration_seconds histogram\n",
+		"tun2socks_dial_duration_seconds_bucket{outbound=\"PROXY\",le=\"0.025\"} 0\n",
+		"tun2socks_dial_duration_seconds_bucket{outbound=\"PROXY\",le=\"0.05\"} 1\n",
+		"tun2socks_dial_duration_seconds_bucket{outbound=\"PROXY\",le=\"2.5\"} 2\n",
+		"tun2socks_dial_duration_seconds_bucket{outbound=\"PROXY\",le=\"+Inf\"} 2\n",
+		"tun2socks_dial_duration_seconds_sum{outbound=\"PROXY\"} 2.03\n",
+		"tun2socks_dial_duration_seconds_count{outbound=\"PROXY\"} 2\n",
+		"tun2socks_dials_total{outbound=\"a\\\"b\",result=\"success\"} 1\n",
+		"tun2socks_netstack_tcp_retransmits_total 3\n",
+		"tun2socks_netstack_dropped_packets_total 0\n",
+	} {
+		assert.Contains(t, out, line)
+	}
+}
@@ -0,0 +1,105 @@
+package restapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+
+	"github.com/xjasonlyu/tun2socks/v2/log"
+	"github.com/xjasonlyu/tun2socks/v2/proxy"
+	"github.com/xjasonlyu/tun2socks/v2/tunnel"
+	"github.com/xjasonlyu/tun2socks/v2/tunnel/statistic"
+)
+
+func init() {
+	registerMountPoint("/proxies", proxyRouter())
+	registerMountPoint("/proxy", defaultProxyRouter())
+}
+
+func proxyRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", getProxies)
+	r.Get("/{name}", getProxy)
+	return r
+}
+
+func defaultProxyRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/", getDefaultProxy)
+	r.Put("/", updateDefaultProxy)
+	return r
+}
+
+type proxyInfo struct {
+	Type string `json:"type"`
+	Addr string `json:"addr"`
+
+	// Pool is the statistics of connection pool if enabled.
+	Pool *proxy.PoolStats `json:"pool,omitempty"`
+}
+
+func newProxyInfo(p proxy.Proxy) *proxyInfo {
+	info := &proxyInfo{
+		Type: p.Proto().String(),
+		Addr: p.Addr(),
+	}
+	if stats, ok := proxy.PoolStatsOf(p); ok {
+		info.Pool = &stats
+	}
+	return info
+}
+
+func getProxies(w http.ResponseWriter, r *http.Request) {
+	proxies := make(map[string]*proxyInfo)
+	for name, p := range tunnel.Proxies() {
+		proxies[name] = newProxyInfo(p)
+	}
+	render.JSON(w, r, render.M{
+		"now":     tunnel.Default(),
+		"proxies": proxies,
+	})
+}
+
+func getProxy(w http.ResponseWriter, r *http.Request) {
+	p, ok := tunnel.Proxy(chi.URLParam(r, "name"))
+	if !ok {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, ErrNotFound)
+		return
+	}
+	render.JSON(w, r, newProxyInfo(p))
+}
+
+func getDefaultProxy(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, render.M{"name": tunnel.Default()})
+}
+
+func updateDefaultProxy(w http.ResponseWriter, r *http.Request) {
+	req := struct {
+		Name string `json:"name"`
+		// CloseConnections closes the connections routed to the
+		// previous default proxy, otherwise they are drained.
+		CloseConnections bool `json:"closeConnections"`
+	}{}
+	if err := render.DecodeJSON(r.Body, &req); err != nil {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, ErrBadRequest)
+		return
+	}
+
+	now := time.Now()
+	previous, err := tunnel.SetDefault(req.Name)
+	if err != nil {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, ErrNotFound)
+		return
+	}
+	log.Infof("[RESTAPI] switch default proxy to %s", req.Name)
+
+	if req.CloseConnections && previous != req.Name {
+		statistic.DefaultManager.CloseDefault(previous, now)
+	}
+	render.NoContent(w, r)
+}
@@ -0,0 +1,61 @@
+package rule
+
+import (
+	"fmt"
+	"strings"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+var _ Rule = (*DomainRule)(nil)
+
+// DomainRule matches the host of metadata, which is available
+// when it is recovered by fake-ip DNS or sniffing.
+type DomainRule struct {
+	domain   string
+	typ      Type
+	outbound string
+}
+
+func NewDomain(s, outbound string, typ Type) (*DomainRule, error) {
+	domain := strings.ToLower(strings.TrimSuffix(s, "."))
+	if domain == "" {
+		return nil, fmt.Errorf("empty domain: %s", s)
+	}
+
+	return &DomainRule{
+		domain:   domain,
+		typ:      typ,
+		outbound: outbound,
+	}, nil
+}
+
+func (r *DomainRule) Type() Type {
+	return r.typ
+}
+
+func (r *DomainRule) Match(metadata *M.Metadata) bool {
+	if metadata.Host == "" {
+		return false
+	}
+
+	host := strings.ToLower(metadata.Host)
+	switch r.typ {
+	case Domain:
+		return host == r.domain
+	case DomainSuffix:
+		return host == r.domain || strings.HasSuffix(host, "."+r.domain)
+	case DomainKeyword:
+		return strings.Contains(host, r.domain)
+	default:
+		return false
+	}
+}
+
+func (r *DomainRule) Outbound() string {
+	return r.outbound
+}
+
+func (r *DomainRule) Payload() string {
+	return r.domain
+}
@@ -0,0 +1,51 @@
+package rule
+
+import (
+	"net"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+var _ Rule = (*IPCIDRRule)(nil)
+
+type IPCIDRRule struct {
+	ipNet    *net.IPNet
+	outbound string
+	isSource bool
+}
+
+func NewIPCIDR(s, outbound string, isSource bool) (*IPCIDRRule, error) {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IPCIDRRule{
+		ipNet:    ipNet,
+		outbound: outbound,
+		isSource: isSource,
+	}, nil
+}
+
+func (r *IPCIDRRule) Type() Type {
+	if r.isSource {
+		return SrcIPCIDR
+	}
+	return IPCIDR
+}
+
+func (r *IPCIDRRule) Match(metadata *M.Metadata) bool {
+	ip := metadata.DstIP
+	if r.isSource {
+		ip = metadata.SrcIP
+	}
+	return ip != nil && r.ipNet.Contains(ip)
+}
+
+func (r *IPCIDRRule) Outbound() string {
+	return r.outbound
+}
+
+func (r *IPCIDRRule) Payload() string {
+	return r.ipNet.String()
+}
@@ -0,0 +1,33 @@
+package rule
+
+import (
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+var _ Rule = (*MatchRule)(nil)
+
+// MatchRule matches all connections, it is usually
+// used as the final fallback of a rule list.
+type MatchRule struct {
+	outbound string
+}
+
+func NewMatch(outbound string) *MatchRule {
+	return &MatchRule{outbound: outbound}
+}
+
+func (r *MatchRule) Type() Type {
+	return Match
+}
+
+func (r *MatchRule) Match(*M.Metadata) bool {
+	return true
+}
+
+func (r *MatchRule) Outbound() string {
+	return r.outbound
+}
+
+func (r *MatchRule) Payload() string {
+	return ""
+}
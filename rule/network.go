@@ -0,0 +1,48 @@
+package rule
+
+import (
+	"fmt"
+	"strings"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+var _ Rule = (*NetworkRule)(nil)
+
+type NetworkRule struct {
+	network  M.Network
+	outbound string
+}
+
+func NewNetwork(s, outbound string) (*NetworkRule, error) {
+	var network M.Network
+	switch strings.ToLower(s) {
+	case M.TCP.String():
+		network = M.TCP
+	case M.UDP.String():
+		network = M.UDP
+	default:
+		return nil, fmt.Errorf("unsupported network: %s", s)
+	}
+
+	return &NetworkRule{
+		network:  network,
+		outbound: outbound,
+	}, nil
+}
+
+func (r *NetworkRule) Type() Type {
+	return Network
+}
+
+func (r *NetworkRule) Match(metadata *M.Metadata) bool {
+	return metadata.Network == r.network
+}
+
+func (r *NetworkRule) Outbound() string {
+	return r.outbound
+}
+
+func (r *NetworkRule) Payload() string {
+	return r.network.String()
+}
@@ -0,0 +1,53 @@
+package rule
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parse parses a rule from string in "TYPE,PAYLOAD,OUTBOUND"
+// format, or "MATCH,OUTBOUND" for the final fallback rule.
+func Parse(s string) (Rule, error) {
+	parts := strings.Split(s, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	if strings.EqualFold(parts[0], Match.String()) {
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid rule: %s", s)
+		}
+		return NewMatch(parts[1]), nil
+	}
+
+	if len(parts) < 3 || parts[len(parts)-1] == "" {
+		return nil, fmt.Errorf("invalid rule: %s", s)
+	}
+
+	// Port lists are comma separated as well, so the payload
+	// is everything between the rule type and the outbound.
+	typ := strings.ToUpper(parts[0])
+	payload := strings.Join(parts[1:len(parts)-1], ",")
+	outbound := parts[len(parts)-1]
+
+	switch typ {
+	case Domain.String():
+		return NewDomain(payload, outbound, Domain)
+	case DomainSuffix.String():
+		return NewDomain(payload, outbound, DomainSuffix)
+	case DomainKeyword.String():
+		return NewDomain(payload, outbound, DomainKeyword)
+	case IPCIDR.String():
+		return NewIPCIDR(payload, outbound, false)
+	case SrcIPCIDR.String():
+		return NewIPCIDR(payload, outbound, true)
+	case DstPort.String():
+		return NewPort(payload, outbound, false)
+	case SrcPort.String():
+		return NewPort(payload, outbound, true)
+	case Network.String():
+		return NewNetwork(payload, outbound)
+	default:
+		return nil, fmt.Errorf("unsupported rule type: %s", parts[0])
+	}
+}
@@ -0,0 +1,90 @@
+package rule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+var _ Rule = (*PortRule)(nil)
+
+type portRange struct {
+	start uint16
+	end   uint16
+}
+
+type PortRule struct {
+	payload  string
+	ranges   []portRange
+	outbound string
+	isSource bool
+}
+
+// NewPort creates a PortRule from comma separated ports or
+// port ranges, e.g. "22,80,443,8000-9000".
+func NewPort(s, outbound string, isSource bool) (*PortRule, error) {
+	var ranges []portRange
+	for _, p := range strings.Split(s, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		lo, hi, found := strings.Cut(p, "-")
+		start, err := strconv.ParseUint(strings.TrimSpace(lo), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port: %s", p)
+		}
+		end := start
+		if found {
+			if end, err = strconv.ParseUint(strings.TrimSpace(hi), 10, 16); err != nil {
+				return nil, fmt.Errorf("invalid port: %s", p)
+			}
+		}
+		if start > end {
+			return nil, fmt.Errorf("invalid port range: %s", p)
+		}
+		ranges = append(ranges, portRange{start: uint16(start), end: uint16(end)})
+	}
+
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("empty port: %s", s)
+	}
+
+	return &PortRule{
+		payload:  s,
+		ranges:   ranges,
+		outbound: outbound,
+		isSource: isSource,
+	}, nil
+}
+
+func (r *PortRule) Type() Type {
+	if r.isSource {
+		return SrcPort
+	}
+	return DstPort
+}
+
+func (r *PortRule) Match(metadata *M.Metadata) bool {
+	port := metadata.DstPort
+	if r.isSource {
+		port = metadata.SrcPort
+	}
+	for _, pr := range r.ranges {
+		if port >= pr.start && port <= pr.end {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *PortRule) Outbound() string {
+	return r.outbound
+}
+
+func (r *PortRule) Payload() string {
+	return r.payload
+}
@@ -0,0 +1,67 @@
+// Package rule provides connection matchers used to route traffic to outbounds.
+package rule
+
+import (
+	"fmt"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+const (
+	Domain Type = iota
+	DomainSuffix
+	DomainKeyword
+	IPCIDR
+	SrcIPCIDR
+	DstPort
+	SrcPort
+	Network
+	Match
+)
+
+type Type uint8
+
+func (t Type) String() string {
+	switch t {
+	case Domain:
+		return "DOMAIN"
+	case DomainSuffix:
+		return "DOMAIN-SUFFIX"
+	case DomainKeyword:
+		return "DOMAIN-KEYWORD"
+	case IPCIDR:
+		return "IP-CIDR"
+	case SrcIPCIDR:
+		return "SRC-IP-CIDR"
+	case DstPort:
+		return "DST-PORT"
+	case SrcPort:
+		return "SRC-PORT"
+	case Network:
+		return "NETWORK"
+	case Match:
+		return "MATCH"
+	default:
+		return fmt.Sprintf("type(%d)", t)
+	}
+}
+
+func (t Type) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Rule matches connections by their metadata and names the
+// outbound those connections should be dialed through.
+type Rule interface {
+	// Type returns the type of Rule.
+	Type() Type
+
+	// Match reports whether the metadata satisfies the Rule.
+	Match(*M.Metadata) bool
+
+	// Outbound returns the name of the target outbound.
+	Outbound() string
+
+	// Payload returns the raw condition of Rule.
+	Payload() string
+}
@@ -0,0 +1,82 @@
+package rule
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+func TestParse(t *testing.T) {
+	for _, s := range []string{
+		"DOMAIN,www.example.com,PROXY",
+		"DOMAIN-SUFFIX,example.com,PROXY",
+		"domain-keyword,google,PROXY",
+		"IP-CIDR,10.0.0.0/8,DIRECT",
+		"SRC-IP-CIDR,192.168.1.0/24,PROXY",
+		"DST-PORT,22,80,8000-9000,DIRECT",
+		"src-port,1024-65535,PROXY",
+		"NETWORK,udp,REJECT",
+		"MATCH,PROXY",
+	} {
+		_, err := Parse(s)
+		assert.NoError(t, err, s)
+	}
+
+	for _, s := range []string{
+		"",
+		"MATCH",
+		"MATCH,",
+		"IP-CIDR,10.0.0.0/8",
+		"IP-CIDR,10.0.0.0/33,DIRECT",
+		"DST-PORT,65536,DIRECT",
+		"DST-PORT,9000-8000,DIRECT",
+		"NETWORK,icmp,DIRECT",
+		"DOMAIN,,DIRECT",
+		"GEOIP,CN,DIRECT",
+	} {
+		_, err := Parse(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	metadata := &M.Metadata{
+		Network: M.TCP,
+		SrcIP:   net.ParseIP("192.168.1.2"),
+		SrcPort: 50000,
+		DstIP:   net.ParseIP("10.1.2.3"),
+		DstPort: 8080,
+		Host:    "www.Example.com",
+	}
+
+	for s, expected := range map[string]bool{
+		"IP-CIDR,10.0.0.0/8,DIRECT":          true,
+		"IP-CIDR,172.16.0.0/12,DIRECT":       false,
+		"SRC-IP-CIDR,192.168.1.0/24,DIRECT":  true,
+		"SRC-IP-CIDR,10.0.0.0/8,DIRECT":      false,
+		"DST-PORT,80,443,DIRECT":             false,
+		"DST-PORT,22,8000-9000,DIRECT":       true,
+		"SRC-PORT,1024-65535,DIRECT":         true,
+		"NETWORK,tcp,DIRECT":                 true,
+		"NETWORK,udp,DIRECT":                 false,
+		"MATCH,DIRECT":                       true,
+		"IP-CIDR,fd00::/8,DIRECT":            false,
+		"SRC-IP-CIDR,192.168.1.2/32,DIRECT":  true,
+		"DST-PORT, 8080 , 9090-9091 ,DIRECT": true,
+		"DOMAIN,www.example.com,DIRECT":      true,
+		"DOMAIN,example.com,DIRECT":          false,
+		"DOMAIN-SUFFIX,example.com,DIRECT":   true,
+		"DOMAIN-SUFFIX,ample.com,DIRECT":     false,
+		"DOMAIN-KEYWORD,exam,DIRECT":         true,
+		"DOMAIN-KEYWORD,google,DIRECT":       false,
+	} {
+		r, err := Parse(s)
+		if assert.NoError(t, err, s) {
+			assert.Equal(t, expected, r.Match(metadata), s)
+			assert.Equal(t, "DIRECT", r.Outbound(), s)
+		}
+	}
+}
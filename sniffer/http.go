@@ -0,0 +1,68 @@
+package sniffer
+
+import (
+	"bytes"
+	"net"
+	"strings"
+)
+
+var _httpMethods = []string{
+	"GET", "POST", "HEAD", "PUT", "DELETE", "OPTIONS", "PATCH", "CONNECT", "TRACE",
+}
+
+// SniffHTTP sniffs the Host header from HTTP/1.x request.
+func SniffHTTP(b []byte) (string, error) {
+	if err := checkMethod(b); err != nil {
+		return "", err
+	}
+
+	headerEnd := bytes.Index(b, []byte("\r\n\r\n"))
+	if headerEnd >= 0 {
+		b = b[:headerEnd+2]
+	}
+
+	lines := bytes.Split(b, []byte("\r\n"))
+	if len(lines) == 1 {
+		return "", ErrNeedMore
+	}
+	if !bytes.HasSuffix(lines[0], []byte(" HTTP/1.0")) && !bytes.HasSuffix(lines[0], []byte(" HTTP/1.1")) {
+		return "", ErrNotMatched
+	}
+
+	// The last line is incomplete unless the header end is found.
+	for _, line := range lines[1 : len(lines)-1] {
+		key, value, found := bytes.Cut(line, []byte(":"))
+		if !found || !strings.EqualFold(string(bytes.TrimSpace(key)), "Host") {
+			continue
+		}
+
+		host := strings.TrimSpace(string(value))
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		return validHost(strings.Trim(host, "[]"))
+	}
+
+	if headerEnd >= 0 {
+		return "", ErrNotMatched
+	}
+	return "", ErrNeedMore
+}
+
+// checkMethod checks the request method in a fast path,
+// as most of the sniffed streams are not HTTP requests.
+func checkMethod(b []byte) error {
+	for _, m := range _httpMethods {
+		n := len(m) + 1
+		if len(b) < n {
+			if strings.HasPrefix(m+" ", string(b)) {
+				return ErrNeedMore
+			}
+			continue
+		}
+		if string(b[:n]) == m+" " {
+			return nil
+		}
+	}
+	return ErrNotMatched
+}
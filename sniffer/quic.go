@@ -0,0 +1,304 @@
+package sniffer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// QUIC versions as defined in RFC 9000 and RFC 9369.
+const (
+	quicVersion1 = 0x00000001
+	quicVersion2 = 0x6b3343cf
+)
+
+const (
+	// maxCryptoSize is the maximum size of CRYPTO data to keep.
+	maxCryptoSize = 1 << 16
+
+	// hpSampleLen is the size of header protection sample.
+	hpSampleLen = 16
+)
+
+var (
+	// Initial salts defined in RFC 9001 section 5.2 and RFC 9369 section 3.3.1.
+	_quicSaltV1 = []byte{
+		0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17,
+		0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a,
+	}
+	_quicSaltV2 = []byte{
+		0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93,
+		0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9,
+	}
+)
+
+// QUICSniffer sniffs the server name indication from QUIC Initial
+// packets. As a ClientHello may be split across several packets,
+// the CRYPTO frames are kept until the ClientHello is complete.
+type QUICSniffer struct {
+	frames map[uint64][]byte
+	size   int
+}
+
+// Sniff feeds a UDP datagram sent by client to QUICSniffer, it
+// returns ErrNeedMore if more Initial packets are required.
+func (s *QUICSniffer) Sniff(datagram []byte) (string, error) {
+	found := false
+	for len(datagram) > 0 {
+		n, err := s.feed(datagram)
+		if err != nil {
+			break
+		}
+		found = true
+		datagram = datagram[n:]
+	}
+
+	if !found {
+		return "", ErrNotMatched
+	}
+
+	host, err := SniffClientHello(s.assemble())
+	if err == ErrNeedMore && s.size >= maxCryptoSize {
+		return "", ErrNotMatched
+	}
+	return host, err
+}
+
+// feed decrypts a client Initial packet at the beginning of b and
+// collects its CRYPTO frames, it returns the length of the packet.
+func (s *QUICSniffer) feed(b []byte) (int, error) {
+	// Long Header Packet {
+	//   Header Form (1) = 1,
+	//   Fixed Bit (1) = 1,
+	//   Long Packet Type (2),
+	//   Type-Specific Bits (4),
+	//   Version (32),
+	//   Destination Connection ID Length (8),
+	//   Destination Connection ID (0..160),
+	//   Source Connection ID Length (8),
+	//   Source Connection ID (0..160),
+	//   Type-Specific Payload (..),
+	// }
+	if len(b) < 7 || b[0]&0xc0 != 0xc0 {
+		return 0, ErrNotMatched
+	}
+
+	var (
+		version   = binary.BigEndian.Uint32(b[1:5])
+		salt      []byte
+		labelKey  string
+		labelIV   string
+		labelHP   string
+		isInitial bool
+	)
+	switch version {
+	case quicVersion1:
+		salt, labelKey, labelIV, labelHP = _quicSaltV1, "quic key", "quic iv", "quic hp"
+		isInitial = b[0]&0x30 == 0x00
+	case quicVersion2:
+		salt, labelKey, labelIV, labelHP = _quicSaltV2, "quicv2 key", "quicv2 iv", "quicv2 hp"
+		isInitial = b[0]&0x30 == 0x10
+	default:
+		return 0, ErrNotMatched
+	}
+	if !isInitial {
+		return 0, ErrNotMatched
+	}
+
+	r := reader(b[5:])
+	dcid, ok := r.vector8()
+	if !ok || len(dcid) > 20 || !r.skipVector8() /* SCID */ {
+		return 0, ErrNotMatched
+	}
+
+	// The lengths are checked before converted to int, which may
+	// overflow on 32-bit platforms.
+	tokenLen, ok := r.varint()
+	if !ok || tokenLen > uint64(len(r)) || !r.skip(int(tokenLen)) {
+		return 0, ErrNotMatched
+	}
+
+	length, ok := r.varint()
+	if !ok || length > uint64(len(r)) {
+		return 0, ErrNotMatched
+	}
+
+	pnOffset := len(b) - len(r)
+	end := pnOffset + int(length)
+	if pnOffset+4+hpSampleLen > end {
+		return 0, ErrNotMatched
+	}
+
+	initialSecret := hkdf.Extract(sha256.New, dcid, salt)
+	clientSecret := hkdfExpandLabel(initialSecret, "client in", sha256.Size)
+	key := hkdfExpandLabel(clientSecret, labelKey, 16)
+	iv := hkdfExpandLabel(clientSecret, labelIV, 12)
+	hp := hkdfExpandLabel(clientSecret, labelHP, 16)
+
+	// Remove header protection on a copy, the datagram
+	// is forwarded to remote after sniffing.
+	header := make([]byte, end)
+	copy(header, b[:end])
+
+	block, err := aes.NewCipher(hp)
+	if err != nil {
+		return 0, err
+	}
+	mask := make([]byte, aes.BlockSize)
+	block.Encrypt(mask, header[pnOffset+4:pnOffset+4+hpSampleLen])
+
+	header[0] ^= mask[0] & 0x0f
+	pnLen := int(header[0]&0x03) + 1
+
+	var pn uint64
+	for i := 0; i < pnLen; i++ {
+		header[pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(header[pnOffset+i])
+	}
+
+	block, err = aes.NewCipher(key)
+	if err != nil {
+		return 0, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return 0, err
+	}
+
+	nonce := iv
+	for i := 0; i < 8; i++ {
+		nonce[len(nonce)-1-i] ^= byte(pn >> (8 * i))
+	}
+
+	payload, err := aead.Open(nil, nonce, header[pnOffset+pnLen:], header[:pnOffset+pnLen])
+	if err != nil {
+		return 0, ErrNotMatched
+	}
+
+	if err = s.parseFrames(payload); err != nil {
+		return 0, err
+	}
+	return end, nil
+}
+
+func (s *QUICSniffer) parseFrames(b []byte) error {
+	r := reader(b)
+	for len(r) > 0 {
+		typ, _ := r.varint()
+		switch typ {
+		case 0x00 /* PADDING */, 0x01 /* PING */ :
+		case 0x02, 0x03 /* ACK */ :
+			// Largest Acknowledged, ACK Delay, ACK Range Count, First ACK Range
+			var fields [4]uint64
+			for i := range fields {
+				v, ok := r.varint()
+				if !ok {
+					return ErrNotMatched
+				}
+				fields[i] = v
+			}
+			// Gap, ACK Range Length
+			for i := uint64(0); i < fields[2]*2; i++ {
+				if _, ok := r.varint(); !ok {
+					return ErrNotMatched
+				}
+			}
+			if typ == 0x03 /* ECN Counts */ {
+				for i := 0; i < 3; i++ {
+					if _, ok := r.varint(); !ok {
+						return ErrNotMatched
+					}
+				}
+			}
+		case 0x06 /* CRYPTO */ :
+			offset, ok := r.varint()
+			if !ok {
+				return ErrNotMatched
+			}
+			length, ok := r.varint()
+			if !ok || length > uint64(len(r)) {
+				return ErrNotMatched
+			}
+			if offset+length > maxCryptoSize {
+				return ErrNotMatched
+			}
+
+			if s.frames == nil {
+				s.frames = make(map[uint64][]byte)
+			}
+			if _, exist := s.frames[offset]; !exist {
+				s.frames[offset] = append([]byte(nil), r[:length]...)
+				s.size += int(length)
+			}
+			r = r[length:]
+		default:
+			// Frames other than these are not expected in
+			// client Initial packets before ClientHello.
+			return nil
+		}
+	}
+	return nil
+}
+
+// assemble returns the contiguous CRYPTO data from offset zero.
+func (s *QUICSniffer) assemble() []byte {
+	offsets := make([]uint64, 0, len(s.frames))
+	for offset := range s.frames {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	var data []byte
+	for _, offset := range offsets {
+		if offset > uint64(len(data)) {
+			break
+		}
+		frame := s.frames[offset]
+		if end := offset + uint64(len(frame)); end > uint64(len(data)) {
+			data = append(data, frame[uint64(len(data))-offset:]...)
+		}
+	}
+	return data
+}
+
+// varint reads a variable-length integer as defined in RFC 9000 section 16.
+func (r *reader) varint() (uint64, bool) {
+	if len(*r) < 1 {
+		return 0, false
+	}
+
+	n := 1 << ((*r)[0] >> 6)
+	if len(*r) < n {
+		return 0, false
+	}
+
+	v := uint64((*r)[0] & 0x3f)
+	for i := 1; i < n; i++ {
+		v = v<<8 | uint64((*r)[i])
+	}
+	*r = (*r)[n:]
+	return v, true
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label as defined in RFC 8446
+// section 7.1 with empty context.
+func hkdfExpandLabel(secret []byte, label string, length int) []byte {
+	label = "tls13 " + label
+
+	info := make([]byte, 0, 2+1+len(label)+1)
+	info = binary.BigEndian.AppendUint16(info, uint16(length))
+	info = append(info, byte(len(label)))
+	info = append(info, label...)
+	info = append(info, 0)
+
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(sha256.New, secret, info), out); err != nil {
+		panic(err)
+	}
+	return out
+}
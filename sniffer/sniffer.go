@@ -0,0 +1,48 @@
+// Package sniffer provides functions to recover destination domain
+// names from the first bytes sent by clients.
+package sniffer
+
+import (
+	"errors"
+	"net"
+)
+
+var (
+	// ErrNeedMore indicates that the data is too short to be sniffed.
+	ErrNeedMore = errors.New("need more data")
+
+	// ErrNotMatched indicates that the data is not of the protocol.
+	ErrNotMatched = errors.New("protocol not matched")
+)
+
+// SniffStream sniffs the domain name from the beginning of a TCP
+// stream, TLS ClientHello and HTTP/1.x request are supported.
+func SniffStream(b []byte) (string, error) {
+	needMore := false
+	for _, sniff := range []func([]byte) (string, error){
+		SniffTLS,
+		SniffHTTP,
+	} {
+		host, err := sniff(b)
+		if err == nil {
+			return host, nil
+		}
+		if errors.Is(err, ErrNeedMore) {
+			needMore = true
+		}
+	}
+
+	if needMore {
+		return "", ErrNeedMore
+	}
+	return "", ErrNotMatched
+}
+
+// validHost validates the sniffed host, IP literals are not
+// considered as domain names.
+func validHost(host string) (string, error) {
+	if host == "" || len(host) > 255 || net.ParseIP(host) != nil {
+		return "", ErrNotMatched
+	}
+	return host, nil
+}
@@ -0,0 +1,163 @@
+package sniffer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/hkdf"
+)
+
+func clientHello(t *testing.T, serverName string) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		tls.Client(client, &tls.Config{ServerName: serverName}).Handshake()
+		client.Close()
+	}()
+
+	buf := make([]byte, 4096)
+	n, err := server.Read(buf)
+	require.NoError(t, err)
+	return buf[:n]
+}
+
+func TestSniffTLS(t *testing.T) {
+	hello := clientHello(t, "www.example.com")
+
+	host, err := SniffTLS(hello)
+	assert.NoError(t, err)
+	assert.Equal(t, "www.example.com", host)
+
+	_, err = SniffTLS(hello[:len(hello)/2])
+	assert.ErrorIs(t, err, ErrNeedMore)
+
+	_, err = SniffTLS([]byte("SSH-2.0-OpenSSH_9.0\r\n"))
+	assert.ErrorIs(t, err, ErrNotMatched)
+}
+
+func TestSniffHTTP(t *testing.T) {
+	for req, expected := range map[string]string{
+		"GET / HTTP/1.1\r\nHost: example.com\r\n\r\n":                     "example.com",
+		"POST /a HTTP/1.1\r\nUser-Agent: x\r\nhost: example.com:8080\r\n": "example.com",
+	} {
+		host, err := SniffHTTP([]byte(req))
+		assert.NoError(t, err, req)
+		assert.Equal(t, expected, host, req)
+	}
+
+	for req, expected := range map[string]error{
+		"GE":                                      ErrNeedMore,
+		"GET / HTTP/1.1\r\nHost: exa":             ErrNeedMore,
+		"GET / HTTP/1.1\r\nAccept: */*\r\n":       ErrNeedMore,
+		"GET / HTTP/1.1\r\n\r\n":                  ErrNotMatched,
+		"GET / HTTP/1.1\r\nHost: 1.1.1.1\r\n\r\n": ErrNotMatched,
+		"HELO example.com\r\n":                    ErrNotMatched,
+		"GET / SPDY/3\r\nHost: a\r\n\r\n":         ErrNotMatched,
+	} {
+		_, err := SniffHTTP([]byte(req))
+		assert.ErrorIs(t, err, expected, req)
+	}
+}
+
+func TestQUICInitialKeys(t *testing.T) {
+	// Test vectors from RFC 9001 appendix A.1.
+	dcid, _ := hex.DecodeString("8394c8f03e515708")
+	clientSecret := hkdfExpandLabel(hkdf.Extract(sha256.New, dcid, _quicSaltV1), "client in", sha256.Size)
+
+	assert.Equal(t, "1f369613dd76d5467730efcbe3b1a22d", hex.EncodeToString(hkdfExpandLabel(clientSecret, "quic key", 16)))
+	assert.Equal(t, "fa044b2f42a3fd3b46fb255c", hex.EncodeToString(hkdfExpandLabel(clientSecret, "quic iv", 12)))
+	assert.Equal(t, "9f50449e04a0e810283a1e9933adedd2", hex.EncodeToString(hkdfExpandLabel(clientSecret, "quic hp", 16)))
+}
+
+func TestSniffQUIC(t *testing.T) {
+	record := clientHello(t, "quic.example.com")
+	hello := record[5:] /* strip TLS record header */
+
+	// Split ClientHello into two Initial packets.
+	half := len(hello) / 2
+	first := sealInitial(t, 0, cryptoFrame(0, hello[:half]))
+	second := sealInitial(t, 1, cryptoFrame(uint64(half), hello[half:]))
+
+	s := &QUICSniffer{}
+	_, err := s.Sniff(first)
+	assert.ErrorIs(t, err, ErrNeedMore)
+
+	host, err := s.Sniff(second)
+	assert.NoError(t, err)
+	assert.Equal(t, "quic.example.com", host)
+
+	_, err = (&QUICSniffer{}).Sniff([]byte{0x40, 0x01, 0x02, 0x03})
+	assert.ErrorIs(t, err, ErrNotMatched)
+
+	// The oversized token length and packet length are rejected.
+	header := []byte{0xc0, 0, 0, 0, 1, 0 /* DCID */, 0 /* SCID */}
+	huge := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	for _, packet := range [][]byte{
+		append(append(header, huge...), make([]byte, 64)...),
+		append(append(append(header, 0 /* Token */), huge...), make([]byte, 64)...),
+	} {
+		_, err = (&QUICSniffer{}).Sniff(packet)
+		assert.ErrorIs(t, err, ErrNotMatched)
+	}
+}
+
+func cryptoFrame(offset uint64, data []byte) []byte {
+	b := []byte{0x06}
+	b = appendVarint(b, offset)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return binary.BigEndian.AppendUint16(b, uint16(v)|0x4000)
+	default:
+		return binary.BigEndian.AppendUint32(b, uint32(v)|0x80000000)
+	}
+}
+
+// sealInitial builds a protected QUIC v1 client Initial packet.
+func sealInitial(t *testing.T, pn byte, payload []byte) []byte {
+	dcid := []byte{0x83, 0x94, 0xc8, 0xf0, 0x3e, 0x51, 0x57, 0x08}
+	clientSecret := hkdfExpandLabel(hkdf.Extract(sha256.New, dcid, _quicSaltV1), "client in", sha256.Size)
+	key := hkdfExpandLabel(clientSecret, "quic key", 16)
+	iv := hkdfExpandLabel(clientSecret, "quic iv", 12)
+	hp := hkdfExpandLabel(clientSecret, "quic hp", 16)
+
+	// pad payload to make sure there are enough bytes for sampling.
+	payload = append(payload, make([]byte, 32)...)
+
+	header := []byte{0xc0 /* 1-byte packet number */, 0, 0, 0, 1, byte(len(dcid))}
+	header = append(header, dcid...)
+	header = append(header, 0 /* SCID */, 0 /* Token */)
+	header = appendVarint(header, uint64(1+len(payload)+16))
+	pnOffset := len(header)
+	header = append(header, pn)
+
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	iv[len(iv)-1] ^= pn
+	packet := aead.Seal(header, iv, payload, header)
+
+	block, err = aes.NewCipher(hp)
+	require.NoError(t, err)
+	mask := make([]byte, aes.BlockSize)
+	block.Encrypt(mask, packet[pnOffset+4:pnOffset+4+hpSampleLen])
+	packet[0] ^= mask[0] & 0x0f
+	packet[pnOffset] ^= mask[1]
+	return packet
+}
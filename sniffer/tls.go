@@ -0,0 +1,156 @@
+package sniffer
+
+import (
+	"encoding/binary"
+)
+
+const (
+	recordTypeHandshake    = 0x16
+	handshakeTypeHello     = 0x01
+	extensionServerName    = 0x0000
+	serverNameTypeHostName = 0x00
+)
+
+// SniffTLS sniffs the server name indication from TLS ClientHello.
+func SniffTLS(b []byte) (string, error) {
+	// ContentType, ProtocolVersion, Length
+	if len(b) < 5 {
+		if len(b) > 0 && b[0] != recordTypeHandshake {
+			return "", ErrNotMatched
+		}
+		return "", ErrNeedMore
+	}
+
+	if b[0] != recordTypeHandshake || b[1] != 0x03 {
+		return "", ErrNotMatched
+	}
+
+	length := int(binary.BigEndian.Uint16(b[3:5]))
+	if len(b) < 5+length {
+		return "", ErrNeedMore
+	}
+	return SniffClientHello(b[5 : 5+length])
+}
+
+// SniffClientHello sniffs the server name indication from TLS
+// handshake message, which is not wrapped in TLS record layer,
+// e.g. the ClientHello carried in QUIC CRYPTO frames.
+func SniffClientHello(b []byte) (string, error) {
+	// HandshakeType, Length
+	if len(b) < 4 {
+		return "", ErrNeedMore
+	}
+	if b[0] != handshakeTypeHello {
+		return "", ErrNotMatched
+	}
+
+	length := int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+	if len(b) < 4+length {
+		return "", ErrNeedMore
+	}
+
+	r := reader(b[4 : 4+length])
+	if !r.skip(2+32) /* ProtocolVersion, Random */ ||
+		!r.skipVector8() /* SessionID */ ||
+		!r.skipVector16() /* CipherSuites */ ||
+		!r.skipVector8() /* CompressionMethods */ {
+		return "", ErrNotMatched
+	}
+
+	extensions, ok := r.vector16()
+	if !ok {
+		return "", ErrNotMatched
+	}
+
+	for len(extensions) > 0 {
+		typ, ok := extensions.uint16()
+		if !ok {
+			return "", ErrNotMatched
+		}
+		data, ok := extensions.vector16()
+		if !ok {
+			return "", ErrNotMatched
+		}
+		if typ != extensionServerName {
+			continue
+		}
+
+		names, ok := data.vector16()
+		if !ok {
+			return "", ErrNotMatched
+		}
+		for len(names) > 0 {
+			nameType, ok := names.uint8()
+			if !ok {
+				return "", ErrNotMatched
+			}
+			name, ok := names.vector16()
+			if !ok {
+				return "", ErrNotMatched
+			}
+			if nameType == serverNameTypeHostName {
+				return validHost(string(name))
+			}
+		}
+	}
+	return "", ErrNotMatched
+}
+
+// reader is a helper to read TLS presentation language vectors.
+type reader []byte
+
+func (r *reader) skip(n int) bool {
+	if len(*r) < n {
+		return false
+	}
+	*r = (*r)[n:]
+	return true
+}
+
+func (r *reader) uint8() (uint8, bool) {
+	if len(*r) < 1 {
+		return 0, false
+	}
+	v := (*r)[0]
+	*r = (*r)[1:]
+	return v, true
+}
+
+func (r *reader) uint16() (uint16, bool) {
+	if len(*r) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*r)
+	*r = (*r)[2:]
+	return v, true
+}
+
+func (r *reader) vector8() (reader, bool) {
+	n, ok := r.uint8()
+	if !ok || len(*r) < int(n) {
+		return nil, false
+	}
+	v := (*r)[:n]
+	*r = (*r)[n:]
+	return v, true
+}
+
+func (r *reader) vector16() (reader, bool) {
+	n, ok := r.uint16()
+	if !ok || len(*r) < int(n) {
+		return nil, false
+	}
+	v := (*r)[:n]
+	*r = (*r)[n:]
+	return v, true
+}
+
+func (r *reader) skipVector8() bool {
+	_, ok := r.vector8()
+	return ok
+}
+
+func (r *reader) skipVector16() bool {
+	_, ok := r.vector16()
+	return ok
+}
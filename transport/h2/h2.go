@@ -0,0 +1,130 @@
+// Package h2 provides HTTP/2 stream transport, which carries the stream
+// in the bodies of a long-lived request and its response, e.g. the "h2"
+// transport of V2Ray.
+package h2
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"golang.org/x/net/http2"
+)
+
+// Config is the HTTP/2 request options.
+type Config struct {
+	// Host is the authority of request, the server address is used if
+	// empty.
+	Host string
+
+	// Path is the request path, defaults to "/".
+	Path string
+
+	// Headers are the extra headers of request.
+	Headers http.Header
+}
+
+// Conn is a net.Conn over the bodies of HTTP/2 request and response.
+type Conn struct {
+	net.Conn
+
+	cc *http2.ClientConn
+	pr *io.PipeReader
+	pw *io.PipeWriter
+
+	ready chan struct{}
+	body  io.ReadCloser
+	err   error
+
+	closeOnce sync.Once
+}
+
+// StreamConn sends the request over c, which is already connected (and
+// encrypted with ALPN "h2" if needed) to the server at addr, and is
+// dedicated to the request. The response is waited on the first Read.
+func StreamConn(c net.Conn, addr string, cfg *Config) (net.Conn, error) {
+	host := cfg.Host
+	if host == "" {
+		host = addr
+	}
+	path := cfg.Path
+	if path == "" {
+		path = "/"
+	}
+
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme, u.Host = "https", host
+
+	tr := &http2.Transport{}
+	cc, err := tr.NewClientConn(c)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPut, u.String(), pr)
+	if err != nil {
+		cc.Close()
+		return nil, err
+	}
+	req.Header = cfg.Headers.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Host = host
+	req.ContentLength = -1
+
+	hc := &Conn{
+		Conn:  c,
+		cc:    cc,
+		pr:    pr,
+		pw:    pw,
+		ready: make(chan struct{}),
+	}
+	// The response header may not be sent until the request body.
+	go hc.roundTrip(req)
+	return hc, nil
+}
+
+func (c *Conn) roundTrip(req *http.Request) {
+	defer close(c.ready)
+
+	resp, err := c.cc.RoundTrip(req)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	if err != nil {
+		// Unblock the writes to request body.
+		c.pr.CloseWithError(err)
+		c.err = err
+		return
+	}
+	c.body = resp.Body
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	<-c.ready
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.body.Read(b)
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	return c.pw.Write(b)
+}
+
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.pw.Close()
+		c.cc.Close()
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,118 @@
+package masque
+
+import (
+	"errors"
+	"io"
+)
+
+// capsuleDatagram is the capsule type of HTTP Datagram. RFC 9297
+const capsuleDatagram = 0x00
+
+// contextUDP is the context ID of UDP payload. RFC 9298
+const contextUDP = 0x00
+
+// appendVarint appends v as a variable-length integer. RFC 9000
+func appendVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, byte(v>>8)|0x40, byte(v))
+	case v < 1<<30:
+		return append(b, byte(v>>24)|0x80, byte(v>>16), byte(v>>8), byte(v))
+	default:
+		return append(b, byte(v>>56)|0xc0, byte(v>>48), byte(v>>40), byte(v>>32),
+			byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+}
+
+// readVarint reads a variable-length integer from r, and returns
+// its value along with the encoded length.
+func readVarint(r io.Reader) (uint64, int, error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return 0, 0, err
+	}
+
+	n := 1 << (buf[0] >> 6)
+	if _, err := io.ReadFull(r, buf[1:n]); err != nil {
+		return 0, 0, err
+	}
+
+	v := uint64(buf[0] & 0x3f)
+	for _, b := range buf[1:n] {
+		v = v<<8 | uint64(b)
+	}
+	return v, n, nil
+}
+
+// WriteDatagram writes payload as a DATAGRAM capsule to w in a single
+// write.
+//
+//	+------+--------+------------+----------+
+//	| Type | Length | Context ID | Payload  |
+//	+------+--------+------------+----------+
+//	|  0   |   i    |     0      | Variable |
+//	+------+--------+------------+----------+
+func WriteDatagram(w io.Writer, payload []byte) (int, error) {
+	capsule := make([]byte, 0, 1+8+1+len(payload))
+	capsule = appendVarint(capsule, capsuleDatagram)
+	capsule = appendVarint(capsule, uint64(1+len(payload)))
+	capsule = appendVarint(capsule, contextUDP)
+	capsule = append(capsule, payload...)
+
+	if _, err := w.Write(capsule); err != nil {
+		return 0, err
+	}
+	return len(payload), nil
+}
+
+// ReadDatagram reads the UDP payload of next DATAGRAM capsule from r
+// into payload, the other capsules and contexts are skipped, and the
+// part of datagram exceeding payload is discarded.
+func ReadDatagram(r io.Reader, payload []byte) (int, error) {
+	for {
+		typ, _, err := readVarint(r)
+		if err != nil {
+			return 0, err
+		}
+		length, _, err := readVarint(r)
+		if err != nil {
+			return 0, err
+		}
+		if typ != capsuleDatagram || length == 0 {
+			if _, err = io.CopyN(io.Discard, r, int64(length)); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		contextID, n, err := readVarint(r)
+		if err != nil {
+			return 0, err
+		}
+		if uint64(n) > length {
+			return 0, errors.New("invalid datagram capsule")
+		}
+		size := int64(length) - int64(n)
+
+		if contextID != contextUDP {
+			if _, err = io.CopyN(io.Discard, r, size); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		m := size
+		if m > int64(len(payload)) {
+			m = int64(len(payload))
+		}
+		if _, err = io.ReadFull(r, payload[:m]); err != nil {
+			return 0, err
+		}
+		if _, err = io.CopyN(io.Discard, r, size-m); err != nil {
+			return 0, err
+		}
+		return int(m), nil
+	}
+}
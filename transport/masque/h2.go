@@ -0,0 +1,331 @@
+package masque
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+const (
+	// settingEnableConnectProtocol enables extended CONNECT. RFC 8441
+	settingEnableConnectProtocol http2.SettingID = 0x8
+
+	// streamID is the only stream of connection.
+	streamID = 1
+
+	initialWindowSize = 65535
+	initialFrameSize  = 16384
+)
+
+var errNoExtendedConnect = errors.New("extended CONNECT not supported by proxy")
+
+// ClientHandshakeH2 sends the CONNECT-UDP request as HTTP/2 extended
+// CONNECT over c, which is dedicated to the request, and returns the
+// capsule stream if the request is accepted.
+func ClientHandshakeH2(c net.Conn, r *Request) (net.Conn, error) {
+	path, err := r.path()
+	if err != nil {
+		return nil, err
+	}
+
+	hc := &h2Conn{
+		Conn:         c,
+		fr:           http2.NewFramer(c, c),
+		peerWindow:   initialWindowSize,
+		connWindow:   initialWindowSize,
+		streamWindow: initialWindowSize,
+		maxFrameSize: initialFrameSize,
+	}
+	hc.cond = sync.NewCond(&hc.mu)
+	hc.fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+
+	if _, err = io.WriteString(c, http2.ClientPreface); err != nil {
+		return nil, err
+	}
+	go hc.readLoop()
+
+	if err = hc.writeFrame(func(fr *http2.Framer) error {
+		return fr.WriteSettings(http2.Setting{ID: http2.SettingEnablePush})
+	}); err != nil {
+		return nil, err
+	}
+
+	// The extended CONNECT is sent only if it's enabled by the settings
+	// of proxy.
+	hc.mu.Lock()
+	for !hc.settled && hc.rErr == nil {
+		hc.cond.Wait()
+	}
+	settled, connectProtocol := hc.settled, hc.connectProtocol
+	hc.mu.Unlock()
+
+	if !settled {
+		return nil, hc.readErr()
+	}
+	if !connectProtocol {
+		return nil, errNoExtendedConnect
+	}
+
+	block := &bytes.Buffer{}
+	enc := hpack.NewEncoder(block)
+	for _, f := range [][2]string{
+		{":method", "CONNECT"},
+		{":protocol", Protocol},
+		{":scheme", "https"},
+		{":authority", r.Authority},
+		{":path", path},
+		{"capsule-protocol", "?1"},
+	} {
+		enc.WriteField(hpack.HeaderField{Name: f[0], Value: f[1]})
+	}
+	for k, vs := range r.Header {
+		for _, v := range vs {
+			enc.WriteField(hpack.HeaderField{Name: strings.ToLower(k), Value: v})
+		}
+	}
+
+	if err = hc.writeFrame(func(fr *http2.Framer) error {
+		return fr.WriteHeaders(http2.HeadersFrameParam{
+			StreamID:      streamID,
+			BlockFragment: block.Bytes(),
+			EndHeaders:    true,
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	hc.mu.Lock()
+	for hc.status == "" && hc.rErr == nil {
+		hc.cond.Wait()
+	}
+	status := hc.status
+	hc.mu.Unlock()
+
+	if status == "" {
+		return nil, hc.readErr()
+	}
+	if len(status) != 3 || status[0] != '2' {
+		return nil, fmt.Errorf("CONNECT-UDP status: %s", status)
+	}
+	return hc, nil
+}
+
+// h2Conn is the stream of extended CONNECT, with the flow control of
+// HTTP/2 on both directions.
+type h2Conn struct {
+	net.Conn
+
+	fr  *http2.Framer
+	wMu sync.Mutex // guards the writes of frames
+
+	// writeMu keeps the data of a Write in order.
+	writeMu sync.Mutex
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	settled         bool
+	connectProtocol bool
+	status          string
+
+	// peerWindow is the initial stream window of proxy, connWindow
+	// and streamWindow are the windows available for sending.
+	peerWindow   int64
+	connWindow   int64
+	streamWindow int64
+	maxFrameSize uint32
+
+	buf bytes.Buffer
+	// rErr is the error of reading after the buffered data, wErr is
+	// the error of writing, e.g. the connection is broken.
+	rErr error
+	wErr error
+}
+
+func (hc *h2Conn) writeFrame(fn func(*http2.Framer) error) error {
+	hc.wMu.Lock()
+	defer hc.wMu.Unlock()
+	return fn(hc.fr)
+}
+
+func (hc *h2Conn) readErr() error {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return hc.rErr
+}
+
+// fail sets the error of both directions, and wakes up the waiters.
+func (hc *h2Conn) fail(err error) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	if hc.rErr == nil || hc.rErr == io.EOF {
+		hc.rErr = err
+	}
+	if hc.wErr == nil {
+		hc.wErr = err
+	}
+	hc.cond.Broadcast()
+}
+
+func (hc *h2Conn) readLoop() {
+	for {
+		f, err := hc.fr.ReadFrame()
+		if err != nil {
+			hc.fail(err)
+			return
+		}
+
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+			hc.mu.Lock()
+			f.ForeachSetting(func(s http2.Setting) error {
+				switch s.ID {
+				case http2.SettingInitialWindowSize:
+					hc.streamWindow += int64(s.Val) - hc.peerWindow
+					hc.peerWindow = int64(s.Val)
+				case http2.SettingMaxFrameSize:
+					hc.maxFrameSize = s.Val
+				case settingEnableConnectProtocol:
+					hc.connectProtocol = s.Val == 1
+				}
+				return nil
+			})
+			hc.settled = true
+			hc.cond.Broadcast()
+			hc.mu.Unlock()
+
+			err = hc.writeFrame(func(fr *http2.Framer) error { return fr.WriteSettingsAck() })
+		case *http2.MetaHeadersFrame:
+			if f.StreamID != streamID {
+				continue
+			}
+			hc.mu.Lock()
+			if hc.status == "" {
+				hc.status = f.PseudoValue("status")
+			}
+			if f.StreamEnded() && hc.rErr == nil {
+				hc.rErr = io.EOF
+			}
+			hc.cond.Broadcast()
+			hc.mu.Unlock()
+		case *http2.DataFrame:
+			// The padding is returned to the window immediately.
+			if pad := f.Length - uint32(len(f.Data())); pad > 0 {
+				err = hc.updateWindow(f.StreamID, pad)
+			}
+			if f.StreamID != streamID {
+				continue
+			}
+			hc.mu.Lock()
+			hc.buf.Write(f.Data())
+			if f.StreamEnded() && hc.rErr == nil {
+				hc.rErr = io.EOF
+			}
+			hc.cond.Broadcast()
+			hc.mu.Unlock()
+		case *http2.WindowUpdateFrame:
+			hc.mu.Lock()
+			switch f.StreamID {
+			case 0:
+				hc.connWindow += int64(f.Increment)
+			case streamID:
+				hc.streamWindow += int64(f.Increment)
+			}
+			hc.cond.Broadcast()
+			hc.mu.Unlock()
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				err = hc.writeFrame(func(fr *http2.Framer) error { return fr.WritePing(true, f.Data) })
+			}
+		case *http2.RSTStreamFrame:
+			if f.StreamID == streamID {
+				err = fmt.Errorf("stream reset: %s", f.ErrCode)
+			}
+		case *http2.GoAwayFrame:
+			err = fmt.Errorf("go away: %s", f.ErrCode)
+		}
+
+		if err != nil {
+			hc.fail(err)
+			return
+		}
+	}
+}
+
+// updateWindow returns n bytes to the windows of connection and stream.
+func (hc *h2Conn) updateWindow(id uint32, n uint32) error {
+	return hc.writeFrame(func(fr *http2.Framer) error {
+		if err := fr.WriteWindowUpdate(0, n); err != nil {
+			return err
+		}
+		if id == 0 {
+			return nil
+		}
+		return fr.WriteWindowUpdate(id, n)
+	})
+}
+
+func (hc *h2Conn) Read(b []byte) (int, error) {
+	hc.mu.Lock()
+	for hc.buf.Len() == 0 && hc.rErr == nil {
+		hc.cond.Wait()
+	}
+	if hc.buf.Len() == 0 {
+		defer hc.mu.Unlock()
+		return 0, hc.rErr
+	}
+	n, _ := hc.buf.Read(b)
+	hc.mu.Unlock()
+
+	if err := hc.updateWindow(streamID, uint32(n)); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func (hc *h2Conn) Write(b []byte) (int, error) {
+	hc.writeMu.Lock()
+	defer hc.writeMu.Unlock()
+
+	written := 0
+	for written < len(b) {
+		hc.mu.Lock()
+		for hc.wErr == nil && (hc.connWindow <= 0 || hc.streamWindow <= 0) {
+			hc.cond.Wait()
+		}
+		if hc.wErr != nil {
+			defer hc.mu.Unlock()
+			return written, hc.wErr
+		}
+
+		n := int64(len(b) - written)
+		for _, limit := range []int64{hc.connWindow, hc.streamWindow, int64(hc.maxFrameSize)} {
+			if n > limit {
+				n = limit
+			}
+		}
+		hc.connWindow -= n
+		hc.streamWindow -= n
+		hc.mu.Unlock()
+
+		data := b[written : written+int(n)]
+		if err := hc.writeFrame(func(fr *http2.Framer) error {
+			return fr.WriteData(streamID, false, data)
+		}); err != nil {
+			return written, err
+		}
+		written += int(n)
+	}
+	return written, nil
+}
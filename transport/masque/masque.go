@@ -0,0 +1,88 @@
+// Package masque provides the client of proxying UDP in HTTP, which is
+// also known as CONNECT-UDP (RFC 9298), over HTTP/1.1 and HTTP/2.
+package masque
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Protocol is the upgrade token of CONNECT-UDP.
+const Protocol = "connect-udp"
+
+// Request is the CONNECT-UDP request to the proxy.
+type Request struct {
+	// Authority is the authority of proxy, e.g. "proxy.example.com:443".
+	Authority string
+
+	// Target is the host and port of UDP destination.
+	Target string
+
+	// Header is the additional header, e.g. Proxy-Authorization.
+	Header http.Header
+}
+
+// path returns the request path of the default URI template
+// "/.well-known/masque/udp/{target_host}/{target_port}/".
+func (r *Request) path() (string, error) {
+	host, port, err := net.SplitHostPort(r.Target)
+	if err != nil {
+		return "", err
+	}
+	// The colons of IPv6 address are percent-encoded.
+	host = strings.ReplaceAll(url.PathEscape(host), ":", "%3A")
+	return fmt.Sprintf("/.well-known/masque/udp/%s/%s/", host, port), nil
+}
+
+// ClientHandshake sends the CONNECT-UDP request as HTTP/1.1 upgrade over
+// c, and returns the capsule stream if the request is accepted.
+func ClientHandshake(c net.Conn, r *Request) (net.Conn, error) {
+	path, err := r.path()
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Opaque: path},
+		Host:   r.Authority,
+		Header: http.Header{
+			"Connection":       []string{"Upgrade"},
+			"Upgrade":          []string{Protocol},
+			"Capsule-Protocol": []string{"?1"},
+		},
+	}
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+
+	if err = req.Write(c); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(c)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!strings.EqualFold(resp.Header.Get("Upgrade"), Protocol) {
+		return nil, fmt.Errorf("CONNECT-UDP status: %s", resp.Status)
+	}
+	return &conn{Conn: c, reader: reader}, nil
+}
+
+// conn reads the remaining data of handshake first.
+type conn struct {
+	net.Conn
+
+	reader *bufio.Reader
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
@@ -0,0 +1,195 @@
+package masque
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// tcpPipe returns both ends of a loopback TCP connection.
+func tcpPipe(t *testing.T) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	server, err := ln.Accept()
+	require.NoError(t, err)
+	return client, server
+}
+
+func TestVarint(t *testing.T) {
+	for _, v := range []uint64{0, 63, 64, 16383, 16384, 1<<30 - 1, 1 << 30, 1<<62 - 1} {
+		b := appendVarint(nil, v)
+		got, n, err := readVarint(bytes.NewReader(b))
+		require.NoError(t, err)
+		assert.Equal(t, v, got)
+		assert.Equal(t, len(b), n)
+	}
+}
+
+func TestDatagram(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	// An unknown capsule and a datagram of other context are skipped.
+	buf.Write([]byte{0x3f, 0x02, 0xaa, 0xbb})
+	buf.Write([]byte{capsuleDatagram, 0x03, 0x01, 0xcc, 0xdd})
+	_, err := WriteDatagram(buf, []byte("hello"))
+	require.NoError(t, err)
+	_, err = WriteDatagram(buf, []byte("world"))
+	require.NoError(t, err)
+
+	payload := make([]byte, 5)
+	n, err := ReadDatagram(buf, payload)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(payload[:n]))
+
+	// The exceeding part is discarded.
+	n, err = ReadDatagram(buf, payload[:3])
+	require.NoError(t, err)
+	assert.Equal(t, "wor", string(payload[:n]))
+	assert.Equal(t, 0, buf.Len())
+}
+
+func TestClientHandshake(t *testing.T) {
+	client, server := tcpPipe(t)
+	defer client.Close()
+
+	go func() {
+		defer server.Close()
+
+		r := bufio.NewReader(server)
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return
+		}
+		if req.URL.EscapedPath() != "/.well-known/masque/udp/2001%3Adb8%3A%3A1/53/" ||
+			req.Header.Get("Upgrade") != Protocol || req.Header.Get("Capsule-Protocol") != "?1" {
+			io.WriteString(server, "HTTP/1.1 400 Bad Request\r\n\r\n")
+			return
+		}
+		io.WriteString(server, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: connect-udp\r\n\r\n")
+		io.Copy(server, r)
+	}()
+
+	c, err := ClientHandshake(client, &Request{Authority: "proxy.example.com", Target: "[2001:db8::1]:53"})
+	require.NoError(t, err)
+
+	_, err = WriteDatagram(c, []byte("query"))
+	require.NoError(t, err)
+	payload := make([]byte, 16)
+	n, err := ReadDatagram(c, payload)
+	require.NoError(t, err)
+	assert.Equal(t, "query", string(payload[:n]))
+}
+
+// serveH2 runs an HTTP/2 stand-in proxy over c, which accepts extended
+// CONNECT of CONNECT-UDP and echoes the capsules back.
+func serveH2(c net.Conn, enableConnect bool) {
+	defer c.Close()
+
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(c, preface); err != nil {
+		return
+	}
+
+	fr := http2.NewFramer(c, c)
+	var settings []http2.Setting
+	if enableConnect {
+		settings = append(settings, http2.Setting{ID: settingEnableConnectProtocol, Val: 1})
+	}
+	if err := fr.WriteSettings(settings...); err != nil {
+		return
+	}
+
+	dec := hpack.NewDecoder(4096, nil)
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			return
+		}
+
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				fr.WriteSettingsAck()
+			}
+		case *http2.HeadersFrame:
+			fields, err := dec.DecodeFull(f.HeaderBlockFragment())
+			if err != nil {
+				return
+			}
+			headers := map[string]string{}
+			for _, field := range fields {
+				headers[field.Name] = field.Value
+			}
+
+			status := "200"
+			if headers[":method"] != "CONNECT" || headers[":protocol"] != Protocol ||
+				headers[":path"] != "/.well-known/masque/udp/example.com/443/" {
+				status = "400"
+			}
+
+			block := &bytes.Buffer{}
+			hpack.NewEncoder(block).WriteField(hpack.HeaderField{Name: ":status", Value: status})
+			fr.WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      f.StreamID,
+				BlockFragment: block.Bytes(),
+				EndHeaders:    true,
+				EndStream:     status != "200",
+			})
+		case *http2.DataFrame:
+			data := append([]byte(nil), f.Data()...)
+			fr.WriteWindowUpdate(0, uint32(len(data)))
+			fr.WriteWindowUpdate(f.StreamID, uint32(len(data)))
+			fr.WriteData(f.StreamID, false, data)
+		}
+	}
+}
+
+func TestClientHandshakeH2(t *testing.T) {
+	client, server := tcpPipe(t)
+	defer client.Close()
+	go serveH2(server, true)
+
+	c, err := ClientHandshakeH2(client, &Request{Authority: "proxy.example.com", Target: "example.com:443"})
+	require.NoError(t, err)
+
+	// Exceeds the initial window in total.
+	payload := bytes.Repeat([]byte{'x'}, 60000)
+	buf := make([]byte, len(payload))
+	for i := 0; i < 4; i++ {
+		payload[0] = byte(i)
+		_, err = WriteDatagram(c, payload)
+		require.NoError(t, err)
+
+		n, err := ReadDatagram(c, buf)
+		require.NoError(t, err)
+		assert.Equal(t, payload, buf[:n])
+	}
+}
+
+func TestClientHandshakeH2Rejected(t *testing.T) {
+	client, server := tcpPipe(t)
+	defer client.Close()
+	go serveH2(server, false)
+
+	_, err := ClientHandshakeH2(client, &Request{Authority: "proxy.example.com", Target: "example.com:443"})
+	assert.ErrorIs(t, err, errNoExtendedConnect)
+
+	client, server = tcpPipe(t)
+	defer client.Close()
+	go serveH2(server, true)
+
+	_, err = ClientHandshakeH2(client, &Request{Authority: "proxy.example.com", Target: "example.org:443"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package mux
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// smuxVersion is the version of smux protocol, where the version 1 has
+// no stream-level flow control, which is used by sing-mux.
+const smuxVersion = 0x01
+
+type command uint8
+
+const (
+	// cmdSYN opens a stream.
+	cmdSYN command = iota
+	// cmdFIN closes a stream, the sender won't read or write any more.
+	cmdFIN
+	// cmdPSH carries the data of a stream.
+	cmdPSH
+	// cmdNOP keeps the session alive.
+	cmdNOP
+)
+
+func (c command) String() string {
+	switch c {
+	case cmdSYN:
+		return "SYN"
+	case cmdFIN:
+		return "FIN"
+	case cmdPSH:
+		return "PSH"
+	case cmdNOP:
+		return "NOP"
+	default:
+		return fmt.Sprintf("CMD(%d)", uint8(c))
+	}
+}
+
+// headerSize is the size of frame header, whose fields are in little
+// endian.
+//
+//	+-----+-----+--------+----------+----------+
+//	| VER | CMD | LENGTH | STREAMID |   DATA   |
+//	+-----+-----+--------+----------+----------+
+//	|  1  |  1  |   2    |    4     | Variable |
+//	+-----+-----+--------+----------+----------+
+const headerSize = 1 + 1 + 2 + 4
+
+// maxFrameSize is the max length of data in a frame sent, which is the
+// default of smux.
+const maxFrameSize = 32 * 1024
+
+type frame struct {
+	cmd  command
+	sid  uint32
+	data []byte
+}
+
+// marshal returns the frame in wire format, which is written at once.
+func (f *frame) marshal() []byte {
+	b := make([]byte, headerSize+len(f.data))
+	b[0] = smuxVersion
+	b[1] = byte(f.cmd)
+	binary.LittleEndian.PutUint16(b[2:], uint16(len(f.data)))
+	binary.LittleEndian.PutUint32(b[4:], f.sid)
+	copy(b[headerSize:], f.data)
+	return b
+}
+
+// readFrame reads a frame from r, whose data is newly allocated.
+func readFrame(r io.Reader) (*frame, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if header[0] != smuxVersion {
+		return nil, fmt.Errorf("unexpected version: %d", header[0])
+	}
+
+	f := &frame{
+		cmd: command(header[1]),
+		sid: binary.LittleEndian.Uint32(header[4:]),
+	}
+	if length := binary.LittleEndian.Uint16(header[2:]); length > 0 {
+		f.data = make([]byte, length)
+		if _, err := io.ReadFull(r, f.data); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,267 @@
+// Package mux implements the client of sing-mux over smux version 1,
+// which carries many logical connections over a few connections to the
+// proxy server, with session-level flow control and keepalive, as the
+// multiplex of sing-box.
+//
+// The client connects to MagicAddress through the proxy, and starts a
+// Session over the connection after the preface. Each stream starts with
+// the request of its destination, which is written by WriteRequest and
+// read by ReadRequest on the server side, and the server responds with
+// the status before any data.
+package mux
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+)
+
+const (
+	// MagicAddress and MagicPort are the destination requested to the
+	// proxy server for a mux session.
+	MagicAddress = "sp.mux.sing-box.arpa"
+	MagicPort    = 444
+)
+
+const (
+	defaultMaxConnections = 4
+	defaultMaxStreams     = 32
+)
+
+// The session preface is the version, which has no padding for 0, and
+// the protocol of sing-mux.
+const (
+	version0     = 0x00
+	protocolSmux = 0x01
+)
+
+// The flags of stream request, where flagUDP is for UDP streams, and
+// flagAddr is for UDP streams with the destination in each packet.
+const (
+	flagUDP  = 0x01
+	flagAddr = 0x02
+)
+
+// The status of stream response, statusError is followed by the error
+// message.
+const (
+	statusSuccess = 0x00
+	statusError   = 0x01
+)
+
+// maxErrorLen is the max length of error message read from the server.
+const maxErrorLen = 1024
+
+// MagicAddr returns the SOCKS5 address of MagicAddress.
+func MagicAddr() socks5.Addr {
+	return socks5.SerializeAddr(MagicAddress, nil, MagicPort)
+}
+
+// WriteRequest writes the TCP request of stream to addr to w.
+//
+//	+-------+----------+
+//	| FLAGS |   ADDR   |
+//	+-------+----------+
+//	|   2   | Variable |
+//	+-------+----------+
+func WriteRequest(w io.Writer, addr socks5.Addr) error {
+	if !addr.Valid() {
+		return errors.New("address is invalid")
+	}
+	// The flags are zero for TCP.
+	b := make([]byte, 2, 2+len(addr))
+	_, err := w.Write(append(b, addr...))
+	return err
+}
+
+// ReadRequest reads the request of stream from r, and returns its
+// destination, the UDP requests are not supported.
+func ReadRequest(r io.Reader) (socks5.Addr, error) {
+	var flags [2]byte
+	if _, err := io.ReadFull(r, flags[:]); err != nil {
+		return nil, err
+	}
+	if f := binary.BigEndian.Uint16(flags[:]); f&(flagUDP|flagAddr) != 0 {
+		return nil, fmt.Errorf("unsupported flags: %#x", f)
+	}
+	return socks5.ReadAddr(r, make([]byte, socks5.MaxAddrLen))
+}
+
+// readResponse reads the response of stream from r, and returns the
+// error message from the server if any.
+func readResponse(r *bufio.Reader) error {
+	status, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch status {
+	case statusSuccess:
+		return nil
+	case statusError:
+		length, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		if length > maxErrorLen {
+			return fmt.Errorf("error message too long: %d", length)
+		}
+		msg := make([]byte, length)
+		if _, err = io.ReadFull(r, msg); err != nil {
+			return err
+		}
+		return fmt.Errorf("remote error: %s", msg)
+	default:
+		return fmt.Errorf("unexpected status: %d", status)
+	}
+}
+
+// streamConn is the stream whose response is read on the first Read,
+// so that the data can be written before the response as sing-mux.
+type streamConn struct {
+	*Stream
+
+	reader *bufio.Reader
+	once   sync.Once
+	err    error
+}
+
+func (c *streamConn) Read(b []byte) (int, error) {
+	c.once.Do(func() {
+		c.err = readResponse(c.reader)
+	})
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+// PoolConfig is the options of Pool.
+type PoolConfig struct {
+	Config
+
+	// MaxConnections is the max number of sessions.
+	MaxConnections int
+
+	// MaxStreams is the number of streams in a session, over which a
+	// new session is preferred. The streams are spread over sessions if
+	// MaxConnections is reached.
+	MaxStreams int
+}
+
+// Pool dials streams over a pool of sessions.
+type Pool struct {
+	dial   func(context.Context) (net.Conn, error)
+	config PoolConfig
+
+	mu       sync.Mutex
+	sessions []*Session
+	closed   bool
+}
+
+// NewPool returns Pool, whose sessions are over the connections of
+// dial, e.g. to MagicAddress through a proxy.
+func NewPool(dial func(context.Context) (net.Conn, error), config PoolConfig) *Pool {
+	if config.MaxConnections <= 0 {
+		config.MaxConnections = defaultMaxConnections
+	}
+	if config.MaxStreams <= 0 {
+		config.MaxStreams = defaultMaxStreams
+	}
+	return &Pool{dial: dial, config: config}
+}
+
+// DialContext opens a stream to addr.
+func (p *Pool) DialContext(ctx context.Context, addr socks5.Addr) (net.Conn, error) {
+	sess, err := p.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := sess.Open()
+	if err != nil {
+		return nil, err
+	}
+	if err = WriteRequest(st, addr); err != nil {
+		st.Close()
+		return nil, err
+	}
+	return &streamConn{Stream: st, reader: bufio.NewReader(st)}, nil
+}
+
+// session returns the session with the least streams, a new session is
+// created if all are busy and MaxConnections is not reached.
+func (p *Pool) session(ctx context.Context) (*Session, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, errSessionClosed
+	}
+
+	var (
+		best     *Session
+		sessions = p.sessions[:0]
+	)
+	for _, sess := range p.sessions {
+		if sess.IsClosed() {
+			continue
+		}
+		sessions = append(sessions, sess)
+		if best == nil || sess.NumStreams() < best.NumStreams() {
+			best = sess
+		}
+	}
+	p.sessions = sessions
+
+	if best != nil && (best.NumStreams() < p.config.MaxStreams || len(p.sessions) >= p.config.MaxConnections) {
+		return best, nil
+	}
+
+	// The new session is dialed with the lock held, so that the streams
+	// dialed meanwhile share it.
+	conn, err := p.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = conn.Write([]byte{version0, protocolSmux}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	sess := Client(conn, &p.config.Config)
+	p.sessions = append(p.sessions, sess)
+	return sess, nil
+}
+
+// NumSessions returns the number of sessions open.
+func (p *Pool) NumSessions() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for _, sess := range p.sessions {
+		if !sess.IsClosed() {
+			n++
+		}
+	}
+	return n
+}
+
+// Close closes all sessions.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, sess := range p.sessions {
+		sess.Close()
+	}
+	p.sessions = nil
+	return nil
+}
@@ -0,0 +1,188 @@
+package mux
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+)
+
+// serveEcho runs the server side of sing-mux, which echoes the streams
+// to "example.com:80", and responds error to the others.
+func serveEcho(t *testing.T, config *Config) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				var preface [2]byte
+				if _, err := io.ReadFull(c, preface[:]); err != nil || preface != [2]byte{version0, protocolSmux} {
+					c.Close()
+					return
+				}
+				sess := Server(c, config)
+				for {
+					st, err := sess.Accept()
+					if err != nil {
+						return
+					}
+					go func() {
+						defer st.Close()
+
+						addr, err := ReadRequest(st)
+						if err != nil {
+							return
+						}
+						if addr.String() != "example.com:80" {
+							msg := "unreachable"
+							st.Write(append([]byte{statusError, byte(len(msg))}, msg...))
+							return
+						}
+						st.Write([]byte{statusSuccess})
+						io.Copy(st, st)
+					}()
+				}
+			}()
+		}
+	}()
+	return ln
+}
+
+func dialTCP(ln net.Listener) func(context.Context) (net.Conn, error) {
+	return func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", ln.Addr().String())
+	}
+}
+
+func TestFrame(t *testing.T) {
+	// The header of smux version 1 is in little endian.
+	f := &frame{cmd: cmdPSH, sid: 3, data: []byte("hi")}
+	b := f.marshal()
+	assert.Equal(t, []byte{0x01, 0x02, 0x02, 0x00, 0x03, 0x00, 0x00, 0x00, 'h', 'i'}, b)
+
+	parsed, err := readFrame(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, f, parsed)
+
+	var req bytes.Buffer
+	require.NoError(t, WriteRequest(&req, socks5.SerializeAddr("example.com", nil, 80)))
+	assert.Equal(t, append([]byte{0x00, 0x00, socks5.AtypDomainName, 11}, "example.com\x00\x50"...), req.Bytes())
+}
+
+func TestPool(t *testing.T) {
+	config := Config{MaxReceiveBuffer: 16 * 1024}
+	ln := serveEcho(t, &config)
+	defer ln.Close()
+
+	pool := NewPool(dialTCP(ln), PoolConfig{Config: config, MaxConnections: 2, MaxStreams: 2})
+	defer pool.Close()
+
+	// The data exceeding the receive buffer is sent with flow control.
+	data := make([]byte, 1024*1024)
+	rand.Read(data)
+
+	var (
+		wg    sync.WaitGroup
+		conns []net.Conn
+	)
+	for i := 0; i < 5; i++ {
+		c, err := pool.DialContext(context.Background(), socks5.SerializeAddr("example.com", nil, 80))
+		require.NoError(t, err)
+		conns = append(conns, c)
+	}
+	assert.Equal(t, 2, pool.NumSessions())
+
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c net.Conn) {
+			defer wg.Done()
+			defer c.Close()
+
+			go c.Write(data)
+			b := make([]byte, len(data))
+			_, err := io.ReadFull(c, b)
+			assert.NoError(t, err)
+			assert.True(t, bytes.Equal(data, b))
+		}(c)
+	}
+	wg.Wait()
+
+	assert.Eventually(t, func() bool {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		for _, sess := range pool.sessions {
+			if sess.NumStreams() > 0 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestStreamError(t *testing.T) {
+	ln := serveEcho(t, nil)
+	defer ln.Close()
+
+	pool := NewPool(dialTCP(ln), PoolConfig{})
+	defer pool.Close()
+
+	// The server responds error and closes the stream for unknown
+	// destination.
+	c, err := pool.DialContext(context.Background(), socks5.SerializeAddr("example.org", nil, 80))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Read(make([]byte, 1))
+	assert.EqualError(t, err, "remote error: unreachable")
+	assert.Eventually(t, func() bool {
+		_, err := c.Write([]byte("hello"))
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// The stream is read after the response.
+	st, err := pool.DialContext(context.Background(), socks5.SerializeAddr("example.com", nil, 80))
+	require.NoError(t, err)
+	defer st.Close()
+
+	st.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = st.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+}
+
+func TestKeepAlive(t *testing.T) {
+	// The server never responds.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			defer c.Close()
+			io.Copy(io.Discard, c)
+		}
+	}()
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+
+	sess := Client(c, &Config{KeepAliveInterval: 10 * time.Millisecond, KeepAliveTimeout: 50 * time.Millisecond})
+	assert.Eventually(t, sess.IsClosed, time.Second, 10*time.Millisecond)
+	_, err = sess.Open()
+	assert.ErrorContains(t, err, "keepalive timeout")
+}
@@ -0,0 +1,284 @@
+package mux
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	defaultKeepAliveInterval = 10 * time.Second
+	defaultMaxReceiveBuffer  = 4 * 1024 * 1024
+)
+
+var errSessionClosed = errors.New("session closed")
+
+// Config is the options of Session.
+type Config struct {
+	// KeepAliveInterval is the interval to send keepalive frames, and
+	// the session is closed if nothing is received in KeepAliveTimeout,
+	// which is disabled by default as sing-mux servers send none.
+	KeepAliveInterval time.Duration
+	KeepAliveTimeout  time.Duration
+
+	// MaxReceiveBuffer is the max length of data received but not read
+	// in all streams, over which the session stops receiving until the
+	// streams are read.
+	MaxReceiveBuffer int
+}
+
+func (c *Config) withDefaults() *Config {
+	config := Config{}
+	if c != nil {
+		config = *c
+	}
+	if config.KeepAliveInterval <= 0 {
+		config.KeepAliveInterval = defaultKeepAliveInterval
+	}
+	if config.MaxReceiveBuffer <= 0 {
+		config.MaxReceiveBuffer = defaultMaxReceiveBuffer
+	}
+	return &config
+}
+
+// Session multiplexes streams over a connection.
+type Session struct {
+	conn   net.Conn
+	config *Config
+
+	// nextID is odd for the client side, and even for the server side.
+	nextID uint32
+
+	wMu sync.Mutex
+
+	mu      sync.Mutex
+	streams map[uint32]*Stream
+
+	accepts chan *Stream
+
+	// buffered is the length of data received but not read, and
+	// bufferEvent is notified if it's decreased.
+	buffered    *atomic.Int64
+	bufferEvent chan struct{}
+
+	die     chan struct{}
+	dieOnce sync.Once
+	err     error
+
+	lastRecv *atomic.Time
+}
+
+// Client returns the client side Session over conn.
+func Client(conn net.Conn, config *Config) *Session {
+	return newSession(conn, config, 1)
+}
+
+// Server returns the server side Session over conn.
+func Server(conn net.Conn, config *Config) *Session {
+	return newSession(conn, config, 2)
+}
+
+func newSession(conn net.Conn, config *Config, nextID uint32) *Session {
+	s := &Session{
+		conn:     conn,
+		config:   config.withDefaults(),
+		nextID:   nextID,
+		streams:  make(map[uint32]*Stream),
+		accepts:  make(chan *Stream, 64),
+		die:      make(chan struct{}),
+		lastRecv: atomic.NewTime(time.Now()),
+
+		buffered:    atomic.NewInt64(0),
+		bufferEvent: make(chan struct{}, 1),
+	}
+	go s.recvLoop()
+	go s.keepAlive()
+	return s
+}
+
+// Open opens a new stream to the peer.
+func (s *Session) Open() (*Stream, error) {
+	s.mu.Lock()
+	if s.IsClosed() {
+		s.mu.Unlock()
+		return nil, s.closeErr()
+	}
+	sid := s.nextID
+	s.nextID += 2
+	st := newStream(sid, s)
+	s.streams[sid] = st
+	s.mu.Unlock()
+
+	if err := s.writeFrame(&frame{cmd: cmdSYN, sid: sid}); err != nil {
+		s.removeStream(sid)
+		return nil, err
+	}
+	return st, nil
+}
+
+// Accept waits for the stream opened by the peer.
+func (s *Session) Accept() (*Stream, error) {
+	select {
+	case st := <-s.accepts:
+		return st, nil
+	case <-s.die:
+		return nil, s.closeErr()
+	}
+}
+
+// NumStreams returns the number of streams open.
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// IsClosed returns whether the session is closed.
+func (s *Session) IsClosed() bool {
+	select {
+	case <-s.die:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close closes the session and all its streams.
+func (s *Session) Close() error {
+	return s.closeWithError(errSessionClosed)
+}
+
+func (s *Session) closeWithError(err error) error {
+	closed := false
+	s.dieOnce.Do(func() {
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+		close(s.die)
+		closed = true
+	})
+	if !closed {
+		return nil
+	}
+	return s.conn.Close()
+}
+
+func (s *Session) closeErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Session) removeStream(sid uint32) {
+	s.mu.Lock()
+	delete(s.streams, sid)
+	s.mu.Unlock()
+}
+
+// releaseBuffer releases the length n of data read or discarded.
+func (s *Session) releaseBuffer(n int) {
+	if n > 0 {
+		s.buffered.Sub(int64(n))
+		notify(s.bufferEvent)
+	}
+}
+
+func (s *Session) writeFrame(f *frame) error {
+	s.wMu.Lock()
+	defer s.wMu.Unlock()
+
+	if s.IsClosed() {
+		return s.closeErr()
+	}
+	if _, err := s.conn.Write(f.marshal()); err != nil {
+		s.closeWithError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *Session) recvLoop() {
+	r := bufio.NewReader(s.conn)
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			s.closeWithError(err)
+			return
+		}
+		s.lastRecv.Store(time.Now())
+
+		if err = s.handleFrame(f); err != nil {
+			s.closeWithError(err)
+			return
+		}
+
+		// The peer is blocked by TCP until the buffered data is read.
+		for s.buffered.Load() >= int64(s.config.MaxReceiveBuffer) {
+			select {
+			case <-s.bufferEvent:
+			case <-s.die:
+				return
+			}
+		}
+	}
+}
+
+func (s *Session) handleFrame(f *frame) error {
+	if f.cmd == cmdNOP {
+		return nil
+	}
+
+	s.mu.Lock()
+	st := s.streams[f.sid]
+	if f.cmd == cmdSYN && st == nil {
+		st = newStream(f.sid, s)
+		s.streams[f.sid] = st
+		s.mu.Unlock()
+
+		select {
+		case s.accepts <- st:
+		case <-s.die:
+		}
+		return nil
+	}
+	s.mu.Unlock()
+
+	// The frames of streams closed locally are discarded.
+	if st == nil {
+		return nil
+	}
+
+	switch f.cmd {
+	case cmdFIN:
+		st.pushFIN()
+	case cmdPSH:
+		st.pushData(f.data)
+	default:
+		return fmt.Errorf("unexpected command: %s", f.cmd)
+	}
+	return nil
+}
+
+func (s *Session) keepAlive() {
+	ticker := time.NewTicker(s.config.KeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if s.config.KeepAliveTimeout > 0 && time.Since(s.lastRecv.Load()) > s.config.KeepAliveTimeout {
+				s.closeWithError(errors.New("keepalive timeout"))
+				return
+			}
+			// The write may block, which is detected by the timeout.
+			go s.writeFrame(&frame{cmd: cmdNOP})
+		case <-s.die:
+			return
+		}
+	}
+}
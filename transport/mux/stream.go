@@ -0,0 +1,210 @@
+package mux
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var _ net.Conn = (*Stream)(nil)
+
+// Stream is a logical connection in Session.
+type Stream struct {
+	id   uint32
+	sess *Session
+
+	mu sync.Mutex
+
+	// buf holds the data received but not read.
+	buf     bytes.Buffer
+	finRecv bool
+	closed  bool
+
+	// readEvent is notified if the read may proceed.
+	readEvent chan struct{}
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+func newStream(id uint32, sess *Session) *Stream {
+	return &Stream{
+		id:        id,
+		sess:      sess,
+		readEvent: make(chan struct{}, 1),
+	}
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// wait waits for event until deadline, or the session is closed.
+func (st *Stream) wait(event chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-event:
+		return nil
+	case <-timeout:
+		return os.ErrDeadlineExceeded
+	case <-st.sess.die:
+		return st.sess.closeErr()
+	}
+}
+
+func (st *Stream) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	for {
+		st.mu.Lock()
+		if st.closed {
+			st.mu.Unlock()
+			return 0, net.ErrClosed
+		}
+		if st.buf.Len() > 0 {
+			n, _ := st.buf.Read(b)
+			st.mu.Unlock()
+
+			st.sess.releaseBuffer(n)
+			return n, nil
+		}
+		if st.finRecv {
+			st.mu.Unlock()
+			return 0, io.EOF
+		}
+		deadline := st.readDeadline
+		st.mu.Unlock()
+
+		if err := st.wait(st.readEvent, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write writes b in frames, which is blocked by the connection of
+// session rather than the stream, as smux version 1 has no stream-level
+// flow control. The write deadline is checked before each frame.
+func (st *Stream) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		st.mu.Lock()
+		switch {
+		case st.closed:
+			st.mu.Unlock()
+			return written, net.ErrClosed
+		case st.finRecv:
+			st.mu.Unlock()
+			return written, io.ErrClosedPipe
+		case !st.writeDeadline.IsZero() && !time.Now().Before(st.writeDeadline):
+			st.mu.Unlock()
+			return written, os.ErrDeadlineExceeded
+		}
+		st.mu.Unlock()
+
+		n := len(b) - written
+		if n > maxFrameSize {
+			n = maxFrameSize
+		}
+		if err := st.sess.writeFrame(&frame{cmd: cmdPSH, sid: st.id, data: b[written : written+n]}); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// Close closes the stream with FIN, after which the peer reads EOF.
+// There is no half-close in smux.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.closed {
+		st.mu.Unlock()
+		return nil
+	}
+	st.closed = true
+	unread := st.buf.Len()
+	st.buf.Reset()
+	st.mu.Unlock()
+
+	notify(st.readEvent)
+	st.sess.removeStream(st.id)
+	st.sess.releaseBuffer(unread)
+
+	if st.sess.IsClosed() {
+		return nil
+	}
+	return st.sess.writeFrame(&frame{cmd: cmdFIN, sid: st.id})
+}
+
+func (st *Stream) pushData(data []byte) {
+	st.mu.Lock()
+	// The data is discarded if the stream is closed meanwhile.
+	if st.closed {
+		st.mu.Unlock()
+		return
+	}
+	st.buf.Write(data)
+	st.sess.buffered.Add(int64(len(data)))
+	st.mu.Unlock()
+
+	notify(st.readEvent)
+}
+
+func (st *Stream) pushFIN() {
+	st.mu.Lock()
+	st.finRecv = true
+	st.mu.Unlock()
+	notify(st.readEvent)
+}
+
+// ID returns the stream ID.
+func (st *Stream) ID() uint32 {
+	return st.id
+}
+
+func (st *Stream) LocalAddr() net.Addr {
+	return st.sess.conn.LocalAddr()
+}
+
+func (st *Stream) RemoteAddr() net.Addr {
+	return st.sess.conn.RemoteAddr()
+}
+
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.SetReadDeadline(t)
+	st.SetWriteDeadline(t)
+	return nil
+}
+
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	notify(st.readEvent)
+	return nil
+}
+
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,177 @@
+// Package sip003 runs the SIP003 plugins of Shadowsocks, e.g. v2ray-plugin,
+// which listen on a local port and relay the streams to the server.
+package sip003
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/xjasonlyu/tun2socks/v2/log"
+)
+
+const (
+	minRestartDelay = time.Second
+	maxRestartDelay = 30 * time.Second
+
+	// stableDuration is how long the plugin should run to reset the
+	// restart delay.
+	stableDuration = time.Minute
+)
+
+// Plugin is a SIP003 plugin process, which is restarted if it exits
+// until the Plugin is closed.
+type Plugin struct {
+	path, opts string
+
+	remoteHost, remotePort string
+	localHost, localPort   string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	closed bool
+	done   chan struct{}
+}
+
+// Start starts the plugin executable name with opts, which relays the
+// streams to the server at remote. The plugin listens on a free local
+// port, see LocalAddr.
+func Start(name, opts, remote string) (*Plugin, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteHost, remotePort, err := net.SplitHostPort(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	localPort, err := freePort()
+	if err != nil {
+		return nil, fmt.Errorf("pick local port: %w", err)
+	}
+
+	p := &Plugin{
+		path:       path,
+		opts:       opts,
+		remoteHost: remoteHost,
+		remotePort: remotePort,
+		localHost:  "127.0.0.1",
+		localPort:  localPort,
+		done:       make(chan struct{}),
+	}
+
+	cmd, err := p.start()
+	if err != nil {
+		return nil, err
+	}
+	go p.run(cmd)
+	return p, nil
+}
+
+// LocalAddr returns the local address which the plugin listens on.
+func (p *Plugin) LocalAddr() string {
+	return net.JoinHostPort(p.localHost, p.localPort)
+}
+
+// Close kills the plugin process and stops restarting it.
+func (p *Plugin) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+
+	var err error
+	if p.cmd != nil {
+		err = p.cmd.Process.Kill()
+	}
+	p.mu.Unlock()
+	return err
+}
+
+// start starts the plugin process with the environment of SIP003.
+func (p *Plugin) start() (*exec.Cmd, error) {
+	cmd := exec.Command(p.path)
+	cmd.Env = append(os.Environ(),
+		"SS_REMOTE_HOST="+p.remoteHost,
+		"SS_REMOTE_PORT="+p.remotePort,
+		"SS_LOCAL_HOST="+p.localHost,
+		"SS_LOCAL_PORT="+p.localPort,
+		"SS_PLUGIN_OPTIONS="+p.opts,
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, errors.New("plugin closed")
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start plugin %s: %w", p.path, err)
+	}
+	p.cmd = cmd
+
+	log.Infof("[SIP003] plugin %s (pid %d) listens at %s", p.path, cmd.Process.Pid, p.LocalAddr())
+	return cmd, nil
+}
+
+// run waits for cmd to exit, and restarts the plugin with backoff until
+// the Plugin is closed.
+func (p *Plugin) run(cmd *exec.Cmd) {
+	delay := minRestartDelay
+	for {
+		started := time.Now()
+		err := cmd.Wait()
+
+		select {
+		case <-p.done:
+			return
+		default:
+		}
+
+		if time.Since(started) > stableDuration {
+			delay = minRestartDelay
+		}
+		log.Warnf("[SIP003] plugin %s exited: %v", p.path, err)
+
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > maxRestartDelay {
+				delay = maxRestartDelay
+			}
+
+			if cmd, err = p.start(); err == nil {
+				break
+			}
+			log.Warnf("[SIP003] %v", err)
+		}
+	}
+}
+
+// freePort returns a free TCP port on the loopback interface.
+func freePort() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer ln.Close()
+
+	_, port, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		return "", errors.New("invalid listener address")
+	}
+	return port, nil
+}
@@ -0,0 +1,120 @@
+package sip003
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain runs the test binary as a dummy plugin if it's started with
+// the environment of SIP003, which forwards the streams to the server.
+func TestMain(m *testing.M) {
+	if os.Getenv("SS_LOCAL_PORT") == "" {
+		os.Exit(m.Run())
+	}
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(os.Getenv("SS_LOCAL_HOST"), os.Getenv("SS_LOCAL_PORT")))
+	if err != nil {
+		os.Exit(1)
+	}
+	remote := net.JoinHostPort(os.Getenv("SS_REMOTE_HOST"), os.Getenv("SS_REMOTE_PORT"))
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			os.Exit(1)
+		}
+		go func() {
+			defer c.Close()
+			rc, err := net.Dial("tcp", remote)
+			if err != nil {
+				return
+			}
+			defer rc.Close()
+			go io.Copy(rc, c)
+			io.Copy(c, rc)
+		}()
+	}
+}
+
+func serveEcho(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	return ln
+}
+
+// echo checks the stream through the plugin, which may be starting.
+func echo(addr string) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+		defer c.Close()
+
+		c.SetDeadline(time.Now().Add(time.Second))
+		buf := make([]byte, 5)
+		if _, err = c.Write([]byte("hello")); err != nil {
+			return false
+		}
+		if _, err = io.ReadFull(c, buf); err != nil {
+			return false
+		}
+		return string(buf) == "hello"
+	}
+	return false
+}
+
+func TestPlugin(t *testing.T) {
+	ln := serveEcho(t)
+	defer ln.Close()
+
+	p, err := Start(os.Args[0], "", ln.Addr().String())
+	require.NoError(t, err)
+	assert.True(t, echo(p.LocalAddr()))
+
+	// The plugin is restarted after crash.
+	p.mu.Lock()
+	pid := p.cmd.Process.Pid
+	p.cmd.Process.Kill()
+	p.mu.Unlock()
+	assert.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.cmd.Process.Pid != pid
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.True(t, echo(p.LocalAddr()))
+
+	require.NoError(t, p.Close())
+	assert.Eventually(t, func() bool {
+		c, err := net.Dial("tcp", p.LocalAddr())
+		if err == nil {
+			c.Close()
+		}
+		return err != nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestPluginNotFound(t *testing.T) {
+	_, err := Start("sip003-plugin-not-found", "", "127.0.0.1:8388")
+	assert.Error(t, err)
+}
@@ -0,0 +1,236 @@
+package ss2022
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// PacketConn implements core.PacketConnCipher, the packets written to
+// and read from the returned conn begin with the SOCKS address.
+func (c *Cipher) PacketConn(pc net.PacketConn) net.PacketConn {
+	var sessionID [8]byte
+	rand.Read(sessionID[:])
+
+	p := &packetConn{
+		PacketConn: pc,
+		cipher:     c,
+		sessionID:  sessionID,
+		packetID:   atomic.NewUint64(0),
+	}
+
+	if c.method == MethodBlake3Chacha20Poly1305 {
+		p.xchacha, _ = chacha20poly1305.NewX(c.userPSK())
+	} else {
+		// The separate header is encrypted with the first identity PSK,
+		// and decrypted with the user PSK.
+		p.encBlock, _ = aes.NewCipher(c.pskList[0])
+		p.decBlock, _ = aes.NewCipher(c.userPSK())
+		p.session, _ = c.newAEAD(c.subkey(sessionSubkeyContext, c.userPSK(), sessionID[:]))
+	}
+	return p
+}
+
+// packetConn is the UDP relay of Shadowsocks 2022, where AES methods
+// use separate header and chacha20-poly1305 uses XChaCha20-Poly1305.
+//
+// AES methods:
+//
+//	+-----------------+----------+----------------------------+
+//	| Separate Header | Identity | AEAD (Main Header, Payload) |
+//	+-----------------+----------+----------------------------+
+//
+// chacha20-poly1305:
+//
+//	+-------+-----------------------------------------------+
+//	| Nonce | AEAD (Separate Header, Main Header, Payload)  |
+//	+-------+-----------------------------------------------+
+type packetConn struct {
+	net.PacketConn
+
+	cipher    *Cipher
+	sessionID [8]byte
+	packetID  *atomic.Uint64
+
+	xchacha  cipher.AEAD
+	encBlock cipher.Block
+	decBlock cipher.Block
+	session  cipher.AEAD
+
+	mu            sync.Mutex
+	serverSession []byte
+	serverAEAD    cipher.AEAD
+	window        slidingWindow
+}
+
+func (pc *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	header := make([]byte, 0, 16+1+8+2+len(b))
+	header = append(header, pc.sessionID[:]...)
+	header = binary.BigEndian.AppendUint64(header, pc.packetID.Inc()-1)
+
+	body := header[16:]
+	body = append(body, headerTypeClient)
+	body = binary.BigEndian.AppendUint64(body, uint64(time.Now().Unix()))
+	body = binary.BigEndian.AppendUint16(body, 0 /* no padding */)
+	body = append(body, b...)
+
+	var packet []byte
+	if pc.xchacha != nil {
+		packet = make([]byte, pc.xchacha.NonceSize(), pc.xchacha.NonceSize()+len(header)+len(body)+pc.xchacha.Overhead())
+		rand.Read(packet)
+		packet = pc.xchacha.Seal(packet, packet, header[:16+len(body)], nil)
+	} else {
+		packet = make([]byte, 16, 16+16*len(pc.cipher.pskList)+len(body)+pc.session.Overhead())
+		pc.encBlock.Encrypt(packet, header[:16])
+		packet = append(packet, pc.cipher.packetIdentityHeaders(header[:16])...)
+		packet = pc.session.Seal(packet, header[4:16], body, nil)
+	}
+
+	if _, err := pc.PacketConn.WriteTo(packet, addr); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (pc *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := pc.PacketConn.ReadFrom(b)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		payload, err := pc.open(b[:n])
+		if err != nil {
+			// Drop invalid packets, which may be forged.
+			continue
+		}
+		return copy(b, payload), addr, nil
+	}
+}
+
+// open decrypts packet in place, and returns the address and payload.
+func (pc *packetConn) open(packet []byte) ([]byte, error) {
+	var (
+		header, body []byte
+		err          error
+	)
+	if pc.xchacha != nil {
+		if len(packet) < pc.xchacha.NonceSize()+16 {
+			return nil, errors.New("short packet")
+		}
+		nonce := packet[:pc.xchacha.NonceSize()]
+		if body, err = pc.xchacha.Open(packet[len(nonce):len(nonce)], nonce, packet[len(nonce):], nil); err != nil {
+			return nil, err
+		}
+		if len(body) < 16 {
+			return nil, errors.New("short packet")
+		}
+		header, body = body[:16], body[16:]
+		if err = pc.checkPacket(header, nil); err != nil {
+			return nil, err
+		}
+	} else {
+		if len(packet) < 16 {
+			return nil, errors.New("short packet")
+		}
+		header = packet[:16]
+		pc.decBlock.Decrypt(header, header)
+		if err = pc.checkPacket(header, func(aead cipher.AEAD) error {
+			body, err = aead.Open(packet[16:16], header[4:16], packet[16:], nil)
+			return err
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// Type, Timestamp, Client Session ID, Padding Length, Padding
+	if len(body) < 1+8+8+2 {
+		return nil, errors.New("short packet")
+	}
+	if body[0] != headerTypeServer {
+		return nil, ErrBadHeaderType
+	}
+	if err = checkTimestamp(body[1:9]); err != nil {
+		return nil, err
+	}
+	if string(body[9:17]) != string(pc.sessionID[:]) {
+		return nil, errors.New("bad client session id")
+	}
+	padding := int(binary.BigEndian.Uint16(body[17:19]))
+	if len(body) < 19+padding {
+		return nil, errors.New("short packet")
+	}
+	return body[19+padding:], nil
+}
+
+// checkPacket opens the body with the AEAD of server session if open
+// is not nil, and checks the packet ID against replays.
+func (pc *packetConn) checkPacket(header []byte, open func(cipher.AEAD) error) error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	sessionID, packetID := header[:8], binary.BigEndian.Uint64(header[8:16])
+	newSession := string(sessionID) != string(pc.serverSession)
+
+	if open != nil {
+		aead := pc.serverAEAD
+		if newSession {
+			var err error
+			if aead, err = pc.cipher.newAEAD(pc.cipher.subkey(sessionSubkeyContext, pc.cipher.userPSK(), sessionID)); err != nil {
+				return err
+			}
+		}
+		if err := open(aead); err != nil {
+			return err
+		}
+		pc.serverAEAD = aead
+	}
+
+	if newSession {
+		pc.serverSession = append([]byte(nil), sessionID...)
+		pc.window = slidingWindow{}
+	}
+	if !pc.window.check(packetID) {
+		return ErrPacketReplayed
+	}
+	return nil
+}
+
+// windowSize is the size of sliding window for packet IDs.
+const windowSize = 64
+
+// slidingWindow filters the replayed packet IDs.
+type slidingWindow struct {
+	started bool
+	last    uint64
+	bitmap  uint64
+}
+
+// check records id, and returns false if id is replayed or too old.
+func (w *slidingWindow) check(id uint64) bool {
+	if !w.started || id > w.last {
+		if shift := id - w.last; !w.started || shift >= windowSize {
+			w.bitmap = 0
+		} else {
+			w.bitmap <<= shift
+		}
+		w.started, w.last = true, id
+		w.bitmap |= 1
+		return true
+	}
+
+	diff := w.last - id
+	if diff >= windowSize || w.bitmap&(1<<diff) != 0 {
+		return false
+	}
+	w.bitmap |= 1 << diff
+	return true
+}
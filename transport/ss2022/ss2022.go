@@ -0,0 +1,217 @@
+// Package ss2022 implements Shadowsocks 2022 (SIP022) AEAD ciphers, with
+// the identity headers of multi-user servers.
+//
+// Ref: https://github.com/Shadowsocks-NET/shadowsocks-specs/blob/main/2022-1-shadowsocks-2022-edition.md
+package ss2022
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dreamacro/go-shadowsocks2/core"
+	"golang.org/x/crypto/chacha20poly1305"
+	"lukechampine.com/blake3"
+)
+
+// Methods of Shadowsocks 2022.
+const (
+	MethodBlake3AES128GCM        = "2022-blake3-aes-128-gcm"
+	MethodBlake3AES256GCM        = "2022-blake3-aes-256-gcm"
+	MethodBlake3Chacha20Poly1305 = "2022-blake3-chacha20-poly1305"
+)
+
+const (
+	headerTypeClient = 0
+	headerTypeServer = 1
+
+	// maxTimeDiff is the max difference between the timestamp in
+	// header and local time.
+	maxTimeDiff = 30 * time.Second
+
+	// maxPaddingLength is the max length of padding in header.
+	maxPaddingLength = 900
+
+	// maxPayloadLength is the max length of payload in chunk.
+	maxPayloadLength = 0xffff
+
+	sessionSubkeyContext  = "shadowsocks 2022 session subkey"
+	identitySubkeyContext = "shadowsocks 2022 identity subkey"
+)
+
+var (
+	ErrBadTimestamp   = errors.New("bad timestamp")
+	ErrBadHeaderType  = errors.New("bad header type")
+	ErrBadRequestSalt = errors.New("bad request salt")
+	ErrSaltReplayed   = errors.New("salt replayed")
+	ErrPacketReplayed = errors.New("packet replayed")
+)
+
+// IsMethod reports whether method is a Shadowsocks 2022 method.
+func IsMethod(method string) bool {
+	return strings.HasPrefix(strings.ToLower(method), "2022-blake3-")
+}
+
+var _ core.Cipher = (*Cipher)(nil)
+
+// Cipher is a Shadowsocks 2022 cipher, which implements the Cipher of
+// go-shadowsocks2 core.
+type Cipher struct {
+	method  string
+	keySize int
+
+	// pskList is the identity PSKs followed by the user PSK.
+	pskList [][]byte
+
+	newAEAD func(key []byte) (cipher.AEAD, error)
+
+	// saltPool records the salts of server streams.
+	saltPool *saltPool
+}
+
+// NewCipher creates Cipher with the password, which is the base64
+// encoded PSK, or PSKs joined by ':' for multi-user servers.
+func NewCipher(method, password string) (*Cipher, error) {
+	c := &Cipher{method: strings.ToLower(method), saltPool: newSaltPool(2 * maxTimeDiff)}
+
+	switch c.method {
+	case MethodBlake3AES128GCM:
+		c.keySize, c.newAEAD = 16, newGCM
+	case MethodBlake3AES256GCM:
+		c.keySize, c.newAEAD = 32, newGCM
+	case MethodBlake3Chacha20Poly1305:
+		c.keySize, c.newAEAD = 32, chacha20poly1305.New
+	default:
+		return nil, fmt.Errorf("unsupported method: %s", method)
+	}
+
+	for _, s := range strings.Split(password, ":") {
+		psk, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("decode psk: %w", err)
+		}
+		if len(psk) != c.keySize {
+			return nil, fmt.Errorf("bad psk length: %d", len(psk))
+		}
+		c.pskList = append(c.pskList, psk)
+	}
+
+	if len(c.pskList) > 1 && c.method == MethodBlake3Chacha20Poly1305 {
+		return nil, errors.New("identity headers are not supported by chacha20-poly1305")
+	}
+	return c, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// userPSK returns the PSK of user, which is the last one.
+func (c *Cipher) userPSK() []byte {
+	return c.pskList[len(c.pskList)-1]
+}
+
+// subkey derives the subkey of context from psk and salt.
+func (c *Cipher) subkey(context string, psk, salt []byte) []byte {
+	material := make([]byte, 0, len(psk)+len(salt))
+	material = append(material, psk...)
+	material = append(material, salt...)
+
+	key := make([]byte, c.keySize)
+	blake3.DeriveKey(key, context, material)
+	return key
+}
+
+// identityHeaders returns the identity headers of stream, where each
+// header is the hash of next PSK encrypted with the identity subkey of
+// PSK and salt.
+func (c *Cipher) identityHeaders(salt []byte) []byte {
+	var headers []byte
+	for i := 0; i < len(c.pskList)-1; i++ {
+		hash := blake3.Sum256(c.pskList[i+1])
+		headers = append(headers, encryptBlock(c.subkey(identitySubkeyContext, c.pskList[i], salt), hash[:aes.BlockSize])...)
+	}
+	return headers
+}
+
+// packetIdentityHeaders returns the identity headers of packet, where
+// each header is the hash of next PSK XOR the separate header encrypted
+// with PSK itself.
+func (c *Cipher) packetIdentityHeaders(separateHeader []byte) []byte {
+	var headers []byte
+	for i := 0; i < len(c.pskList)-1; i++ {
+		hash := blake3.Sum256(c.pskList[i+1])
+		for j := 0; j < aes.BlockSize; j++ {
+			hash[j] ^= separateHeader[j]
+		}
+		headers = append(headers, encryptBlock(c.pskList[i], hash[:aes.BlockSize])...)
+	}
+	return headers
+}
+
+// encryptBlock encrypts a single AES block with key.
+func encryptBlock(key, plaintext []byte) []byte {
+	block, _ := aes.NewCipher(key)
+	out := make([]byte, aes.BlockSize)
+	block.Encrypt(out, plaintext)
+	return out
+}
+
+// checkTimestamp checks if the timestamp is within maxTimeDiff.
+func checkTimestamp(b []byte) error {
+	diff := time.Since(time.Unix(int64(binary.BigEndian.Uint64(b)), 0))
+	if diff > maxTimeDiff || diff < -maxTimeDiff {
+		return ErrBadTimestamp
+	}
+	return nil
+}
+
+// increaseNonce increases the little-endian nonce by one.
+func increaseNonce(nonce []byte) {
+	for i := range nonce {
+		nonce[i]++
+		if nonce[i] != 0 {
+			return
+		}
+	}
+}
+
+// saltPool records salts in the past ttl to detect replays.
+type saltPool struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	salts map[string]time.Time
+}
+
+func newSaltPool(ttl time.Duration) *saltPool {
+	return &saltPool{ttl: ttl, salts: make(map[string]time.Time)}
+}
+
+// check records salt, and returns false if salt is replayed.
+func (p *saltPool) check(salt []byte) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for s, expire := range p.salts {
+		if now.After(expire) {
+			delete(p.salts, s)
+		}
+	}
+
+	if _, ok := p.salts[string(salt)]; ok {
+		return false
+	}
+	p.salts[string(salt)] = now.Add(p.ttl)
+	return true
+}
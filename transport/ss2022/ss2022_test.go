@@ -0,0 +1,285 @@
+package ss2022
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/chacha20poly1305"
+	"lukechampine.com/blake3"
+
+	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+)
+
+func newPassword(n, keySize int) string {
+	psks := make([]string, n)
+	for i := range psks {
+		psk := make([]byte, keySize)
+		rand.Read(psk)
+		psks[i] = base64.StdEncoding.EncodeToString(psk)
+	}
+	return strings.Join(psks, ":")
+}
+
+// The servers below follow SIP022 and SIP023 with their own key
+// derivation, so that they don't share the mistakes of Cipher.
+const (
+	specIdentitySubkey = "shadowsocks 2022 identity subkey"
+	specSessionSubkey  = "shadowsocks 2022 session subkey"
+)
+
+// specSubkey is blake3::derive_key(context, psk + salt).
+func specSubkey(context string, psk, salt []byte) []byte {
+	material := append(append([]byte(nil), psk...), salt...)
+	key := make([]byte, len(psk))
+	blake3.DeriveKey(key, context, material)
+	return key
+}
+
+// newSpecAEAD returns the AEAD of SIP022 AES methods with key.
+func newSpecAEAD(t *testing.T, key []byte) cipher.AEAD {
+	block, err := aes.NewCipher(key)
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+	return aead
+}
+
+// serveStream is a minimal Shadowsocks 2022 server, which checks the
+// identity headers and echoes the payload back.
+func serveStream(t *testing.T, c *Cipher, conn net.Conn, addr socks5.Addr) {
+	defer conn.Close()
+
+	salt := make([]byte, c.keySize)
+	if _, err := io.ReadFull(conn, salt); !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < len(c.pskList)-1; i++ {
+		header := make([]byte, aes.BlockSize)
+		if _, err := io.ReadFull(conn, header); !assert.NoError(t, err) {
+			return
+		}
+		block, _ := aes.NewCipher(specSubkey(specIdentitySubkey, c.pskList[i], salt))
+		block.Decrypt(header, header)
+		hash := blake3.Sum256(c.pskList[i+1])
+		assert.Equal(t, hash[:aes.BlockSize], header)
+	}
+
+	reader, _ := c.newAEAD(specSubkey(specSessionSubkey, c.userPSK(), salt))
+	rNonce := make([]byte, reader.NonceSize())
+	open := func(n int) []byte {
+		buf := make([]byte, n+reader.Overhead())
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil
+		}
+		buf, err := reader.Open(buf[:0], rNonce, buf, nil)
+		increaseNonce(rNonce)
+		assert.NoError(t, err)
+		return buf
+	}
+
+	fixed := open(1 + 8 + 2)
+	if !assert.Len(t, fixed, 11) || !assert.Equal(t, byte(headerTypeClient), fixed[0]) {
+		return
+	}
+	variable := open(int(binary.BigEndian.Uint16(fixed[9:])))
+	if !assert.True(t, bytes.HasPrefix(variable, addr)) {
+		return
+	}
+	padding := int(binary.BigEndian.Uint16(variable[len(addr):]))
+	payload := variable[len(addr)+2+padding:]
+
+	respSalt := make([]byte, c.keySize)
+	rand.Read(respSalt)
+	writer, _ := c.newAEAD(specSubkey(specSessionSubkey, c.userPSK(), respSalt))
+	wNonce := make([]byte, writer.NonceSize())
+	seal := func(dst, b []byte) []byte {
+		dst = writer.Seal(dst, wNonce, b, nil)
+		increaseNonce(wNonce)
+		return dst
+	}
+
+	for {
+		if len(payload) == 0 {
+			length := open(2)
+			if length == nil {
+				return
+			}
+			payload = open(int(binary.BigEndian.Uint16(length)))
+		}
+
+		var out []byte
+		if respSalt != nil {
+			header := []byte{headerTypeServer}
+			header = binary.BigEndian.AppendUint64(header, uint64(time.Now().Unix()))
+			header = append(header, salt...)
+			header = binary.BigEndian.AppendUint16(header, uint16(len(payload)))
+			out = seal(append(out, respSalt...), header)
+			respSalt = nil
+		} else {
+			out = seal(out, binary.BigEndian.AppendUint16(nil, uint16(len(payload))))
+		}
+		if _, err := conn.Write(seal(out, payload)); err != nil {
+			return
+		}
+		payload = nil
+	}
+}
+
+func TestStreamConn(t *testing.T) {
+	addr := socks5.SerializeAddr("example.com", nil, 443)
+
+	for _, tt := range []struct {
+		method   string
+		password string
+	}{
+		{MethodBlake3AES128GCM, newPassword(3, 16)},
+		{MethodBlake3AES256GCM, newPassword(1, 32)},
+		{MethodBlake3Chacha20Poly1305, newPassword(1, 32)},
+	} {
+		t.Run(tt.method, func(t *testing.T) {
+			c, err := NewCipher(tt.method, tt.password)
+			require.NoError(t, err)
+
+			client, server := net.Pipe()
+			go serveStream(t, c, server, addr)
+
+			conn := c.StreamConn(client)
+			defer conn.Close()
+
+			_, err = conn.Write(addr)
+			require.NoError(t, err)
+
+			data := bytes.Repeat([]byte("ss2022"), 20000)
+			go conn.Write(data)
+
+			buf := make([]byte, len(data))
+			_, err = io.ReadFull(conn, buf)
+			require.NoError(t, err)
+			assert.Equal(t, data, buf)
+		})
+	}
+}
+
+// echoPacket decrypts the request packet, and returns the response
+// packet of the same address and payload from server session.
+func echoPacket(t *testing.T, c *Cipher, packet []byte, serverSession []byte, packetID uint64) []byte {
+	packet = append([]byte(nil), packet...)
+
+	var header, body []byte
+	if c.method == MethodBlake3Chacha20Poly1305 {
+		aead, _ := chacha20poly1305.NewX(c.userPSK())
+		plain, err := aead.Open(nil, packet[:aead.NonceSize()], packet[aead.NonceSize():], nil)
+		require.NoError(t, err)
+		header, body = plain[:16], plain[16:]
+	} else {
+		header = make([]byte, 16)
+		block, _ := aes.NewCipher(c.pskList[0])
+		block.Decrypt(header, packet[:16])
+		packet = packet[16:]
+
+		// The identity headers are encrypted with iPSKs, rather than
+		// the subkeys as stream.
+		for i := 0; i < len(c.pskList)-1; i++ {
+			block, _ := aes.NewCipher(c.pskList[i])
+			block.Decrypt(packet[:16], packet[:16])
+			hash := blake3.Sum256(c.pskList[i+1])
+			for j := range header {
+				hash[j] ^= header[j]
+			}
+			assert.Equal(t, hash[:16], packet[:16])
+			packet = packet[16:]
+		}
+
+		aead := newSpecAEAD(t, specSubkey(specSessionSubkey, c.userPSK(), header[:8]))
+		var err error
+		body, err = aead.Open(nil, header[4:16], packet, nil)
+		require.NoError(t, err)
+	}
+	require.Equal(t, byte(headerTypeClient), body[0])
+	data := body[1+8+2+int(binary.BigEndian.Uint16(body[9:11])):]
+
+	resp := append([]byte(nil), serverSession...)
+	resp = binary.BigEndian.AppendUint64(resp, packetID)
+	resp = append(resp, headerTypeServer)
+	resp = binary.BigEndian.AppendUint64(resp, uint64(time.Now().Unix()))
+	resp = append(resp, header[:8]...)
+	resp = binary.BigEndian.AppendUint16(resp, 0)
+	resp = append(resp, data...)
+
+	if c.method == MethodBlake3Chacha20Poly1305 {
+		aead, _ := chacha20poly1305.NewX(c.userPSK())
+		nonce := make([]byte, aead.NonceSize())
+		rand.Read(nonce)
+		return aead.Seal(nonce, nonce, resp, nil)
+	}
+	aead := newSpecAEAD(t, specSubkey(specSessionSubkey, c.userPSK(), serverSession))
+	out := make([]byte, 16)
+	block, _ := aes.NewCipher(c.userPSK())
+	block.Encrypt(out, resp[:16])
+	return aead.Seal(out, resp[4:16], resp[16:], nil)
+}
+
+func TestPacketConn(t *testing.T) {
+	for _, tt := range []struct {
+		method   string
+		password string
+	}{
+		{MethodBlake3AES128GCM, newPassword(2, 16)},
+		{MethodBlake3Chacha20Poly1305, newPassword(1, 32)},
+	} {
+		t.Run(tt.method, func(t *testing.T) {
+			c, err := NewCipher(tt.method, tt.password)
+			require.NoError(t, err)
+
+			server, err := net.ListenPacket("udp", "127.0.0.1:0")
+			require.NoError(t, err)
+			defer server.Close()
+
+			local, err := net.ListenPacket("udp", "127.0.0.1:0")
+			require.NoError(t, err)
+			pc := c.PacketConn(local)
+			defer pc.Close()
+
+			packet := append([]byte(socks5.SerializeAddr("", net.IPv4(1, 1, 1, 1), 53)), "query"...)
+			_, err = pc.WriteTo(packet, server.LocalAddr())
+			require.NoError(t, err)
+
+			buf := make([]byte, 1024)
+			n, from, err := server.ReadFrom(buf)
+			require.NoError(t, err)
+
+			serverSession := make([]byte, 8)
+			rand.Read(serverSession)
+			resp := echoPacket(t, c, buf[:n], serverSession, 0)
+
+			// The replayed response is dropped.
+			for i := 0; i < 2; i++ {
+				_, err = server.WriteTo(resp, from)
+				require.NoError(t, err)
+			}
+			_, err = server.WriteTo(echoPacket(t, c, buf[:n], serverSession, 1), from)
+			require.NoError(t, err)
+
+			for i := 0; i < 2; i++ {
+				pc.SetReadDeadline(time.Now().Add(time.Second))
+				n, _, err = pc.ReadFrom(buf)
+				require.NoError(t, err)
+				assert.Equal(t, packet, buf[:n])
+			}
+			pc.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			_, _, err = pc.ReadFrom(buf)
+			assert.Error(t, err)
+		})
+	}
+}
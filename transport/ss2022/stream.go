@@ -0,0 +1,227 @@
+package ss2022
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+)
+
+// StreamConn implements core.StreamConnCipher, the first Write to the
+// returned conn must begin with the SOCKS address of destination.
+func (c *Cipher) StreamConn(conn net.Conn) net.Conn {
+	salt := make([]byte, c.keySize)
+	rand.Read(salt)
+
+	// The key size is always valid for AEAD.
+	writer, _ := c.newAEAD(c.subkey(sessionSubkeyContext, c.userPSK(), salt))
+
+	return &streamConn{
+		Conn:        conn,
+		cipher:      c,
+		requestSalt: salt,
+		writer:      writer,
+		wNonce:      make([]byte, writer.NonceSize()),
+	}
+}
+
+// streamConn is the TCP stream of Shadowsocks 2022.
+//
+// Request stream:
+//
+//	+------+----------+--------------+-----------------+--------+---------+
+//	| Salt | Identity | Fixed Header | Variable Header | Length | Payload |
+//	+------+----------+--------------+-----------------+--------+---------+
+//
+// Response stream:
+//
+//	+------+--------------+---------+--------+---------+
+//	| Salt | Fixed Header | Payload | Length | Payload |
+//	+------+--------------+---------+--------+---------+
+type streamConn struct {
+	net.Conn
+
+	cipher      *Cipher
+	requestSalt []byte
+
+	wMu     sync.Mutex
+	writer  cipher.AEAD
+	wNonce  []byte
+	written bool
+
+	rMu    sync.Mutex
+	reader cipher.AEAD
+	rNonce []byte
+	remain []byte
+}
+
+func (c *streamConn) seal(dst, plaintext []byte) []byte {
+	dst = c.writer.Seal(dst, c.wNonce, plaintext, nil)
+	increaseNonce(c.wNonce)
+	return dst
+}
+
+func (c *streamConn) open(ciphertext []byte) ([]byte, error) {
+	plaintext, err := c.reader.Open(ciphertext[:0], c.rNonce, ciphertext, nil)
+	increaseNonce(c.rNonce)
+	return plaintext, err
+}
+
+func (c *streamConn) Write(b []byte) (int, error) {
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+
+	payload := b
+	if !c.written {
+		n, err := c.writeHeader(b)
+		if err != nil {
+			return 0, err
+		}
+		payload = b[n:]
+	}
+
+	for len(payload) > 0 {
+		chunk := payload
+		if len(chunk) > maxPayloadLength {
+			chunk = chunk[:maxPayloadLength]
+		}
+
+		var length [2]byte
+		binary.BigEndian.PutUint16(length[:], uint16(len(chunk)))
+
+		buf := make([]byte, 0, 2+len(chunk)+2*c.writer.Overhead())
+		buf = c.seal(buf, length[:])
+		buf = c.seal(buf, chunk)
+		if _, err := c.Conn.Write(buf); err != nil {
+			return 0, err
+		}
+		payload = payload[len(chunk):]
+	}
+	return len(b), nil
+}
+
+// writeHeader writes the request header with the address at the
+// beginning of b, and returns the bytes of b consumed.
+func (c *streamConn) writeHeader(b []byte) (int, error) {
+	addr := socks5.SplitAddr(b)
+	if addr == nil {
+		return 0, errors.New("address is invalid")
+	}
+
+	payload := b[len(addr):]
+	if max := maxPayloadLength - len(addr) - 2; len(payload) > max {
+		payload = payload[:max]
+	}
+
+	// Padding is required if there's no initial payload.
+	var padding []byte
+	if len(payload) == 0 {
+		n, _ := rand.Int(rand.Reader, big.NewInt(maxPaddingLength))
+		padding = make([]byte, n.Int64()+1)
+	}
+
+	variable := make([]byte, 0, len(addr)+2+len(padding)+len(payload))
+	variable = append(variable, addr...)
+	variable = binary.BigEndian.AppendUint16(variable, uint16(len(padding)))
+	variable = append(variable, padding...)
+	variable = append(variable, payload...)
+
+	fixed := make([]byte, 0, 1+8+2)
+	fixed = append(fixed, headerTypeClient)
+	fixed = binary.BigEndian.AppendUint64(fixed, uint64(time.Now().Unix()))
+	fixed = binary.BigEndian.AppendUint16(fixed, uint16(len(variable)))
+
+	header := bytes.Join([][]byte{c.requestSalt, c.cipher.identityHeaders(c.requestSalt)}, nil)
+	header = c.seal(header, fixed)
+	header = c.seal(header, variable)
+	if _, err := c.Conn.Write(header); err != nil {
+		return 0, err
+	}
+	c.written = true
+	return len(addr) + len(payload), nil
+}
+
+func (c *streamConn) Read(b []byte) (int, error) {
+	c.rMu.Lock()
+	defer c.rMu.Unlock()
+
+	for len(c.remain) == 0 {
+		var err error
+		if c.reader == nil {
+			c.remain, err = c.readHeader()
+		} else {
+			c.remain, err = c.readChunk()
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, c.remain)
+	c.remain = c.remain[n:]
+	return n, nil
+}
+
+// readHeader reads the response header, and returns the first payload.
+func (c *streamConn) readHeader() ([]byte, error) {
+	salt := make([]byte, c.cipher.keySize)
+	if _, err := io.ReadFull(c.Conn, salt); err != nil {
+		return nil, err
+	}
+	if !c.cipher.saltPool.check(salt) {
+		return nil, ErrSaltReplayed
+	}
+
+	reader, err := c.cipher.newAEAD(c.cipher.subkey(sessionSubkeyContext, c.cipher.userPSK(), salt))
+	if err != nil {
+		return nil, err
+	}
+	c.reader, c.rNonce = reader, make([]byte, reader.NonceSize())
+
+	fixed := make([]byte, 1+8+len(salt)+2+reader.Overhead())
+	if _, err = io.ReadFull(c.Conn, fixed); err != nil {
+		return nil, err
+	}
+	if fixed, err = c.open(fixed); err != nil {
+		return nil, err
+	}
+
+	if fixed[0] != headerTypeServer {
+		return nil, ErrBadHeaderType
+	}
+	if err = checkTimestamp(fixed[1:9]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(fixed[9:9+len(salt)], c.requestSalt) {
+		return nil, ErrBadRequestSalt
+	}
+	return c.readPayload(int(binary.BigEndian.Uint16(fixed[9+len(salt):])))
+}
+
+func (c *streamConn) readChunk() ([]byte, error) {
+	length := make([]byte, 2+c.reader.Overhead())
+	if _, err := io.ReadFull(c.Conn, length); err != nil {
+		return nil, err
+	}
+	length, err := c.open(length)
+	if err != nil {
+		return nil, err
+	}
+	return c.readPayload(int(binary.BigEndian.Uint16(length)))
+}
+
+func (c *streamConn) readPayload(n int) ([]byte, error) {
+	payload := make([]byte, n+c.reader.Overhead())
+	if _, err := io.ReadFull(c.Conn, payload); err != nil {
+		return nil, err
+	}
+	return c.open(payload)
+}
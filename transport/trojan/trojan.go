@@ -0,0 +1,106 @@
+// Package trojan provides Trojan client functionalities.
+package trojan
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+)
+
+// KeyLength is the length of hex encoded SHA224 password.
+const KeyLength = sha256.Size224 * 2
+
+// MaxPayloadLength is the max length of payload in a UDP packet.
+const MaxPayloadLength = 1<<16 - 1
+
+var crlf = []byte{'\r', '\n'}
+
+// Key returns the hex encoded SHA224 of password, which is sent
+// as the credential in request header.
+func Key(password string) []byte {
+	hash := sha256.Sum224([]byte(password))
+	key := make([]byte, KeyLength)
+	hex.Encode(key, hash[:])
+	return key
+}
+
+// WriteHeader writes the request header to w, the command should be
+// either socks5.CmdConnect or socks5.CmdUDPAssociate.
+//
+//	+-----------------------+---------+----------------+---------+
+//	| hex(SHA224(password)) |  CRLF   | Trojan Request |  CRLF   |
+//	+-----------------------+---------+----------------+---------+
+//	|          56           | X'0D0A' |    Variable    | X'0D0A' |
+//	+-----------------------+---------+----------------+---------+
+//
+// where Trojan Request is CMD followed by a SOCKS5 address.
+func WriteHeader(w io.Writer, key []byte, command socks5.Command, addr socks5.Addr) error {
+	if len(key) != KeyLength {
+		return errors.New("invalid key length")
+	}
+	header := bytes.Join([][]byte{key, crlf, {byte(command)}, addr, crlf}, nil)
+	_, err := w.Write(header)
+	return err
+}
+
+// WritePacket writes a UDP packet to w in a single write.
+//
+//	+------+----------+----------+--------+---------+----------+
+//	| ATYP | DST.ADDR | DST.PORT | Length |  CRLF   | Payload  |
+//	+------+----------+----------+--------+---------+----------+
+//	|  1   | Variable |    2     |   2    | X'0D0A' | Variable |
+//	+------+----------+----------+--------+---------+----------+
+func WritePacket(w io.Writer, addr socks5.Addr, payload []byte) (int, error) {
+	if addr == nil {
+		return 0, errors.New("address is invalid")
+	}
+	if len(payload) > MaxPayloadLength {
+		return 0, io.ErrShortWrite
+	}
+
+	var length [2]byte
+	binary.BigEndian.PutUint16(length[:], uint16(len(payload)))
+
+	packet := bytes.Join([][]byte{addr, length[:], crlf, payload}, nil)
+	if _, err := w.Write(packet); err != nil {
+		return 0, err
+	}
+	return len(payload), nil
+}
+
+// ReadPacket reads a UDP packet from r into payload, the part of
+// packet exceeding payload is discarded.
+func ReadPacket(r io.Reader, payload []byte) (socks5.Addr, int, error) {
+	buf := make([]byte, socks5.MaxAddrLen+2+len(crlf))
+
+	addr, err := socks5.ReadAddr(r, buf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tail := buf[len(addr) : len(addr)+2+len(crlf)]
+	if _, err = io.ReadFull(r, tail); err != nil {
+		return nil, 0, err
+	}
+	if !bytes.Equal(tail[2:], crlf) {
+		return nil, 0, errors.New("invalid packet delimiter")
+	}
+
+	length := int(binary.BigEndian.Uint16(tail[:2]))
+	n := length
+	if n > len(payload) {
+		n = len(payload)
+	}
+	if _, err = io.ReadFull(r, payload[:n]); err != nil {
+		return nil, 0, err
+	}
+	if _, err = io.CopyN(io.Discard, r, int64(length-n)); err != nil {
+		return nil, 0, err
+	}
+	return addr, n, nil
+}
@@ -0,0 +1,153 @@
+// Package uot provides the UDP-over-TCP protocol version 2, which is
+// also known as "uot" in sing-box, relaying UDP packets over a stream.
+package uot
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+)
+
+// MagicAddress is the destination requested to the proxy server for
+// UDP-over-TCP, e.g. by CONNECT of socks5.
+const MagicAddress = "sp.v2.udp-over-tcp.arpa"
+
+// MaxPayloadLength is the max length of payload in a packet.
+const MaxPayloadLength = 1<<16 - 1
+
+// UoT address types, which differ from SOCKS5.
+const (
+	AtypIPv4       = 0x00
+	AtypIPv6       = 0x01
+	AtypDomainName = 0x02
+)
+
+// MagicAddr returns the SOCKS5 address of MagicAddress.
+func MagicAddr() socks5.Addr {
+	return socks5.SerializeAddr(MagicAddress, nil, 0)
+}
+
+// encodeAddr converts SOCKS5 addr to UoT address, which only differs
+// in address type.
+func encodeAddr(addr socks5.Addr) ([]byte, error) {
+	if !addr.Valid() {
+		return nil, errors.New("address is invalid")
+	}
+
+	b := bytes.Clone(addr)
+	switch addr[0] {
+	case socks5.AtypIPv4:
+		b[0] = AtypIPv4
+	case socks5.AtypIPv6:
+		b[0] = AtypIPv6
+	case socks5.AtypDomainName:
+		b[0] = AtypDomainName
+	default:
+		return nil, errors.New("invalid address type")
+	}
+	return b, nil
+}
+
+// readAddr reads UoT address from r, and returns it as SOCKS5 address.
+func readAddr(r io.Reader) (socks5.Addr, error) {
+	b := make([]byte, socks5.MaxAddrLen)
+	if _, err := io.ReadFull(r, b[:2]); err != nil {
+		return nil, err
+	}
+
+	var n int
+	switch b[0] {
+	case AtypIPv4:
+		b[0], n = socks5.AtypIPv4, 1+4+2
+	case AtypIPv6:
+		b[0], n = socks5.AtypIPv6, 1+16+2
+	case AtypDomainName:
+		b[0], n = socks5.AtypDomainName, 1+1+int(b[1])+2
+	default:
+		return nil, errors.New("invalid address type")
+	}
+
+	if _, err := io.ReadFull(r, b[2:n]); err != nil {
+		return nil, err
+	}
+	return b[:n], nil
+}
+
+// WriteRequest writes the request header to w, where addr is the
+// destination of packets if connect is true.
+//
+//	+-----------+-------------+
+//	| IsConnect | Destination |
+//	+-----------+-------------+
+//	|     1     |  Variable   |
+//	+-----------+-------------+
+func WriteRequest(w io.Writer, connect bool, addr socks5.Addr) error {
+	dst, err := encodeAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	var isConnect byte
+	if connect {
+		isConnect = 1
+	}
+	_, err = w.Write(append([]byte{isConnect}, dst...))
+	return err
+}
+
+// WritePacket writes a UDP packet of non-connect request to w in a
+// single write.
+//
+//	+---------+--------+----------+
+//	| Address | Length | Payload  |
+//	+---------+--------+----------+
+//	| Variable|   2    | Variable |
+//	+---------+--------+----------+
+func WritePacket(w io.Writer, addr socks5.Addr, payload []byte) (int, error) {
+	if len(payload) > MaxPayloadLength {
+		return 0, io.ErrShortWrite
+	}
+
+	dst, err := encodeAddr(addr)
+	if err != nil {
+		return 0, err
+	}
+
+	var length [2]byte
+	binary.BigEndian.PutUint16(length[:], uint16(len(payload)))
+
+	if _, err = w.Write(bytes.Join([][]byte{dst, length[:], payload}, nil)); err != nil {
+		return 0, err
+	}
+	return len(payload), nil
+}
+
+// ReadPacket reads a UDP packet of non-connect request from r into
+// payload, the part of packet exceeding payload is discarded.
+func ReadPacket(r io.Reader, payload []byte) (socks5.Addr, int, error) {
+	addr, err := readAddr(r)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var length [2]byte
+	if _, err = io.ReadFull(r, length[:]); err != nil {
+		return nil, 0, err
+	}
+
+	size := int(binary.BigEndian.Uint16(length[:]))
+	n := size
+	if n > len(payload) {
+		n = len(payload)
+	}
+	if _, err = io.ReadFull(r, payload[:n]); err != nil {
+		return nil, 0, err
+	}
+	if _, err = io.CopyN(io.Discard, r, int64(size-n)); err != nil {
+		return nil, 0, err
+	}
+	return addr, n, nil
+}
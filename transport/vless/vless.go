@@ -0,0 +1,155 @@
+// Package vless provides VLESS client functionalities.
+package vless
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+)
+
+// Version is the protocol version of VLESS.
+const Version = 0x00
+
+// Command is the request command of VLESS.
+type Command = uint8
+
+const (
+	CommandTCP Command = 0x01
+	CommandUDP Command = 0x02
+)
+
+// VLESS address types, which differ from SOCKS5.
+const (
+	AtypIPv4       = 0x01
+	AtypDomainName = 0x02
+	AtypIPv6       = 0x03
+)
+
+// Client is a VLESS client with the user ID.
+type Client struct {
+	id uuid.UUID
+}
+
+func NewClient(id string) (*Client, error) {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uuid: %w", err)
+	}
+	return &Client{id: u}, nil
+}
+
+// StreamConn writes the request header of command to addr through c,
+// and the response header is read on the first Read.
+func (cl *Client) StreamConn(c net.Conn, command Command, addr socks5.Addr) (net.Conn, error) {
+	atyp, host, port, err := EncodeAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	// +---------+------+--------+---------+------+------+----------+
+	// | Version | UUID | Addons | Command | Port | Atyp | Address  |
+	// +---------+------+--------+---------+------+------+----------+
+	// |    1    |  16  |   1    |    1    |  2   |  1   | Variable |
+	// +---------+------+--------+---------+------+------+----------+
+	header := bytes.Join([][]byte{{Version}, cl.id[:], {0 /* no addons */, command}, port, {atyp}, host}, nil)
+	if _, err = c.Write(header); err != nil {
+		return nil, err
+	}
+	return &Conn{Conn: c}, nil
+}
+
+// Conn is a VLESS connection.
+type Conn struct {
+	net.Conn
+
+	once sync.Once
+	err  error
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(func() { c.err = c.readResponse() })
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.Conn.Read(b)
+}
+
+// readResponse reads and discards the response header.
+func (c *Conn) readResponse() error {
+	buf := make([]byte, 0xff)
+	if _, err := io.ReadFull(c.Conn, buf[:2]); err != nil {
+		return err
+	}
+	if buf[0] != Version {
+		return fmt.Errorf("unexpected version: %d", buf[0])
+	}
+	_, err := io.ReadFull(c.Conn, buf[:buf[1]] /* addons */)
+	return err
+}
+
+// EncodeAddr converts SOCKS5 addr to the address type, address and port
+// fields of VLESS, which are also used by VMess.
+func EncodeAddr(addr socks5.Addr) (atyp byte, host, port []byte, err error) {
+	if addr == nil || len(addr) < 1+2 {
+		return 0, nil, nil, errors.New("address is invalid")
+	}
+
+	host, port = addr[1:len(addr)-2], addr[len(addr)-2:]
+	switch addr[0] {
+	case socks5.AtypIPv4:
+		atyp = AtypIPv4
+	case socks5.AtypDomainName:
+		atyp = AtypDomainName
+	case socks5.AtypIPv6:
+		atyp = AtypIPv6
+	default:
+		return 0, nil, nil, errors.New("invalid address type")
+	}
+	return
+}
+
+// WritePacket writes a UDP packet prefixed with its length to w.
+func WritePacket(w io.Writer, payload []byte) (int, error) {
+	if len(payload) > 0xffff {
+		return 0, io.ErrShortWrite
+	}
+
+	packet := make([]byte, 2+len(payload))
+	binary.BigEndian.PutUint16(packet, uint16(len(payload)))
+	copy(packet[2:], payload)
+
+	if _, err := w.Write(packet); err != nil {
+		return 0, err
+	}
+	return len(payload), nil
+}
+
+// ReadPacket reads a length prefixed UDP packet from r into payload,
+// the part of packet exceeding payload is discarded.
+func ReadPacket(r io.Reader, payload []byte) (int, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return 0, err
+	}
+
+	size := int(binary.BigEndian.Uint16(length[:]))
+	n := size
+	if n > len(payload) {
+		n = len(payload)
+	}
+	if _, err := io.ReadFull(r, payload[:n]); err != nil {
+		return 0, err
+	}
+	if _, err := io.CopyN(io.Discard, r, int64(size-n)); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
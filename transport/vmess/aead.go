@@ -0,0 +1,130 @@
+package vmess
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// KDF salts of VMess AEAD header.
+const (
+	kdfSaltVMessAEADKDF               = "VMess AEAD KDF"
+	kdfSaltAuthIDEncryptionKey        = "AES Auth ID Encryption"
+	kdfSaltHeaderPayloadAEADKey       = "VMess Header AEAD Key"
+	kdfSaltHeaderPayloadAEADIV        = "VMess Header AEAD Nonce"
+	kdfSaltHeaderPayloadLengthAEADKey = "VMess Header AEAD Key_Length"
+	kdfSaltHeaderPayloadLengthAEADIV  = "VMess Header AEAD Nonce_Length"
+	kdfSaltAEADRespHeaderLenKey       = "AEAD Resp Header Len Key"
+	kdfSaltAEADRespHeaderLenIV        = "AEAD Resp Header Len IV"
+	kdfSaltAEADRespHeaderPayloadKey   = "AEAD Resp Header Key"
+	kdfSaltAEADRespHeaderPayloadIV    = "AEAD Resp Header IV"
+)
+
+// kdf derives key by nested HMAC-SHA256, where each element of
+// path wraps the HMAC of previous ones as its hash function.
+func kdf(key []byte, path ...string) []byte {
+	newHash := func() hash.Hash {
+		return hmac.New(sha256.New, []byte(kdfSaltVMessAEADKDF))
+	}
+	for _, p := range path {
+		parent, salt := newHash, []byte(p)
+		newHash = func() hash.Hash {
+			return hmac.New(parent, salt)
+		}
+	}
+
+	h := newHash()
+	h.Write(key)
+	return h.Sum(nil)
+}
+
+func kdf16(key []byte, path ...string) []byte {
+	return kdf(key, path...)[:16]
+}
+
+func newGCM(key []byte) cipher.AEAD {
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	return aead
+}
+
+// createAuthID creates the encrypted authentication ID, which consists
+// of timestamp, random bytes and CRC32 checksum of them.
+func createAuthID(cmdKey []byte, t time.Time) []byte {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf, uint64(t.Unix()))
+	rand.Read(buf[8:12])
+	binary.BigEndian.PutUint32(buf[12:], crc32.ChecksumIEEE(buf[:12]))
+
+	block, _ := aes.NewCipher(kdf16(cmdKey, kdfSaltAuthIDEncryptionKey))
+	block.Encrypt(buf, buf)
+	return buf
+}
+
+// sealHeader seals the request header with the cmdKey.
+//
+//	+---------+------------------+-------+------------------+
+//	| Auth ID | Encrypted Length | Nonce | Encrypted Header |
+//	+---------+------------------+-------+------------------+
+//	|   16    |      2 + 16      |   8   |  Variable + 16   |
+//	+---------+------------------+-------+------------------+
+func sealHeader(cmdKey, header []byte) []byte {
+	authID := createAuthID(cmdKey, time.Now())
+
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(len(header)))
+
+	lengthAEAD := newGCM(kdf16(cmdKey, kdfSaltHeaderPayloadLengthAEADKey, string(authID), string(nonce)))
+	lengthIV := kdf(cmdKey, kdfSaltHeaderPayloadLengthAEADIV, string(authID), string(nonce))[:12]
+
+	headerAEAD := newGCM(kdf16(cmdKey, kdfSaltHeaderPayloadAEADKey, string(authID), string(nonce)))
+	headerIV := kdf(cmdKey, kdfSaltHeaderPayloadAEADIV, string(authID), string(nonce))[:12]
+
+	return bytes.Join([][]byte{
+		authID,
+		lengthAEAD.Seal(nil, lengthIV, length, authID),
+		nonce,
+		headerAEAD.Seal(nil, headerIV, header, authID),
+	}, nil)
+}
+
+// openResponseHeader reads the response header from r, and opens it
+// with the response body key and IV.
+func openResponseHeader(r io.Reader, respKey, respIV []byte) ([]byte, error) {
+	lengthAEAD := newGCM(kdf16(respKey, kdfSaltAEADRespHeaderLenKey))
+	lengthIV := kdf(respIV, kdfSaltAEADRespHeaderLenIV)[:12]
+
+	buf := make([]byte, 2+lengthAEAD.Overhead())
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	length, err := lengthAEAD.Open(buf[:0], lengthIV, buf, nil)
+	if err != nil {
+		return nil, errors.New("invalid response header length")
+	}
+
+	headerAEAD := newGCM(kdf16(respKey, kdfSaltAEADRespHeaderPayloadKey))
+	headerIV := kdf(respIV, kdfSaltAEADRespHeaderPayloadIV)[:12]
+
+	buf = make([]byte, int(binary.BigEndian.Uint16(length))+headerAEAD.Overhead())
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	header, err := headerAEAD.Open(buf[:0], headerIV, buf, nil)
+	if err != nil {
+		return nil, errors.New("invalid response header")
+	}
+	return header, nil
+}
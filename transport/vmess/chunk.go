@@ -0,0 +1,110 @@
+package vmess
+
+import (
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/sha3"
+)
+
+// maxChunkSize is the max size of chunk, including the AEAD overhead.
+const maxChunkSize = 1 << 14
+
+// chunkCipher seals or opens chunks of one direction, the lengths of
+// chunks are masked by SHAKE128 of IV.
+type chunkCipher struct {
+	aead  cipher.AEAD /* nil if not encrypted */
+	iv    []byte
+	count uint16
+	mask  sha3.ShakeHash
+}
+
+func newChunkCipher(security Security, key, iv []byte) (*chunkCipher, error) {
+	c := &chunkCipher{iv: iv, mask: sha3.NewShake128()}
+	c.mask.Write(iv)
+
+	switch security {
+	case SecurityAES128GCM:
+		c.aead = newGCM(key)
+	case SecurityChacha20Poly1305:
+		aead, err := chacha20poly1305.New(chachaKey(key))
+		if err != nil {
+			return nil, err
+		}
+		c.aead = aead
+	case SecurityNone:
+	default:
+		return nil, errors.New("unsupported security")
+	}
+	return c, nil
+}
+
+// chachaKey expands the 16-byte key to 32 bytes with MD5.
+func chachaKey(key []byte) []byte {
+	sum := md5.Sum(key)
+	chacha := append([]byte(nil), sum[:]...)
+	sum = md5.Sum(chacha)
+	return append(chacha, sum[:]...)
+}
+
+func (c *chunkCipher) overhead() int {
+	if c.aead == nil {
+		return 0
+	}
+	return c.aead.Overhead()
+}
+
+func (c *chunkCipher) nextMask() uint16 {
+	var b [2]byte
+	c.mask.Read(b[:])
+	return binary.BigEndian.Uint16(b[:])
+}
+
+func (c *chunkCipher) nextNonce() []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	binary.BigEndian.PutUint16(nonce, c.count)
+	copy(nonce[2:], c.iv[2:12])
+	c.count++
+	return nonce
+}
+
+// seal returns the chunk of payload, which is no longer than the
+// max payload size.
+func (c *chunkCipher) seal(payload []byte) []byte {
+	size := len(payload) + c.overhead()
+	chunk := make([]byte, 2, 2+size)
+	binary.BigEndian.PutUint16(chunk, uint16(size)^c.nextMask())
+
+	if c.aead == nil {
+		return append(chunk, payload...)
+	}
+	return c.aead.Seal(chunk, c.nextNonce(), payload, nil)
+}
+
+// open reads a chunk from r and returns its payload, io.EOF is returned
+// on the empty chunk which terminates the stream.
+func (c *chunkCipher) open(r io.Reader, buf []byte) ([]byte, error) {
+	if _, err := io.ReadFull(r, buf[:2]); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint16(buf[:2]) ^ c.nextMask())
+	if size < c.overhead() || size > len(buf) {
+		return nil, errors.New("invalid chunk size")
+	}
+	if size == c.overhead() {
+		return nil, io.EOF
+	}
+
+	chunk := buf[:size]
+	if _, err := io.ReadFull(r, chunk); err != nil {
+		return nil, err
+	}
+	if c.aead == nil {
+		return chunk, nil
+	}
+	return c.aead.Open(chunk[:0], c.nextNonce(), chunk, nil)
+}
@@ -0,0 +1,234 @@
+// Package vmess provides VMess client functionalities, only the AEAD
+// header (alterId = 0) is supported.
+package vmess
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+	"github.com/xjasonlyu/tun2socks/v2/transport/vless"
+)
+
+// Version is the request version of VMess.
+const Version = 0x01
+
+// Security is the body encryption method of VMess.
+type Security = uint8
+
+const (
+	SecurityAES128GCM        Security = 0x03
+	SecurityChacha20Poly1305 Security = 0x04
+	SecurityNone             Security = 0x05
+)
+
+// ParseSecurity parses Security from its name, "auto" picks AES-GCM
+// on the architectures with hardware acceleration.
+func ParseSecurity(s string) (Security, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		switch runtime.GOARCH {
+		case "amd64", "arm64", "s390x":
+			return SecurityAES128GCM, nil
+		default:
+			return SecurityChacha20Poly1305, nil
+		}
+	case "aes-128-gcm":
+		return SecurityAES128GCM, nil
+	case "chacha20-poly1305":
+		return SecurityChacha20Poly1305, nil
+	case "none":
+		return SecurityNone, nil
+	default:
+		return 0, fmt.Errorf("unsupported security: %s", s)
+	}
+}
+
+// Command is the request command of VMess.
+type Command = uint8
+
+const (
+	CommandTCP Command = 0x01
+	CommandUDP Command = 0x02
+)
+
+// Request options of VMess.
+const (
+	optionChunkStream  = 0x01
+	optionChunkMasking = 0x04
+)
+
+// cmdKeySalt is appended to the user ID to derive cmdKey.
+const cmdKeySalt = "c48619fe-8f02-49e0-b9e9-edf763e17e21"
+
+// Client is a VMess client with the user ID.
+type Client struct {
+	cmdKey   []byte
+	security Security
+}
+
+func NewClient(id string, security Security) (*Client, error) {
+	u, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uuid: %w", err)
+	}
+	return &Client{
+		cmdKey:   cmdKey(u),
+		security: security,
+	}, nil
+}
+
+func cmdKey(u uuid.UUID) []byte {
+	sum := md5.Sum(append(u[:], cmdKeySalt...))
+	return sum[:]
+}
+
+// StreamConn writes the request header of command to addr through c,
+// and the response header is read on the first Read. For CommandUDP,
+// each Write and Read carries exactly one packet.
+func (cl *Client) StreamConn(c net.Conn, command Command, addr socks5.Addr) (net.Conn, error) {
+	atyp, host, port, err := vless.EncodeAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]byte, 16+16+1)
+	rand.Read(keys)
+	reqIV, reqKey, respV := keys[:16], keys[16:32], keys[32]
+
+	respKey := sha256.Sum256(reqKey)
+	respIV := sha256.Sum256(reqIV)
+
+	writer, err := newChunkCipher(cl.security, reqKey, reqIV)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := newChunkCipher(cl.security, respKey[:16], respIV[:16])
+	if err != nil {
+		return nil, err
+	}
+
+	padding := make([]byte, randIntn(16))
+	rand.Read(padding)
+
+	// +---------+----+-----+-------+--------+-----------------+---------+---------+
+	// | Version | IV | Key | RespV | Option | P<<4 | Security | Reserve | Command |
+	// +---------+----+-----+-------+--------+-----------------+---------+---------+
+	// |    1    | 16 | 16  |   1   |   1    |        1        |    1    |    1    |
+	// +---------+----+-----+-------+--------+-----------------+---------+---------+
+	// followed by Port, Atyp, Address, Padding and FNV1a of preceding fields.
+	header := bytes.Join([][]byte{
+		{Version}, reqIV, reqKey,
+		{respV, optionChunkStream | optionChunkMasking, byte(len(padding))<<4 | cl.security, 0, command},
+		port, {atyp}, host, padding,
+	}, nil)
+	h := fnv.New32a()
+	h.Write(header)
+	header = h.Sum(header)
+
+	if _, err = c.Write(sealHeader(cl.cmdKey, header)); err != nil {
+		return nil, err
+	}
+
+	return &Conn{
+		Conn:    c,
+		respKey: respKey[:16],
+		respIV:  respIV[:16],
+		respV:   respV,
+		writer:  writer,
+		reader:  reader,
+	}, nil
+}
+
+func randIntn(n int) int {
+	var b [1]byte
+	rand.Read(b[:])
+	return int(b[0]) % n
+}
+
+// Conn is a VMess connection.
+type Conn struct {
+	net.Conn
+
+	respKey []byte
+	respIV  []byte
+	respV   byte
+
+	writer *chunkCipher
+	wMu    sync.Mutex
+
+	reader *chunkCipher
+	once   sync.Once
+	err    error
+	buf    []byte
+	remain []byte
+}
+
+func (c *Conn) Write(b []byte) (n int, err error) {
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+
+	for len(b) > 0 {
+		payload := b
+		if max := maxChunkSize - c.writer.overhead(); len(payload) > max {
+			payload = payload[:max]
+		}
+		if _, err = c.Conn.Write(c.writer.seal(payload)); err != nil {
+			return
+		}
+		n += len(payload)
+		b = b[len(payload):]
+	}
+	return
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(func() { c.err = c.readResponse() })
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	if len(c.remain) == 0 {
+		payload, err := c.reader.open(c.Conn, c.buf)
+		if err != nil {
+			return 0, err
+		}
+		c.remain = payload
+	}
+
+	n := copy(b, c.remain)
+	c.remain = c.remain[n:]
+	return n, nil
+}
+
+func (c *Conn) readResponse() error {
+	header, err := openResponseHeader(c.Conn, c.respKey, c.respIV)
+	if err != nil {
+		return err
+	}
+	if len(header) < 4 || header[0] != c.respV {
+		return errors.New("unexpected response header")
+	}
+	c.buf = make([]byte, maxChunkSize)
+	return nil
+}
+
+// CloseWrite sends the empty chunk, which marks the end of request.
+func (c *Conn) CloseWrite() error {
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+
+	_, err := c.Conn.Write(c.writer.seal(nil))
+	return err
+}
@@ -0,0 +1,117 @@
+package vmess
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xjasonlyu/tun2socks/v2/transport/socks5"
+)
+
+// serveVMess is a minimal VMess server, which opens the AEAD request
+// header and echoes the chunks back.
+func serveVMess(t *testing.T, c net.Conn, id uuid.UUID) {
+	defer c.Close()
+
+	key := cmdKey(id)
+
+	buf := make([]byte, 16+2+16+8)
+	if _, err := io.ReadFull(c, buf); !assert.NoError(t, err) {
+		return
+	}
+	authID, lengthEnc, nonce := buf[:16], buf[16:34], buf[34:]
+
+	block, _ := aes.NewCipher(kdf16(key, kdfSaltAuthIDEncryptionKey))
+	plain := make([]byte, 16)
+	block.Decrypt(plain, authID)
+	assert.Equal(t, crc32.ChecksumIEEE(plain[:12]), binary.BigEndian.Uint32(plain[12:]))
+
+	length, err := newGCM(kdf16(key, kdfSaltHeaderPayloadLengthAEADKey, string(authID), string(nonce))).
+		Open(nil, kdf(key, kdfSaltHeaderPayloadLengthAEADIV, string(authID), string(nonce))[:12], lengthEnc, authID)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	headerEnc := make([]byte, int(binary.BigEndian.Uint16(length))+16)
+	if _, err = io.ReadFull(c, headerEnc); !assert.NoError(t, err) {
+		return
+	}
+	header, err := newGCM(kdf16(key, kdfSaltHeaderPayloadAEADKey, string(authID), string(nonce))).
+		Open(nil, kdf(key, kdfSaltHeaderPayloadAEADIV, string(authID), string(nonce))[:12], headerEnc, authID)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	h := fnv.New32a()
+	h.Write(header[:len(header)-4])
+	assert.Equal(t, h.Sum(nil), header[len(header)-4:])
+	assert.Equal(t, byte(Version), header[0])
+	assert.Equal(t, []byte{0, 80, 0x02, 11}, header[38:42])
+	assert.Equal(t, "example.com", string(header[42:53]))
+
+	reqIV, reqKey, respV, security := header[1:17], header[17:33], header[33], header[35]&0x0f
+	respKey := sha256.Sum256(reqKey)
+	respIV := sha256.Sum256(reqIV)
+
+	respHeader := []byte{respV, 0, 0, 0}
+	respLength := []byte{0, byte(len(respHeader))}
+	c.Write(bytes.Join([][]byte{
+		newGCM(kdf16(respKey[:16], kdfSaltAEADRespHeaderLenKey)).
+			Seal(nil, kdf(respIV[:16], kdfSaltAEADRespHeaderLenIV)[:12], respLength, nil),
+		newGCM(kdf16(respKey[:16], kdfSaltAEADRespHeaderPayloadKey)).
+			Seal(nil, kdf(respIV[:16], kdfSaltAEADRespHeaderPayloadIV)[:12], respHeader, nil),
+	}, nil))
+
+	reader, _ := newChunkCipher(security, reqKey, reqIV)
+	writer, _ := newChunkCipher(security, respKey[:16], respIV[:16])
+
+	buf = make([]byte, maxChunkSize)
+	for {
+		payload, err := reader.open(c, buf)
+		if err != nil {
+			return
+		}
+		if _, err = c.Write(writer.seal(payload)); err != nil {
+			return
+		}
+	}
+}
+
+func TestVMess(t *testing.T) {
+	id := uuid.New()
+	addr := socks5.SerializeAddr("example.com", nil, 80)
+
+	for _, security := range []string{"aes-128-gcm", "chacha20-poly1305", "none"} {
+		t.Run(security, func(t *testing.T) {
+			s, err := ParseSecurity(security)
+			require.NoError(t, err)
+			client, err := NewClient(id.String(), s)
+			require.NoError(t, err)
+
+			c, server := net.Pipe()
+			defer c.Close()
+			go serveVMess(t, server, id)
+
+			vc, err := client.StreamConn(c, CommandTCP, addr)
+			require.NoError(t, err)
+
+			data := bytes.Repeat([]byte("vmess"), maxChunkSize/2)
+			go vc.Write(data)
+
+			buf := make([]byte, len(data))
+			_, err = io.ReadFull(vc, buf)
+			require.NoError(t, err)
+			assert.Equal(t, data, buf)
+		})
+	}
+}
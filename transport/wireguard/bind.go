@@ -0,0 +1,152 @@
+package wireguard
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/conn"
+
+	"github.com/xjasonlyu/tun2socks/v2/dialer"
+)
+
+var _ conn.Bind = (*bind)(nil)
+
+// bind is a conn.Bind over the socket of dialer, so that the packets
+// of WireGuard are sent through the default interface, rather than
+// looped back to tun2socks. The reserved bytes of message header are
+// set on sending and cleared on receiving.
+type bind struct {
+	reserved [3]byte
+	listen   func(network, address string) (net.PacketConn, error)
+
+	mu sync.Mutex
+	pc net.PacketConn
+}
+
+func newBind(reserved [3]byte, listen func(string, string) (net.PacketConn, error)) *bind {
+	if listen == nil {
+		listen = dialer.ListenPacket
+	}
+	return &bind{reserved: reserved, listen: listen}
+}
+
+func (b *bind) Open(port uint16) ([]conn.ReceiveFunc, uint16, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pc != nil {
+		return nil, 0, conn.ErrBindAlreadyOpen
+	}
+
+	pc, err := b.listen("udp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, 0, err
+	}
+	b.pc = pc
+
+	var localPort uint16
+	if udpAddr, ok := pc.LocalAddr().(*net.UDPAddr); ok {
+		localPort = uint16(udpAddr.Port)
+	}
+	return []conn.ReceiveFunc{b.receive(pc)}, localPort, nil
+}
+
+func (b *bind) receive(pc net.PacketConn) conn.ReceiveFunc {
+	return func(packets [][]byte, sizes []int, eps []conn.Endpoint) (int, error) {
+		n, addr, err := pc.ReadFrom(packets[0])
+		if err != nil {
+			return 0, err
+		}
+		if n > 3 {
+			copy(packets[0][1:4], []byte{0, 0, 0})
+		}
+
+		addrPort, err := netip.ParseAddrPort(addr.String())
+		if err != nil {
+			return 0, err
+		}
+
+		sizes[0] = n
+		eps[0] = endpoint(addrPort)
+		return 1, nil
+	}
+}
+
+func (b *bind) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pc == nil {
+		return nil
+	}
+	err := b.pc.Close()
+	b.pc = nil
+	return err
+}
+
+func (b *bind) SetMark(uint32) error {
+	return nil
+}
+
+func (b *bind) Send(bufs [][]byte, ep conn.Endpoint) error {
+	b.mu.Lock()
+	pc := b.pc
+	b.mu.Unlock()
+
+	if pc == nil {
+		return net.ErrClosed
+	}
+
+	addr := net.UDPAddrFromAddrPort(netip.AddrPort(ep.(endpoint)))
+	for _, buf := range bufs {
+		if len(buf) > 3 {
+			copy(buf[1:4], b.reserved[:])
+		}
+		if _, err := pc.WriteTo(buf, addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *bind) ParseEndpoint(s string) (conn.Endpoint, error) {
+	addrPort, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return nil, err
+	}
+	return endpoint(addrPort), nil
+}
+
+func (b *bind) BatchSize() int {
+	return 1
+}
+
+var _ conn.Endpoint = (*endpoint)(nil)
+
+// endpoint is the address of peer.
+type endpoint netip.AddrPort
+
+func (e endpoint) ClearSrc() {}
+
+func (e endpoint) SrcToString() string {
+	return ""
+}
+
+func (e endpoint) DstToString() string {
+	return netip.AddrPort(e).String()
+}
+
+func (e endpoint) DstToBytes() []byte {
+	b, _ := netip.AddrPort(e).MarshalBinary()
+	return b
+}
+
+func (e endpoint) DstIP() netip.Addr {
+	return netip.AddrPort(e).Addr()
+}
+
+func (e endpoint) SrcIP() netip.Addr {
+	return netip.Addr{}
+}
@@ -0,0 +1,110 @@
+package wireguard
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/tun"
+	"gvisor.dev/gvisor/pkg/buffer"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+)
+
+var _ tun.Device = (*netTun)(nil)
+
+// netTun is a tun.Device which passes packets between WireGuard and
+// the link endpoint of a gVisor stack.
+type netTun struct {
+	ep     *channel.Endpoint
+	mtu    int
+	events chan tun.Event
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+func newNetTun(ep *channel.Endpoint, mtu int) *netTun {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &netTun{
+		ep:     ep,
+		mtu:    mtu,
+		events: make(chan tun.Event, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	t.events <- tun.EventUp
+	return t
+}
+
+func (t *netTun) File() *os.File {
+	return nil
+}
+
+// Read reads an outbound packet of stack.
+func (t *netTun) Read(bufs [][]byte, sizes []int, offset int) (int, error) {
+	pkt := t.ep.ReadContext(t.ctx)
+	if pkt.IsNil() {
+		return 0, os.ErrClosed
+	}
+	defer pkt.DecRef()
+
+	view := pkt.ToView()
+	defer view.Release()
+
+	n, err := view.Read(bufs[0][offset:])
+	if err != nil {
+		return 0, err
+	}
+	sizes[0] = n
+	return 1, nil
+}
+
+// Write injects inbound packets to stack.
+func (t *netTun) Write(bufs [][]byte, offset int) (int, error) {
+	for _, buf := range bufs {
+		packet := buf[offset:]
+		if len(packet) == 0 {
+			continue
+		}
+
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Payload: buffer.MakeWithData(packet),
+		})
+		switch header.IPVersion(packet) {
+		case header.IPv4Version:
+			t.ep.InjectInbound(header.IPv4ProtocolNumber, pkt)
+		case header.IPv6Version:
+			t.ep.InjectInbound(header.IPv6ProtocolNumber, pkt)
+		}
+		pkt.DecRef()
+	}
+	return len(bufs), nil
+}
+
+func (t *netTun) MTU() (int, error) {
+	return t.mtu, nil
+}
+
+func (t *netTun) Name() (string, error) {
+	return "wireguard", nil
+}
+
+func (t *netTun) Events() <-chan tun.Event {
+	return t.events
+}
+
+func (t *netTun) Close() error {
+	t.closeOnce.Do(func() {
+		t.cancel()
+		t.ep.Close()
+		close(t.events)
+	})
+	return nil
+}
+
+func (t *netTun) BatchSize() int {
+	return 1
+}
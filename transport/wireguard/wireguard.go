@@ -0,0 +1,306 @@
+// Package wireguard provides a userspace WireGuard peer, whose traffic
+// is terminated by a gVisor stack.
+package wireguard
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"go.uber.org/atomic"
+	"golang.zx2c4.com/wireguard/device"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/header"
+	"gvisor.dev/gvisor/pkg/tcpip/link/channel"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv6"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/tcp"
+	"gvisor.dev/gvisor/pkg/tcpip/transport/udp"
+
+	"github.com/xjasonlyu/tun2socks/v2/dialer"
+	"github.com/xjasonlyu/tun2socks/v2/log"
+)
+
+const (
+	defaultMTU = 1420
+	nicID      = 1
+)
+
+// Config is the configuration of WireGuard peer.
+type Config struct {
+	// PrivateKey, PublicKey and PresharedKey are base64 encoded,
+	// where PublicKey is of the remote peer.
+	PrivateKey   string
+	PublicKey    string
+	PresharedKey string
+
+	// Endpoint is the address of remote peer, it's empty if the
+	// remote peer is expected to connect first.
+	Endpoint string
+
+	// ListenPort is the UDP port to listen, zero for random.
+	ListenPort uint16
+
+	// Addresses are the addresses of local interface.
+	Addresses []netip.Prefix
+
+	// AllowedIPs are the addresses routed to remote peer, it
+	// defaults to all addresses.
+	AllowedIPs []netip.Prefix
+
+	// Reserved is the reserved bytes of message header.
+	Reserved [3]byte
+
+	// DNS are the DNS servers in the tunnel to resolve destination
+	// hosts with. If it's empty, the hosts are resolved by the system
+	// resolver outside the tunnel, which sends the queries to the
+	// local network.
+	DNS []netip.Addr
+
+	// ListenPacket listens the socket to remote peer, which defaults
+	// to dialer.ListenPacket.
+	ListenPacket func(network, address string) (net.PacketConn, error)
+
+	MTU int
+}
+
+// Device is a WireGuard peer with its gVisor stack.
+type Device struct {
+	dev   *device.Device
+	tun   *netTun
+	stack *stack.Stack
+
+	hasV4, hasV6 bool
+
+	// resolver resolves through the tunnel, it's nil if no DNS.
+	resolver *net.Resolver
+}
+
+// NewDevice creates Device and brings it up.
+func NewDevice(cfg *Config) (*Device, error) {
+	if len(cfg.Addresses) == 0 {
+		return nil, errors.New("empty address")
+	}
+
+	uapi, err := uapiConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	mtu := cfg.MTU
+	if mtu <= 0 {
+		mtu = defaultMTU
+	}
+
+	d := &Device{
+		stack: stack.New(stack.Options{
+			NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol, ipv6.NewProtocol},
+			TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol, udp.NewProtocol},
+			HandleLocal:        true,
+		}),
+	}
+
+	sackEnabledOpt := tcpip.TCPSACKEnabled(true)
+	d.stack.SetTransportProtocolOption(tcp.ProtocolNumber, &sackEnabledOpt)
+
+	ep := channel.New(1024, uint32(mtu), "")
+	if err := d.stack.CreateNIC(nicID, ep); err != nil {
+		return nil, fmt.Errorf("create nic: %s", err)
+	}
+
+	for _, prefix := range cfg.Addresses {
+		protoAddr := tcpip.ProtocolAddress{
+			AddressWithPrefix: tcpip.AddressWithPrefix{
+				Address:   tcpip.AddrFromSlice(prefix.Addr().AsSlice()),
+				PrefixLen: prefix.Bits(),
+			},
+		}
+		if prefix.Addr().Is4() {
+			protoAddr.Protocol = ipv4.ProtocolNumber
+			d.hasV4 = true
+		} else {
+			protoAddr.Protocol = ipv6.ProtocolNumber
+			d.hasV6 = true
+		}
+		if err := d.stack.AddProtocolAddress(nicID, protoAddr, stack.AddressProperties{}); err != nil {
+			return nil, fmt.Errorf("add address %s: %s", prefix, err)
+		}
+	}
+	d.stack.SetRouteTable([]tcpip.Route{
+		{Destination: header.IPv4EmptySubnet, NIC: nicID},
+		{Destination: header.IPv6EmptySubnet, NIC: nicID},
+	})
+
+	if len(cfg.DNS) > 0 {
+		d.resolver = d.newResolver(cfg.DNS)
+	}
+
+	d.tun = newNetTun(ep, mtu)
+	d.dev = device.NewDevice(d.tun, newBind(cfg.Reserved, cfg.ListenPacket), &device.Logger{
+		Verbosef: func(format string, args ...any) {
+			log.Debugf("[WIREGUARD] "+format, args...)
+		},
+		Errorf: func(format string, args ...any) {
+			log.Warnf("[WIREGUARD] "+format, args...)
+		},
+	})
+
+	if err = d.dev.IpcSet(uapi); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("configure device: %w", err)
+	}
+	if err = d.dev.Up(); err != nil {
+		d.Close()
+		return nil, fmt.Errorf("bring up device: %w", err)
+	}
+	return d, nil
+}
+
+// uapiConfig converts cfg to the configuration protocol of WireGuard.
+func uapiConfig(cfg *Config) (string, error) {
+	b := &strings.Builder{}
+
+	privateKey, err := hexKey(cfg.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("private key: %w", err)
+	}
+	fmt.Fprintf(b, "private_key=%s\n", privateKey)
+	if cfg.ListenPort != 0 {
+		fmt.Fprintf(b, "listen_port=%d\n", cfg.ListenPort)
+	}
+
+	publicKey, err := hexKey(cfg.PublicKey)
+	if err != nil {
+		return "", fmt.Errorf("public key: %w", err)
+	}
+	fmt.Fprintf(b, "public_key=%s\n", publicKey)
+
+	if cfg.PresharedKey != "" {
+		presharedKey, err := hexKey(cfg.PresharedKey)
+		if err != nil {
+			return "", fmt.Errorf("preshared key: %w", err)
+		}
+		fmt.Fprintf(b, "preshared_key=%s\n", presharedKey)
+	}
+
+	if cfg.Endpoint != "" {
+		addr, err := dialer.ResolveUDPAddr(context.Background(), "udp", cfg.Endpoint)
+		if err != nil {
+			return "", fmt.Errorf("resolve endpoint: %w", err)
+		}
+		fmt.Fprintf(b, "endpoint=%s\n", addr.AddrPort())
+	}
+
+	allowedIPs := cfg.AllowedIPs
+	if len(allowedIPs) == 0 {
+		allowedIPs = []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}
+	}
+	for _, prefix := range allowedIPs {
+		fmt.Fprintf(b, "allowed_ip=%s\n", prefix)
+	}
+	return b.String(), nil
+}
+
+// hexKey converts the base64 encoded key to hex.
+func hexKey(s string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	if len(key) != 32 {
+		return "", fmt.Errorf("bad key length: %d", len(key))
+	}
+	return hex.EncodeToString(key), nil
+}
+
+func (d *Device) fullAddress(addrPort netip.AddrPort) (tcpip.FullAddress, tcpip.NetworkProtocolNumber, error) {
+	addr := addrPort.Addr().Unmap()
+	full := tcpip.FullAddress{
+		NIC:  nicID,
+		Addr: tcpip.AddrFromSlice(addr.AsSlice()),
+		Port: addrPort.Port(),
+	}
+	switch {
+	case addr.Is4() && d.hasV4:
+		return full, ipv4.ProtocolNumber, nil
+	case addr.Is6() && d.hasV6:
+		return full, ipv6.ProtocolNumber, nil
+	default:
+		return full, 0, fmt.Errorf("no local address for %s", addr)
+	}
+}
+
+// DialContextTCP connects to addr through the tunnel.
+func (d *Device) DialContextTCP(ctx context.Context, addr netip.AddrPort) (net.Conn, error) {
+	full, proto, err := d.fullAddress(addr)
+	if err != nil {
+		return nil, err
+	}
+	return gonet.DialContextTCP(ctx, d.stack, full, proto)
+}
+
+// ListenUDP creates an unconnected UDP socket in the tunnel, which
+// sends packets to the address family of addr.
+func (d *Device) ListenUDP(addr netip.Addr) (net.PacketConn, error) {
+	_, proto, err := d.fullAddress(netip.AddrPortFrom(addr, 0))
+	if err != nil {
+		return nil, err
+	}
+	return gonet.DialUDP(d.stack, nil, nil, proto)
+}
+
+// Close closes the device and its stack.
+func (d *Device) Close() {
+	if d.dev != nil {
+		d.dev.Close()
+	}
+	d.stack.Close()
+}
+
+// newResolver returns the resolver querying servers through the tunnel,
+// the servers are rotated on each dial, so that the retries of resolver
+// go to the next one.
+func (d *Device) newResolver(servers []netip.Addr) *net.Resolver {
+	next := atomic.NewUint32(0)
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			server := netip.AddrPortFrom(servers[int(next.Inc()-1)%len(servers)], 53)
+			if strings.HasPrefix(network, "tcp") {
+				return d.DialContextTCP(ctx, server)
+			}
+			full, proto, err := d.fullAddress(server)
+			if err != nil {
+				return nil, err
+			}
+			return gonet.DialUDP(d.stack, nil, &full, proto)
+		},
+	}
+}
+
+// LookupHost resolves host to an address of the families of local
+// addresses, by the DNS servers in the tunnel if any, otherwise by the
+// system resolver.
+func (d *Device) LookupHost(ctx context.Context, host string) (netip.Addr, error) {
+	resolver := d.resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	for _, addr := range addrs {
+		if addr = addr.Unmap(); (addr.Is4() && d.hasV4) || (addr.Is6() && d.hasV6) {
+			return addr, nil
+		}
+	}
+	return netip.Addr{}, fmt.Errorf("no suitable address for %s", host)
+}
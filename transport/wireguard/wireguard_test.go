@@ -0,0 +1,137 @@
+package wireguard
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/net/dns/dnsmessage"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/adapters/gonet"
+	"gvisor.dev/gvisor/pkg/tcpip/network/ipv4"
+)
+
+func newKeyPair(t *testing.T) (privateKey, publicKey string) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	key[0] &= 248
+	key[31] = (key[31] & 127) | 64
+
+	pub, err := curve25519.X25519(key, curve25519.Basepoint)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(key), base64.StdEncoding.EncodeToString(pub)
+}
+
+func TestDevice(t *testing.T) {
+	serverPrivate, serverPublic := newKeyPair(t)
+	clientPrivate, clientPublic := newKeyPair(t)
+
+	// Find a free port for the server peer.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	pc.Close()
+
+	server, err := NewDevice(&Config{
+		PrivateKey: serverPrivate,
+		PublicKey:  clientPublic,
+		ListenPort: uint16(port),
+		Addresses:  []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")},
+		AllowedIPs: []netip.Prefix{netip.MustParsePrefix("10.0.0.2/32")},
+		Reserved:   [3]byte{1, 2, 3},
+	})
+	require.NoError(t, err)
+	defer server.Close()
+
+	client, err := NewDevice(&Config{
+		PrivateKey: clientPrivate,
+		PublicKey:  serverPublic,
+		Endpoint:   netip.AddrPortFrom(netip.MustParseAddr("127.0.0.1"), uint16(port)).String(),
+		Addresses:  []netip.Prefix{netip.MustParsePrefix("10.0.0.2/32")},
+		Reserved:   [3]byte{1, 2, 3},
+		DNS:        []netip.Addr{netip.MustParseAddr("10.0.0.1")},
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	ln, err := gonet.ListenTCP(server.stack, tcpip.FullAddress{
+		NIC:  nicID,
+		Addr: tcpip.AddrFrom4([4]byte{10, 0, 0, 1}),
+		Port: 80,
+	}, ipv4.ProtocolNumber)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(c, c)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c, err := client.DialContextTCP(ctx, netip.MustParseAddrPort("10.0.0.1:80"))
+	require.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Write([]byte("hello"))
+	require.NoError(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(c, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	// The hosts are resolved by the DNS server in the tunnel.
+	dns, err := gonet.DialUDP(server.stack, &tcpip.FullAddress{
+		NIC:  nicID,
+		Addr: tcpip.AddrFrom4([4]byte{10, 0, 0, 1}),
+		Port: 53,
+	}, nil, ipv4.ProtocolNumber)
+	require.NoError(t, err)
+	defer dns.Close()
+	go serveDNS(dns, netip.MustParseAddr("10.0.0.100"))
+
+	addr, err := client.LookupHost(ctx, "example.test")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.100", addr.String())
+}
+
+// serveDNS answers the A queries with addr, and others with nothing.
+func serveDNS(pc net.PacketConn, addr netip.Addr) {
+	buf := make([]byte, 512)
+	for {
+		n, remote, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var msg dnsmessage.Message
+		if err = msg.Unpack(buf[:n]); err != nil || len(msg.Questions) == 0 {
+			continue
+		}
+		msg.Header.Response = true
+		if q := msg.Questions[0]; q.Type == dnsmessage.TypeA {
+			msg.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: q.Class, TTL: 60},
+				Body:   &dnsmessage.AResource{A: addr.As4()},
+			}}
+		}
+		b, err := msg.Pack()
+		if err != nil {
+			continue
+		}
+		pc.WriteTo(b, remote)
+	}
+}
@@ -0,0 +1,209 @@
+// Package ws provides WebSocket stream transport.
+package ws
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Config is the WebSocket handshake options.
+type Config struct {
+	// Host is the Host header, the server address is used if empty.
+	Host string
+
+	// Path is the request path, defaults to "/".
+	Path string
+
+	// Headers are the extra headers of handshake request.
+	Headers http.Header
+
+	// MaxEarlyData is the max length of the first data, which is sent
+	// in the handshake request header EarlyDataHeader, so as to save a
+	// round trip. Early data is disabled if it's zero.
+	MaxEarlyData int
+
+	// EarlyDataHeader defaults to "Sec-WebSocket-Protocol".
+	EarlyDataHeader string
+}
+
+const defaultEarlyDataHeader = "Sec-WebSocket-Protocol"
+
+const handshakeTimeout = 5 * time.Second
+
+// Conn is a net.Conn over WebSocket binary messages.
+type Conn struct {
+	*websocket.Conn
+
+	reader io.Reader
+	wMu    sync.Mutex
+}
+
+// StreamConn performs the WebSocket handshake over c, which is already
+// connected (and encrypted if needed) to the server at addr. If early
+// data is enabled, the handshake is deferred to the first Write.
+func StreamConn(ctx context.Context, c net.Conn, addr string, cfg *Config) (net.Conn, error) {
+	if cfg.MaxEarlyData > 0 {
+		return &earlyConn{Conn: c, addr: addr, cfg: cfg, ready: make(chan struct{})}, nil
+	}
+	return handshake(ctx, c, addr, cfg, nil)
+}
+
+// handshake performs the WebSocket handshake with early data.
+func handshake(ctx context.Context, c net.Conn, addr string, cfg *Config, earlyData []byte) (*Conn, error) {
+	host := cfg.Host
+	if host == "" {
+		host = addr
+	}
+	path := cfg.Path
+	if path == "" {
+		path = "/"
+	}
+
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme, u.Host = "ws", host
+
+	d := &websocket.Dialer{
+		NetDialContext: func(context.Context, string, string) (net.Conn, error) {
+			return c, nil
+		},
+		ReadBufferSize:  4 * 1024,
+		WriteBufferSize: 4 * 1024,
+	}
+
+	header := cfg.Headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if len(earlyData) > 0 {
+		name := cfg.EarlyDataHeader
+		if name == "" {
+			name = defaultEarlyDataHeader
+		}
+		header.Set(name, base64.RawURLEncoding.EncodeToString(earlyData))
+	}
+
+	wsConn, resp, err := d.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil {
+			err = fmt.Errorf("%w: %s", err, resp.Status)
+		}
+		return nil, err
+	}
+	return &Conn{Conn: wsConn}, nil
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, reader, err := c.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			c.reader = reader
+		}
+
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+
+	if err := c.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *Conn) Close() error {
+	c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(time.Second))
+	return c.Conn.Close()
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// earlyConn performs the handshake on the first Write with early data,
+// and Read waits for the handshake.
+type earlyConn struct {
+	net.Conn
+
+	addr string
+	cfg  *Config
+
+	once  sync.Once
+	ready chan struct{}
+	conn  *Conn
+	err   error
+}
+
+func (c *earlyConn) Write(b []byte) (int, error) {
+	n := 0
+	c.once.Do(func() {
+		n = len(b)
+		if n > c.cfg.MaxEarlyData {
+			n = c.cfg.MaxEarlyData
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+		defer cancel()
+
+		c.conn, c.err = handshake(ctx, c.Conn, c.addr, c.cfg, b[:n])
+		close(c.ready)
+	})
+	<-c.ready
+	if c.err != nil {
+		return 0, c.err
+	}
+	if n == len(b) {
+		return n, nil
+	}
+
+	m, err := c.conn.Write(b[n:])
+	return n + m, err
+}
+
+func (c *earlyConn) Read(b []byte) (int, error) {
+	<-c.ready
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.conn.Read(b)
+}
+
+func (c *earlyConn) Close() error {
+	c.once.Do(func() {
+		c.err = net.ErrClosed
+		close(c.ready)
+	})
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return c.Conn.Close()
+}
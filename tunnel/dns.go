@@ -0,0 +1,59 @@
+package tunnel
+
+import (
+	"go.uber.org/atomic"
+
+	"github.com/xjasonlyu/tun2socks/v2/core/adapter"
+	"github.com/xjasonlyu/tun2socks/v2/dns"
+	"github.com/xjasonlyu/tun2socks/v2/log"
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+)
+
+// dnsPort is the port of DNS queries to be hijacked.
+const dnsPort = 53
+
+// _fakeDNS holds the fake DNS server, nil if fake-ip is disabled.
+var _fakeDNS atomic.Pointer[dns.FakeServer]
+
+// SetFakeDNS enables fake-ip mode with the given DNS server, all
+// DNS queries would be hijacked and answered with fake IPs.
+func SetFakeDNS(s *dns.FakeServer) {
+	_fakeDNS.Store(s)
+}
+
+// shouldHijackDNS reports whether the connection is a DNS query
+// that should be answered by the fake DNS server.
+func shouldHijackDNS(metadata *M.Metadata) bool {
+	return _fakeDNS.Load() != nil && metadata.DstPort == dnsPort
+}
+
+func hijackTCPDNS(conn adapter.TCPConn, metadata *M.Metadata) {
+	log.Debugf("[DNS] hijack tcp query %s -> %s", metadata.SourceAddress(), metadata.DestinationAddress())
+	if err := _fakeDNS.Load().ServeConn(conn, tcpWaitTimeout); err != nil {
+		log.Debugf("[DNS] serve tcp query from %s: %v", metadata.SourceAddress(), err)
+	}
+}
+
+func hijackUDPDNS(conn adapter.UDPConn, metadata *M.Metadata) {
+	log.Debugf("[DNS] hijack udp query %s -> %s", metadata.SourceAddress(), metadata.DestinationAddress())
+	if err := _fakeDNS.Load().ServePacket(conn, _udpSessionTimeout); err != nil {
+		log.Debugf("[DNS] serve udp query from %s: %v", metadata.SourceAddress(), err)
+	}
+}
+
+// resolveFakeIP fills the host of metadata if the destination is
+// a fake IP. It returns false if the fake IP is unknown, e.g. the
+// record has been recycled.
+func resolveFakeIP(metadata *M.Metadata) bool {
+	fakeDNS := _fakeDNS.Load()
+	if fakeDNS == nil || !fakeDNS.Contains(metadata.DstIP) {
+		return true
+	}
+
+	host, ok := fakeDNS.LookBack(metadata.DstIP)
+	if !ok {
+		return false
+	}
+	metadata.Host = host
+	return true
+}
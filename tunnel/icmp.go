@@ -0,0 +1,198 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/xjasonlyu/tun2socks/v2/common/pool"
+	"github.com/xjasonlyu/tun2socks/v2/core/adapter"
+	"github.com/xjasonlyu/tun2socks/v2/dialer"
+	"github.com/xjasonlyu/tun2socks/v2/log"
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy"
+	"github.com/xjasonlyu/tun2socks/v2/proxy/proto"
+)
+
+// icmpEchoTimeout is the timeout of waiting for echo reply.
+const icmpEchoTimeout = 5 * time.Second
+
+// ICMPMode is the behavior of echo requests to proxy outbounds,
+// which are not able to relay ICMP.
+type ICMPMode uint8
+
+const (
+	// ICMPFakeReply replies echo requests locally.
+	ICMPFakeReply ICMPMode = iota
+
+	// ICMPDrop drops echo requests.
+	ICMPDrop
+
+	// ICMPTCPPing replies echo requests after a TCP connect to
+	// the proxy, so that the latency of proxy is measured.
+	ICMPTCPPing
+)
+
+func (m ICMPMode) String() string {
+	switch m {
+	case ICMPFakeReply:
+		return "fake"
+	case ICMPDrop:
+		return "drop"
+	case ICMPTCPPing:
+		return "tcp-ping"
+	default:
+		return fmt.Sprintf("icmp(%d)", m)
+	}
+}
+
+// ParseICMPMode parses ICMPMode from its name.
+func ParseICMPMode(s string) (ICMPMode, error) {
+	for _, m := range []ICMPMode{ICMPFakeReply, ICMPDrop, ICMPTCPPing} {
+		if strings.EqualFold(s, m.String()) {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported icmp mode: %s", s)
+}
+
+// _icmpMode is the ICMPMode used by proxy outbounds.
+var _icmpMode = ICMPFakeReply
+
+func SetICMPMode(m ICMPMode) {
+	_icmpMode = m
+}
+
+func handleICMPEcho(echo adapter.ICMPEcho) {
+	id := echo.ID()
+	metadata := &M.Metadata{
+		Network: M.ICMP,
+		SrcIP:   net.IP(id.RemoteAddress.AsSlice()),
+		SrcPort: id.RemotePort,
+		DstIP:   net.IP(id.LocalAddress.AsSlice()),
+	}
+
+	if !resolveFakeIP(metadata) {
+		log.Warnf("[ICMP] fake-ip %s not found", metadata.DstIP)
+		return
+	}
+
+	d, _, _ := match(metadata)
+	if _, ok := d.(defaultDialer); ok {
+		d = proxy.DefaultDialer()
+	}
+
+	var err error
+	switch p, ok := d.(proxy.Proxy); {
+	case !ok:
+		err = icmpReply(echo, _icmpMode, "")
+	case p.Proto() == proto.Direct:
+		err = icmpForward(echo, metadata)
+	case p.Proto() == proto.Reject:
+		return
+	default:
+		err = icmpReply(echo, _icmpMode, p.Addr())
+	}
+
+	if err != nil {
+		log.Debugf("[ICMP] echo %s -> %s: %v", metadata.SrcIP, metadata.DestinationAddress(), err)
+	}
+}
+
+// icmpReply replies echo request on behalf of proxy at addr.
+func icmpReply(echo adapter.ICMPEcho, mode ICMPMode, addr string) error {
+	switch mode {
+	case ICMPDrop:
+		return nil
+	case ICMPTCPPing:
+		if addr == "" {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), icmpEchoTimeout)
+		defer cancel()
+
+		c, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		c.Close()
+	}
+	return echo.Reply(echo.Payload())
+}
+
+// icmpForward forwards echo request to its destination directly,
+// and replies with the data of the echo reply received.
+func icmpForward(echo adapter.ICMPEcho, metadata *M.Metadata) error {
+	var (
+		network  = "ip4"
+		protocol = 1 /* ICMP */
+		typ      icmp.Type
+	)
+	if metadata.DstIP.To4() != nil {
+		typ = ipv4.ICMPTypeEcho
+	} else {
+		network, protocol, typ = "ip6", 58 /* ICMPv6 */, ipv6.ICMPTypeEchoRequest
+	}
+
+	dst := metadata.DstIP
+	if metadata.Host != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), icmpEchoTimeout)
+		ip, err := dialer.LookupIP(ctx, network, metadata.Host)
+		cancel()
+		if err != nil {
+			return err
+		}
+		dst = ip.AsSlice()
+	}
+
+	pc, err := dialer.ListenICMP(network)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	b, err := (&icmp.Message{
+		Type: typ,
+		Body: &icmp.Echo{
+			ID:   int(metadata.SrcPort),
+			Seq:  int(echo.Seq()),
+			Data: echo.Payload(),
+		},
+	}).Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	// The identifier is rewritten by kernel to the port of socket,
+	// and replies to other sockets are never received.
+	if _, err = pc.WriteTo(b, &net.UDPAddr{IP: dst}); err != nil {
+		return err
+	}
+
+	buf := pool.Get(pool.MaxSegmentSize)
+	defer pool.Put(buf)
+
+	pc.SetReadDeadline(time.Now().Add(icmpEchoTimeout))
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+
+		msg, err := icmp.ParseMessage(protocol, buf[:n])
+		if err != nil {
+			continue
+		}
+		if reply, ok := msg.Body.(*icmp.Echo); ok && reply.Seq == int(echo.Seq()) &&
+			(msg.Type == ipv4.ICMPTypeEchoReply || msg.Type == ipv6.ICMPTypeEchoReply) {
+			return echo.Reply(reply.Data)
+		}
+	}
+}
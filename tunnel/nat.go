@@ -0,0 +1,199 @@
+package tunnel
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xjasonlyu/tun2socks/v2/common/pool"
+	"github.com/xjasonlyu/tun2socks/v2/core/adapter"
+	"github.com/xjasonlyu/tun2socks/v2/log"
+)
+
+// NATType is the behavior of mapping UDP sessions to remote.
+type NATType uint8
+
+const (
+	// SymmetricNAT dials remote for each source and destination
+	// pair, and only accepts packets from the destination.
+	SymmetricNAT NATType = iota
+
+	// PortRestrictedNAT shares one remote mapping per source, and
+	// accepts packets from destinations the source has sent to.
+	PortRestrictedNAT
+
+	// FullConeNAT shares one remote mapping per source, and
+	// accepts packets from any address.
+	FullConeNAT
+)
+
+func (t NATType) String() string {
+	switch t {
+	case SymmetricNAT:
+		return "symmetric"
+	case PortRestrictedNAT:
+		return "port-restricted"
+	case FullConeNAT:
+		return "full-cone"
+	default:
+		return fmt.Sprintf("nat(%d)", t)
+	}
+}
+
+// ParseNATType parses NATType from its name.
+func ParseNATType(s string) (NATType, error) {
+	for _, t := range []NATType{SymmetricNAT, PortRestrictedNAT, FullConeNAT} {
+		if strings.EqualFold(s, t.String()) {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported nat type: %s", s)
+}
+
+// _natType is the NATType used by UDP sessions.
+var _natType = SymmetricNAT
+
+func SetNATType(t NATType) {
+	_natType = t
+}
+
+// _natTable holds the UDP sessions shared by cone NAT.
+var _natTable = &natTable{sessions: make(map[string]*natSession)}
+
+type natTable struct {
+	mu       sync.Mutex
+	sessions map[string]*natSession
+}
+
+// natSession is a remote mapping shared by all conns from the same
+// source, each conn is a peer keyed by its destination address.
+type natSession struct {
+	// ready is closed once pc is dialed or err is set.
+	ready chan struct{}
+	pc    net.PacketConn
+	err   error
+
+	mu    sync.RWMutex
+	peers map[string]adapter.UDPConn
+	refs  int
+}
+
+// join adds uc as the peer of session key, and reports whether the
+// session is newly created, in which case the caller must dial.
+func (t *natTable) join(key, peer string, uc adapter.UDPConn) (*natSession, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s, ok := t.sessions[key]
+	if !ok {
+		s = &natSession{
+			ready: make(chan struct{}),
+			peers: make(map[string]adapter.UDPConn),
+		}
+		t.sessions[key] = s
+	}
+
+	s.mu.Lock()
+	s.peers[peer] = uc
+	s.refs++
+	s.mu.Unlock()
+	return s, !ok
+}
+
+// leave removes uc from session s, which is closed after its last
+// peer has left.
+func (t *natTable) leave(key, peer string, uc adapter.UDPConn, s *natSession) {
+	t.mu.Lock()
+	s.mu.Lock()
+	if s.peers[peer] == uc {
+		delete(s.peers, peer)
+	}
+	s.refs--
+	closed := s.refs == 0
+	s.mu.Unlock()
+
+	if closed {
+		delete(t.sessions, key)
+	}
+	t.mu.Unlock()
+
+	if closed {
+		<-s.ready
+		if s.pc != nil {
+			s.pc.Close()
+		}
+	}
+}
+
+// setup sets the result of dialing and wakes up waiting peers.
+func (s *natSession) setup(pc net.PacketConn, err error) {
+	s.pc, s.err = pc, err
+	close(s.ready)
+}
+
+// forward sends packets from uc to remote until uc is idle, the
+// read deadline of pc is left untouched as it's shared by peers.
+func (s *natSession) forward(uc adapter.UDPConn, to net.Addr) error {
+	buf := pool.Get(pool.MaxSegmentSize)
+	defer pool.Put(buf)
+
+	for {
+		uc.SetReadDeadline(time.Now().Add(_udpSessionTimeout))
+		n, _, err := uc.ReadFrom(buf)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return nil /* ignore I/O timeout */
+		} else if err == io.EOF {
+			return nil /* ignore EOF */
+		} else if err != nil {
+			return err
+		}
+
+		if _, err = s.pc.WriteTo(buf[:n], to); err != nil {
+			return err
+		}
+	}
+}
+
+// serve delivers packets from remote to peers until pc is closed.
+func (s *natSession) serve(nat NATType) {
+	buf := pool.Get(pool.MaxSegmentSize)
+	defer pool.Put(buf)
+
+	for {
+		n, from, err := s.pc.ReadFrom(buf)
+		if err != nil {
+			log.Debugf("[UDP] nat session: %v", err)
+			return
+		}
+		s.deliver(buf[:n], from, nat)
+	}
+}
+
+func (s *natSession) deliver(b []byte, from net.Addr, nat NATType) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if uc, ok := s.peers[from.String()]; ok {
+		if _, err := uc.Write(b); err != nil {
+			log.Debugf("[UDP] write to %s: %v", uc.RemoteAddr(), err)
+		}
+		uc.SetReadDeadline(time.Now().Add(_udpSessionTimeout))
+		return
+	}
+
+	if nat != FullConeNAT {
+		log.Debugf("[UDP] %s NAT: drop packet from %s", nat, from)
+		return
+	}
+
+	// Any peer is able to write packets to the source.
+	for _, uc := range s.peers {
+		if _, err := uc.WriteFrom(b, from); err != nil {
+			log.Debugf("[UDP] write from %s to %s: %v", from, uc.RemoteAddr(), err)
+		}
+		return
+	}
+}
@@ -0,0 +1,139 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/xjasonlyu/tun2socks/v2/log"
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy"
+	"github.com/xjasonlyu/tun2socks/v2/tunnel/statistic"
+)
+
+// RetryPolicy is how the failed TCP dials through an outbound are
+// retried, which applies to the errors safe to retry only.
+type RetryPolicy struct {
+	// Retries is the number of times to retry the outbound.
+	Retries int
+
+	// Interval is the delay before each retry.
+	Interval time.Duration
+
+	// Timeout is the timeout of each attempt, which defaults to
+	// proxy.TCPConnectTimeout.
+	Timeout time.Duration
+
+	// Fallbacks are the outbounds tried in order after the retries
+	// are exhausted, each with the retries of its own policy.
+	Fallbacks []string
+}
+
+// _policies holds the retry policies by outbound name, which is
+// guarded by _configMu.
+var _policies = make(map[string]RetryPolicy)
+
+// UpdatePolicies replaces the retry policies of outbounds.
+func UpdatePolicies(policies map[string]RetryPolicy) {
+	_configMu.Lock()
+	_policies = policies
+	_configMu.Unlock()
+}
+
+func policy(name string) RetryPolicy {
+	_configMu.RLock()
+	defer _configMu.RUnlock()
+	return _policies[name]
+}
+
+// dialTCP dials through the matched dialer d of the outbound name, and
+// retries or falls back as its policy on retryable errors until ctx is
+// done. The name of outbound connected through, and the failures of all
+// the attempts are returned along with the connection.
+func dialTCP(ctx context.Context, metadata *M.Metadata, d proxy.Dialer, name string) (net.Conn, string, []statistic.DialFailure, error) {
+	type candidate struct {
+		name   string
+		dialer proxy.Dialer
+	}
+
+	p := policy(name)
+
+	candidates := []candidate{{name: name, dialer: d}}
+	for _, fallback := range p.Fallbacks {
+		fd, ok := Proxy(fallback)
+		if !ok /* should not happen */ {
+			log.Warnf("[TCP] fallback outbound %s not found", fallback)
+			continue
+		}
+		candidates = append(candidates, candidate{name: fallback, dialer: fd})
+	}
+
+	var (
+		failures []statistic.DialFailure
+		err      error
+	)
+	for i, c := range candidates {
+		cp := p
+		if i > 0 {
+			cp = policy(c.name)
+		}
+		timeout := cp.Timeout
+		if timeout <= 0 {
+			timeout = proxy.TCPConnectTimeout
+		}
+
+		for attempt := 0; attempt <= cp.Retries; attempt++ {
+			if attempt > 0 && cp.Interval > 0 {
+				if err := sleepContext(ctx, cp.Interval); err != nil {
+					return nil, "", failures, err
+				}
+			}
+
+			var conn net.Conn
+			dialCtx, cancel := context.WithTimeout(ctx, timeout)
+			start := time.Now()
+			conn, err = c.dialer.DialContext(dialCtx, metadata)
+			statistic.DefaultManager.ObserveDial(c.name, time.Since(start), err)
+			cancel()
+			if err == nil {
+				return conn, c.name, failures, nil
+			}
+
+			failures = append(failures, statistic.DialFailure{Outbound: c.name, Error: err.Error()})
+			if ctx.Err() != nil || !retryable(err) {
+				return nil, "", failures, err
+			}
+			log.Debugf("[TCP] dial %s via %s: %v", metadata.DestinationAddress(), c.name, err)
+		}
+	}
+	return nil, "", failures, err
+}
+
+// sleepContext sleeps for d, and returns early if ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryable reports whether err occurs on connecting to the server,
+// such as connection refused or timeout, before the connection to the
+// destination is established, which is safe to dial again.
+func retryable(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	// The handshakes with the server time out by the dial context,
+	// or by the deadline of connection.
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,114 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy"
+)
+
+// failDialer fails every dial with err.
+type failDialer struct {
+	proxy.Proxy
+	err   error
+	dials int
+}
+
+func (d *failDialer) DialContext(context.Context, *M.Metadata) (net.Conn, error) {
+	d.dials++
+	return nil, d.err
+}
+
+// listen accepts connections, which are held open without any response
+// if hold is set, otherwise closed immediately.
+func listen(t *testing.T, hold bool) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			if hold {
+				conns = append(conns, c)
+			} else {
+				c.Close()
+			}
+		}
+	}()
+	return ln
+}
+
+func TestDialRetry(t *testing.T) {
+	ln := listen(t, false)
+	defer ln.Close()
+
+	// The HTTP proxy never responds to CONNECT.
+	silent := listen(t, true)
+	defer silent.Close()
+	stalled, err := proxy.NewHTTP(silent.Addr().String(), "", "", nil)
+	require.NoError(t, err)
+
+	rejected := &failDialer{Proxy: proxy.NewDirect(), err: errors.New("authentication failed")}
+
+	UpdateProxies(map[string]proxy.Proxy{
+		"stalled":  stalled,
+		"rejected": rejected,
+		"direct":   proxy.NewDirect(),
+	})
+	UpdatePolicies(map[string]RetryPolicy{
+		"stalled":  {Retries: 1, Timeout: 50 * time.Millisecond, Fallbacks: []string{"direct"}},
+		"rejected": {Retries: 2, Fallbacks: []string{"direct"}},
+	})
+	defer UpdateProxies(map[string]proxy.Proxy{})
+	defer UpdatePolicies(map[string]RetryPolicy{})
+
+	addr := ln.Addr().(*net.TCPAddr)
+	metadata := &M.Metadata{Network: M.TCP, DstIP: addr.IP, DstPort: uint16(addr.Port)}
+
+	// The timed out dials are retried, and then fall back to direct.
+	c, name, failures, err := dialTCP(context.Background(), metadata, stalled, "stalled")
+	require.NoError(t, err)
+	c.Close()
+	assert.Equal(t, "direct", name)
+	require.Len(t, failures, 2)
+	assert.Equal(t, "stalled", failures[0].Outbound)
+	assert.Contains(t, failures[0].Error, "timeout")
+
+	// The other errors are not retried.
+	_, _, failures, err = dialTCP(context.Background(), metadata, rejected, "rejected")
+	assert.EqualError(t, err, "authentication failed")
+	assert.Equal(t, 1, rejected.dials)
+	assert.Len(t, failures, 1)
+}
+
+func TestDialRetryCancel(t *testing.T) {
+	refused := &failDialer{
+		Proxy: proxy.NewDirect(),
+		err:   &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+	}
+	UpdatePolicies(map[string]RetryPolicy{"refused": {Retries: 1, Interval: time.Minute}})
+	defer UpdatePolicies(map[string]RetryPolicy{})
+
+	// The interval between attempts is interrupted by ctx.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, failures, err := dialTCP(ctx, &M.Metadata{Network: M.TCP}, refused, "refused")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, refused.dials)
+	assert.Len(t, failures, 1)
+}
@@ -0,0 +1,152 @@
+package tunnel
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/xjasonlyu/tun2socks/v2/common/pool"
+	"github.com/xjasonlyu/tun2socks/v2/core/adapter"
+	"github.com/xjasonlyu/tun2socks/v2/log"
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/rule"
+	"github.com/xjasonlyu/tun2socks/v2/sniffer"
+)
+
+const (
+	// sniffBufferSize is the maximum size of TCP data to sniff.
+	sniffBufferSize = 4 << 10
+
+	// maxSniffPackets is the maximum number of UDP datagrams to
+	// sniff, as a QUIC ClientHello may be split across datagrams.
+	maxSniffPackets = 3
+)
+
+var (
+	// _sniffMatcher matches connections to sniff, nil if sniffing is disabled.
+	_sniffMatcher rule.Rule
+
+	// _sniffTimeout is the timeout of waiting for client data to sniff.
+	_sniffTimeout = 300 * time.Millisecond
+)
+
+// SetSniffing enables sniffing on connections matched by r, e.g. a
+// port rule, so that server-speaks-first protocols are not delayed.
+func SetSniffing(r rule.Rule, timeout time.Duration) {
+	_sniffMatcher = r
+	if timeout > 0 {
+		_sniffTimeout = timeout
+	}
+}
+
+func shouldSniff(metadata *M.Metadata) bool {
+	return _sniffMatcher != nil && metadata.Host == "" && _sniffMatcher.Match(metadata)
+}
+
+// sniffTCP peeks the first data sent by client to recover the host
+// of metadata, the returned conn replays the data peeked.
+func sniffTCP(conn adapter.TCPConn, metadata *M.Metadata) net.Conn {
+	if !shouldSniff(metadata) {
+		return conn
+	}
+
+	buf := pool.Get(sniffBufferSize)
+	n := 0
+
+	conn.SetReadDeadline(time.Now().Add(_sniffTimeout))
+	for n < len(buf) {
+		m, err := conn.Read(buf[n:])
+		n += m
+
+		if m > 0 {
+			host, sErr := sniffer.SniffStream(buf[:n])
+			if sErr == nil {
+				metadata.Host = host
+				log.Debugf("[SNIFF] %s -> %s", metadata.DstIP, host)
+			}
+			if !errors.Is(sErr, sniffer.ErrNeedMore) {
+				break
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	if n == 0 {
+		pool.Put(buf)
+		return conn
+	}
+	return &sniffedConn{TCPConn: conn, buf: buf, data: buf[:n]}
+}
+
+// sniffUDP reads the first datagrams sent by client to recover the
+// host of metadata, the datagrams are returned to be sent to remote.
+func sniffUDP(uc adapter.UDPConn, metadata *M.Metadata) (packets [][]byte) {
+	if !shouldSniff(metadata) {
+		return
+	}
+
+	s := &sniffer.QUICSniffer{}
+	buf := pool.Get(pool.MaxSegmentSize)
+	defer pool.Put(buf)
+
+	uc.SetReadDeadline(time.Now().Add(_sniffTimeout))
+	defer uc.SetReadDeadline(time.Time{})
+
+	for len(packets) < maxSniffPackets {
+		n, _, err := uc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		packets = append(packets, append([]byte(nil), buf[:n]...))
+
+		host, err := s.Sniff(buf[:n])
+		if err == nil {
+			metadata.Host = host
+			log.Debugf("[SNIFF] %s -> %s", metadata.DstIP, host)
+		}
+		if !errors.Is(err, sniffer.ErrNeedMore) {
+			return
+		}
+	}
+	return
+}
+
+// sniffedConn replays the data peeked before reading from TCPConn.
+type sniffedConn struct {
+	adapter.TCPConn
+
+	buf  []byte
+	data []byte
+}
+
+func (c *sniffedConn) Read(b []byte) (int, error) {
+	if c.buf == nil {
+		return c.TCPConn.Read(b)
+	}
+
+	n := copy(b, c.data)
+	c.data = c.data[n:]
+	if len(c.data) == 0 {
+		pool.Put(c.buf)
+		c.buf, c.data = nil, nil
+	}
+	return n, nil
+}
+
+func (c *sniffedConn) CloseRead() error {
+	if cr, ok := c.TCPConn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+	return errors.New("CloseRead is not implemented")
+}
+
+func (c *sniffedConn) CloseWrite() error {
+	if cw, ok := c.TCPConn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.New("CloseWrite is not implemented")
+}
@@ -0,0 +1,90 @@
+package statistic
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DialBuckets are the upper bounds in seconds of dial latency buckets.
+var DialBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DialStats is the snapshot of dial results through an outbound.
+type DialStats struct {
+	Outbound string
+	Success  int64
+	Failure  int64
+
+	// Buckets holds the cumulative counts of successful dials for
+	// each of DialBuckets, and Sum is their total latency.
+	Buckets []int64
+	Sum     time.Duration
+}
+
+// dialMetrics is guarded by mu, so that the histogram is consistent in
+// the snapshot.
+type dialMetrics struct {
+	mu      sync.Mutex
+	success int64
+	failure int64
+	buckets []int64
+	sum     time.Duration
+}
+
+// ObserveDial records the result of dialing through the outbound,
+// the latency is only recorded for successful dials.
+func (m *Manager) ObserveDial(outbound string, latency time.Duration, err error) {
+	v, ok := m.dials.Load(outbound)
+	if !ok {
+		v, _ = m.dials.LoadOrStore(outbound, &dialMetrics{buckets: make([]int64, len(DialBuckets))})
+	}
+	dm := v.(*dialMetrics)
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	if err != nil {
+		dm.failure++
+		return
+	}
+	dm.success++
+	dm.sum += latency
+
+	for i, bound := range DialBuckets {
+		if latency.Seconds() <= bound {
+			dm.buckets[i]++
+			break
+		}
+	}
+}
+
+// DialSnapshot returns the dial results sorted by outbound.
+func (m *Manager) DialSnapshot() []DialStats {
+	var stats []DialStats
+	m.dials.Range(func(key, value any) bool {
+		dm := value.(*dialMetrics)
+
+		dm.mu.Lock()
+		s := DialStats{
+			Outbound: key.(string),
+			Success:  dm.success,
+			Failure:  dm.failure,
+			Buckets:  make([]int64, len(dm.buckets)),
+			Sum:      dm.sum,
+		}
+		var count int64
+		for i, b := range dm.buckets {
+			count += b
+			s.Buckets[i] = count
+		}
+		dm.mu.Unlock()
+
+		stats = append(stats, s)
+		return true
+	})
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Outbound < stats[j].Outbound
+	})
+	return stats
+}
@@ -5,12 +5,26 @@ import (
 	"time"
 
 	"go.uber.org/atomic"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/rule"
 )
 
+// maxFailedDials is the number of the most recent failed dials kept.
+const maxFailedDials = 64
+
 var DefaultManager *Manager
 
 func init() {
-	DefaultManager = &Manager{
+	DefaultManager = NewManager()
+
+	go DefaultManager.handle()
+}
+
+// NewManager returns an empty Manager, the speed of which is sampled
+// every second for DefaultManager only.
+func NewManager() *Manager {
+	return &Manager{
 		uploadTemp:    atomic.NewInt64(0),
 		downloadTemp:  atomic.NewInt64(0),
 		uploadBlip:    atomic.NewInt64(0),
@@ -18,12 +32,13 @@ func init() {
 		uploadTotal:   atomic.NewInt64(0),
 		downloadTotal: atomic.NewInt64(0),
 	}
-
-	go DefaultManager.handle()
 }
 
 type Manager struct {
 	connections   sync.Map
+	dials         sync.Map
+	failedMu      sync.Mutex
+	failed        []*trackerInfo
 	uploadTemp    *atomic.Int64
 	downloadTemp  *atomic.Int64
 	uploadBlip    *atomic.Int64
@@ -40,6 +55,45 @@ func (m *Manager) Leave(c tracker) {
 	m.connections.Delete(c.ID())
 }
 
+// CloseDefault closes connections started before t, which matched no
+// rule and were dialed through the default outbound name. The ones
+// routed to it by rules, or fallen back to other outbounds, are kept.
+func (m *Manager) CloseDefault(name string, t time.Time) {
+	m.connections.Range(func(key, value any) bool {
+		if c := value.(tracker); c.byDefault() && c.proxy() == name && c.start().Before(t) {
+			_ = c.Close()
+		}
+		return true
+	})
+}
+
+// Count returns the number of active TCP and UDP connections.
+func (m *Manager) Count() (tcp int, udp int) {
+	m.connections.Range(func(key, value any) bool {
+		switch value.(type) {
+		case *tcpTracker:
+			tcp++
+		case *udpTracker:
+			udp++
+		}
+		return true
+	})
+	return
+}
+
+// Fail records the TCP dial matched by rule, which failed on every
+// attempt with failures.
+func (m *Manager) Fail(metadata *M.Metadata, rule rule.Rule, failures []DialFailure) {
+	info := newTrackerInfo(metadata, rule, "", failures)
+
+	m.failedMu.Lock()
+	defer m.failedMu.Unlock()
+	if len(m.failed) >= maxFailedDials {
+		m.failed = m.failed[1:]
+	}
+	m.failed = append(m.failed, info)
+}
+
 func (m *Manager) PushUploaded(size int64) {
 	m.uploadTemp.Add(size)
 	m.uploadTotal.Add(size)
@@ -54,6 +108,10 @@ func (m *Manager) Now() (up int64, down int64) {
 	return m.uploadBlip.Load(), m.downloadBlip.Load()
 }
 
+func (m *Manager) Total() (up int64, down int64) {
+	return m.uploadTotal.Load(), m.downloadTotal.Load()
+}
+
 func (m *Manager) Snapshot() *Snapshot {
 	var connections []tracker
 	m.connections.Range(func(key, value any) bool {
@@ -61,10 +119,15 @@ func (m *Manager) Snapshot() *Snapshot {
 		return true
 	})
 
+	m.failedMu.Lock()
+	failed := append([]*trackerInfo(nil), m.failed...)
+	m.failedMu.Unlock()
+
 	return &Snapshot{
 		UploadTotal:   m.uploadTotal.Load(),
 		DownloadTotal: m.downloadTotal.Load(),
 		Connections:   connections,
+		Failed:        failed,
 	}
 }
 
@@ -92,4 +155,7 @@ type Snapshot struct {
 	DownloadTotal int64     `json:"downloadTotal"`
 	UploadTotal   int64     `json:"uploadTotal"`
 	Connections   []tracker `json:"connections"`
+
+	// Failed are the most recent TCP dials failed on every attempt.
+	Failed []*trackerInfo `json:"failed"`
 }
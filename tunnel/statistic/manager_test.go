@@ -0,0 +1,36 @@
+package statistic
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/rule"
+)
+
+func TestCloseDefault(t *testing.T) {
+	m := NewManager()
+	track := func(r rule.Rule, proxy string) net.Conn {
+		c, _ := net.Pipe()
+		return NewTCPTracker(c, &M.Metadata{Network: M.TCP}, r, proxy, nil, m)
+	}
+
+	byDefault := track(nil, "A")
+	byRule := track(rule.NewMatch("A"), "A")
+	other := track(nil, "B")
+
+	// Only the connections routed to the default A are closed.
+	m.CloseDefault("A", time.Now())
+	tcp, _ := m.Count()
+	assert.Equal(t, 2, tcp)
+	_, err := byDefault.Write([]byte{0})
+	assert.Error(t, err)
+
+	byRule.Close()
+	other.Close()
+	tcp, _ = m.Count()
+	assert.Equal(t, 0, tcp)
+}
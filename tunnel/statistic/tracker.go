@@ -9,11 +9,23 @@ import (
 	"go.uber.org/atomic"
 
 	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/rule"
 )
 
 type tracker interface {
 	ID() string
 	Close() error
+
+	// proxy returns the name of outbound the connection is
+	// actually dialed through.
+	proxy() string
+
+	// byDefault reports whether the connection matched no rule, and
+	// was routed to the default outbound.
+	byDefault() bool
+
+	// start returns the time when the connection started.
+	start() time.Time
 }
 
 type trackerInfo struct {
@@ -22,6 +34,53 @@ type trackerInfo struct {
 	Metadata      *M.Metadata   `json:"metadata"`
 	UploadTotal   *atomic.Int64 `json:"upload"`
 	DownloadTotal *atomic.Int64 `json:"download"`
+	Rule          string        `json:"rule"`
+	RulePayload   string        `json:"rulePayload"`
+	Outbound      string        `json:"outbound"`
+	Proxy         string        `json:"proxy"`
+	Failures      []DialFailure `json:"failures,omitempty"`
+}
+
+// DialFailure is the failure of a dial attempt retried before the
+// connection is established.
+type DialFailure struct {
+	Outbound string `json:"outbound"`
+	Error    string `json:"error"`
+}
+
+// newTrackerInfo returns the info of connection matched by rule, which
+// is connected through the outbound named proxy after failures.
+func newTrackerInfo(metadata *M.Metadata, rule rule.Rule, proxy string, failures []DialFailure) *trackerInfo {
+	id, _ := uuid.NewRandom()
+
+	info := &trackerInfo{
+		UUID:          id,
+		Start:         time.Now(),
+		Metadata:      metadata,
+		UploadTotal:   atomic.NewInt64(0),
+		DownloadTotal: atomic.NewInt64(0),
+		Proxy:         proxy,
+		Failures:      failures,
+	}
+
+	if rule != nil {
+		info.Rule = rule.Type().String()
+		info.RulePayload = rule.Payload()
+		info.Outbound = rule.Outbound()
+	}
+	return info
+}
+
+func (ti *trackerInfo) proxy() string {
+	return ti.Proxy
+}
+
+func (ti *trackerInfo) byDefault() bool {
+	return ti.Rule == ""
+}
+
+func (ti *trackerInfo) start() time.Time {
+	return ti.Start
 }
 
 type tcpTracker struct {
@@ -31,28 +90,21 @@ type tcpTracker struct {
 	manager *Manager
 }
 
-func NewTCPTracker(conn net.Conn, metadata *M.Metadata, manager *Manager) net.Conn {
-	id, _ := uuid.NewRandom()
-
+func NewTCPTracker(conn net.Conn, metadata *M.Metadata, rule rule.Rule, proxy string, failures []DialFailure, manager *Manager) net.Conn {
 	tt := &tcpTracker{
-		Conn:    conn,
-		manager: manager,
-		trackerInfo: &trackerInfo{
-			UUID:          id,
-			Start:         time.Now(),
-			Metadata:      metadata,
-			UploadTotal:   atomic.NewInt64(0),
-			DownloadTotal: atomic.NewInt64(0),
-		},
+		Conn:        conn,
+		manager:     manager,
+		trackerInfo: newTrackerInfo(metadata, rule, proxy, failures),
 	}
 
 	manager.Join(tt)
 	return tt
 }
 
-// DefaultTCPTracker returns a new net.Conn(*tcpTacker) with default manager.
-func DefaultTCPTracker(conn net.Conn, metadata *M.Metadata) net.Conn {
-	return NewTCPTracker(conn, metadata, DefaultManager)
+// DefaultTCPTracker returns a new net.Conn(*tcpTacker) with default manager,
+// proxy is the outbound connected through after the failed dial attempts.
+func DefaultTCPTracker(conn net.Conn, metadata *M.Metadata, rule rule.Rule, proxy string, failures []DialFailure) net.Conn {
+	return NewTCPTracker(conn, metadata, rule, proxy, failures, DefaultManager)
 }
 
 func (tt *tcpTracker) ID() string {
@@ -101,19 +153,11 @@ type udpTracker struct {
 	manager *Manager
 }
 
-func NewUDPTracker(conn net.PacketConn, metadata *M.Metadata, manager *Manager) net.PacketConn {
-	id, _ := uuid.NewRandom()
-
+func NewUDPTracker(conn net.PacketConn, metadata *M.Metadata, rule rule.Rule, proxy string, manager *Manager) net.PacketConn {
 	ut := &udpTracker{
-		PacketConn: conn,
-		manager:    manager,
-		trackerInfo: &trackerInfo{
-			UUID:          id,
-			Start:         time.Now(),
-			Metadata:      metadata,
-			UploadTotal:   atomic.NewInt64(0),
-			DownloadTotal: atomic.NewInt64(0),
-		},
+		PacketConn:  conn,
+		manager:     manager,
+		trackerInfo: newTrackerInfo(metadata, rule, proxy, nil),
 	}
 
 	manager.Join(ut)
@@ -121,8 +165,8 @@ func NewUDPTracker(conn net.PacketConn, metadata *M.Metadata, manager *Manager)
 }
 
 // DefaultUDPTracker returns a new net.PacketConn(*udpTacker) with default manager.
-func DefaultUDPTracker(conn net.PacketConn, metadata *M.Metadata) net.PacketConn {
-	return NewUDPTracker(conn, metadata, DefaultManager)
+func DefaultUDPTracker(conn net.PacketConn, metadata *M.Metadata, rule rule.Rule, proxy string) net.PacketConn {
+	return NewUDPTracker(conn, metadata, rule, proxy, DefaultManager)
 }
 
 func (ut *udpTracker) ID() string {
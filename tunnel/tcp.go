@@ -1,6 +1,7 @@
 package tunnel
 
 import (
+	"context"
 	"io"
 	"net"
 	"sync"
@@ -10,14 +11,11 @@ import (
 	"github.com/xjasonlyu/tun2socks/v2/core/adapter"
 	"github.com/xjasonlyu/tun2socks/v2/log"
 	M "github.com/xjasonlyu/tun2socks/v2/metadata"
-	"github.com/xjasonlyu/tun2socks/v2/proxy"
 	"github.com/xjasonlyu/tun2socks/v2/tunnel/statistic"
 )
 
-const (
-	// tcpWaitTimeout implements a TCP half-close timeout.
-	tcpWaitTimeout = 60 * time.Second
-)
+// tcpWaitTimeout implements a TCP half-close timeout.
+const tcpWaitTimeout = 60 * time.Second
 
 func handleTCPConn(originConn adapter.TCPConn) {
 	defer originConn.Close()
@@ -31,18 +29,33 @@ func handleTCPConn(originConn adapter.TCPConn) {
 		DstPort: id.LocalPort,
 	}
 
-	remoteConn, err := proxy.Dial(metadata)
+	if shouldHijackDNS(metadata) {
+		hijackTCPDNS(originConn, metadata)
+		return
+	}
+
+	if !resolveFakeIP(metadata) {
+		log.Warnf("[TCP] fake-ip %s not found", metadata.DstIP)
+		return
+	}
+
+	conn := sniffTCP(originConn, metadata)
+
+	d, name, r := match(metadata)
+
+	remoteConn, name, failures, err := dialTCP(context.Background(), metadata, d, name)
 	if err != nil {
-		log.Warnf("[TCP] dial %s: %v", metadata.DestinationAddress(), err)
+		statistic.DefaultManager.Fail(metadata, r, failures)
+		log.Warnf("[TCP] dial %s: %v (%d attempts)", metadata.DestinationAddress(), err, len(failures))
 		return
 	}
 	metadata.MidIP, metadata.MidPort = parseAddr(remoteConn.LocalAddr())
 
-	remoteConn = statistic.DefaultTCPTracker(remoteConn, metadata)
+	remoteConn = statistic.DefaultTCPTracker(remoteConn, metadata, r, name, failures)
 	defer remoteConn.Close()
 
 	log.Infof("[TCP] %s <-> %s", metadata.SourceAddress(), metadata.DestinationAddress())
-	pipe(originConn, remoteConn)
+	pipe(conn, remoteConn)
 }
 
 // pipe copies copy data to & from provided net.Conn(s) bidirectionally.
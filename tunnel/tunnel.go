@@ -1,13 +1,37 @@
 package tunnel
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
 	"github.com/xjasonlyu/tun2socks/v2/core/adapter"
+	"github.com/xjasonlyu/tun2socks/v2/log"
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy"
+	"github.com/xjasonlyu/tun2socks/v2/rule"
 )
 
-// Unbuffered TCP/UDP queues.
+// Unbuffered TCP/UDP/ICMP queues.
 var (
-	_tcpQueue = make(chan adapter.TCPConn)
-	_udpQueue = make(chan adapter.UDPConn)
+	_tcpQueue  = make(chan adapter.TCPConn)
+	_udpQueue  = make(chan adapter.UDPConn)
+	_icmpQueue = make(chan adapter.ICMPEcho)
+)
+
+var (
+	_configMu sync.RWMutex
+
+	// _rules holds the rules to match connections with.
+	_rules []rule.Rule
+
+	// _proxies holds the named outbounds that rules refer to.
+	_proxies = make(map[string]proxy.Proxy)
+
+	// _defaultName is the name of the default outbound, which is
+	// looked up in _proxies by match.
+	_defaultName string
 )
 
 func init() {
@@ -24,6 +48,68 @@ func UDPIn() chan<- adapter.UDPConn {
 	return _udpQueue
 }
 
+// ICMPIn return fan-in ICMP queue.
+func ICMPIn() chan<- adapter.ICMPEcho {
+	return _icmpQueue
+}
+
+// UpdateRules replaces the rules used to route connections.
+func UpdateRules(rules []rule.Rule) {
+	_configMu.Lock()
+	_rules = rules
+	_configMu.Unlock()
+}
+
+// UpdateProxies replaces the named outbounds used by rules.
+func UpdateProxies(proxies map[string]proxy.Proxy) {
+	_configMu.Lock()
+	_proxies = proxies
+	_configMu.Unlock()
+}
+
+// SetDefault switches the default outbound, which handles the
+// connections not matched by any rule, to the named one, and returns
+// the name of the one replaced.
+func SetDefault(name string) (string, error) {
+	_configMu.Lock()
+	defer _configMu.Unlock()
+
+	if _, ok := _proxies[name]; !ok {
+		return "", fmt.Errorf("outbound %s not found", name)
+	}
+	previous := _defaultName
+	_defaultName = name
+	return previous, nil
+}
+
+// Default returns the name of the default outbound.
+func Default() string {
+	_configMu.RLock()
+	defer _configMu.RUnlock()
+	return _defaultName
+}
+
+// Proxies returns a copy of the named outbounds.
+func Proxies() map[string]proxy.Proxy {
+	_configMu.RLock()
+	defer _configMu.RUnlock()
+
+	proxies := make(map[string]proxy.Proxy, len(_proxies))
+	for name, p := range _proxies {
+		proxies[name] = p
+	}
+	return proxies
+}
+
+// Proxy looks up the named outbound.
+func Proxy(name string) (proxy.Proxy, bool) {
+	_configMu.RLock()
+	defer _configMu.RUnlock()
+
+	p, ok := _proxies[name]
+	return p, ok
+}
+
 func process() {
 	for {
 		select {
@@ -31,6 +117,54 @@ func process() {
 			go handleTCPConn(conn)
 		case conn := <-_udpQueue:
 			go handleUDPConn(conn)
+		case echo := <-_icmpQueue:
+			go handleICMPEcho(echo)
 		}
 	}
 }
+
+// match returns the dialer for the given metadata, the name of its
+// outbound and the rule it was matched by. The default outbound is
+// used when no rule is matched.
+func match(metadata *M.Metadata) (proxy.Dialer, string, rule.Rule) {
+	_configMu.RLock()
+	defer _configMu.RUnlock()
+
+	for _, r := range _rules {
+		if !r.Match(metadata) {
+			continue
+		}
+
+		p, ok := _proxies[r.Outbound()]
+		if !ok /* should not happen */ {
+			log.Warnf("[RULE] %s(%s): outbound %s not found", r.Type(), r.Payload(), r.Outbound())
+			continue
+		}
+		log.Debugf("[RULE] %s %s matches %s(%s) using %s",
+			metadata.Network, metadata.DestinationAddress(), r.Type(), r.Payload(), r.Outbound())
+		return p, r.Outbound(), r
+	}
+
+	// The default outbound is looked up along with its name, so that
+	// they are consistent when it's switched meanwhile.
+	if p, ok := _proxies[_defaultName]; ok {
+		return p, _defaultName, nil
+	}
+	return defaultDialer{}, _defaultName, nil
+}
+
+// defaultDialer forwards dials to the default dialer of proxy package,
+// which is used only if no default outbound is set by SetDefault.
+type defaultDialer struct{}
+
+func (defaultDialer) DialContext(ctx context.Context, metadata *M.Metadata) (net.Conn, error) {
+	return proxy.DialContext(ctx, metadata)
+}
+
+func (defaultDialer) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
+	return proxy.DialUDP(metadata)
+}
+
+func (defaultDialer) SupportsMultiDestUDP() bool {
+	return proxy.SupportsMultiDestUDP(proxy.DefaultDialer())
+}
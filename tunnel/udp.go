@@ -11,6 +11,7 @@ import (
 	"github.com/xjasonlyu/tun2socks/v2/log"
 	M "github.com/xjasonlyu/tun2socks/v2/metadata"
 	"github.com/xjasonlyu/tun2socks/v2/proxy"
+	"github.com/xjasonlyu/tun2socks/v2/rule"
 	"github.com/xjasonlyu/tun2socks/v2/tunnel/statistic"
 )
 
@@ -21,7 +22,6 @@ func SetUDPTimeout(t time.Duration) {
 	_udpSessionTimeout = t
 }
 
-// TODO: Port Restricted NAT support.
 func handleUDPConn(uc adapter.UDPConn) {
 	defer uc.Close()
 
@@ -34,28 +34,107 @@ func handleUDPConn(uc adapter.UDPConn) {
 		DstPort: id.LocalPort,
 	}
 
-	pc, err := proxy.DialUDP(metadata)
+	if shouldHijackDNS(metadata) {
+		hijackUDPDNS(uc, metadata)
+		return
+	}
+
+	if !resolveFakeIP(metadata) {
+		log.Warnf("[UDP] fake-ip %s not found", metadata.DstIP)
+		return
+	}
+
+	packets := sniffUDP(uc, metadata)
+
+	d, name, r := match(metadata)
+
+	// Replies to domain destinations can't be told apart by their
+	// source address, and the outbounds bound to one destination
+	// can't be shared, so they always stay in symmetric NAT.
+	if _natType != SymmetricNAT && metadata.Host == "" && proxy.SupportsMultiDestUDP(d) {
+		handleConeUDPConn(uc, metadata, packets, _natType, d, name, r)
+		return
+	}
+
+	start := time.Now()
+	pc, err := d.DialUDP(metadata)
+	statistic.DefaultManager.ObserveDial(name, time.Since(start), err)
 	if err != nil {
 		log.Warnf("[UDP] dial %s: %v", metadata.DestinationAddress(), err)
 		return
 	}
 	metadata.MidIP, metadata.MidPort = parseAddr(pc.LocalAddr())
 
-	pc = statistic.DefaultUDPTracker(pc, metadata)
+	pc = statistic.DefaultUDPTracker(pc, metadata, r, name)
 	defer pc.Close()
 
 	var remote net.Addr
-	if udpAddr := metadata.UDPAddr(); udpAddr != nil {
+	if udpAddr := metadata.UDPAddr(); udpAddr != nil && metadata.Host == "" {
 		remote = udpAddr
 	} else {
 		remote = metadata.Addr()
 	}
 	pc = newSymmetricNATPacketConn(pc, metadata)
 
+	if err = writePackets(pc, packets, remote); err != nil {
+		log.Warnf("[UDP] write to %s: %v", metadata.DestinationAddress(), err)
+		return
+	}
+
 	log.Infof("[UDP] %s <-> %s", metadata.SourceAddress(), metadata.DestinationAddress())
 	pipePacket(uc, pc, remote)
 }
 
+// handleConeUDPConn shares the remote mapping with other conns from
+// the same source routed to the same outbound d.
+func handleConeUDPConn(uc adapter.UDPConn, metadata *M.Metadata, packets [][]byte, nat NATType, d proxy.Dialer, name string, r rule.Rule) {
+	key := metadata.SourceAddress() + "/" + name
+	remote := metadata.UDPAddr()
+
+	s, created := _natTable.join(key, remote.String(), uc)
+	defer _natTable.leave(key, remote.String(), uc, s)
+
+	if created {
+		start := time.Now()
+		pc, err := d.DialUDP(metadata)
+		statistic.DefaultManager.ObserveDial(name, time.Since(start), err)
+		if err == nil {
+			pc = statistic.DefaultUDPTracker(pc, metadata, r, name)
+		}
+		s.setup(pc, err)
+
+		if err == nil {
+			go s.serve(nat)
+		}
+	}
+	<-s.ready
+
+	if s.err != nil {
+		log.Warnf("[UDP] dial %s: %v", metadata.DestinationAddress(), s.err)
+		return
+	}
+	metadata.MidIP, metadata.MidPort = parseAddr(s.pc.LocalAddr())
+
+	if err := writePackets(s.pc, packets, remote); err != nil {
+		log.Warnf("[UDP] write to %s: %v", metadata.DestinationAddress(), err)
+		return
+	}
+
+	log.Infof("[UDP] %s <-> %s (%s)", metadata.SourceAddress(), metadata.DestinationAddress(), nat)
+	if err := s.forward(uc, remote); err != nil {
+		log.Debugf("[UDP] copy data for origin->remote: %v", err)
+	}
+}
+
+func writePackets(pc net.PacketConn, packets [][]byte, to net.Addr) error {
+	for _, packet := range packets {
+		if _, err := pc.WriteTo(packet, to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func pipePacket(origin, remote net.PacketConn, to net.Addr) {
 	wg := sync.WaitGroup{}
 	wg.Add(2)
@@ -102,10 +181,16 @@ type symmetricNATPacketConn struct {
 }
 
 func newSymmetricNATPacketConn(pc net.PacketConn, metadata *M.Metadata) *symmetricNATPacketConn {
+	dst := metadata.DestinationAddress()
+	if metadata.Host != "" {
+		// The host is resolved by the remote side, so the
+		// source address of replies is not known in advance.
+		dst = ""
+	}
 	return &symmetricNATPacketConn{
 		PacketConn: pc,
 		src:        metadata.SourceAddress(),
-		dst:        metadata.DestinationAddress(),
+		dst:        dst,
 	}
 }
 
@@ -113,7 +198,7 @@ func (pc *symmetricNATPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
 	for {
 		n, from, err := pc.PacketConn.ReadFrom(p)
 
-		if from != nil && from.String() != pc.dst {
+		if from != nil && pc.dst != "" && from.String() != pc.dst {
 			log.Warnf("[UDP] symmetric NAT %s->%s: drop packet from %s", pc.src, pc.dst, from)
 			continue
 		}
@@ -0,0 +1,155 @@
+package tunnel
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+	"gvisor.dev/gvisor/pkg/tcpip"
+	"gvisor.dev/gvisor/pkg/tcpip/stack"
+
+	M "github.com/xjasonlyu/tun2socks/v2/metadata"
+	"github.com/xjasonlyu/tun2socks/v2/proxy"
+)
+
+// boundDialer dials the packet conns bound to the destination at dial,
+// as the UDP of VLESS and VMess.
+type boundDialer struct {
+	proxy.Proxy
+	dials *atomic.Int32
+}
+
+func (d *boundDialer) SupportsMultiDestUDP() bool {
+	return false
+}
+
+func (d *boundDialer) DialUDP(metadata *M.Metadata) (net.PacketConn, error) {
+	d.dials.Inc()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return &boundPacketConn{PacketConn: pc, to: metadata.UDPAddr().String()}, nil
+}
+
+type boundPacketConn struct {
+	net.PacketConn
+	to string
+}
+
+func (pc *boundPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if addr.String() != pc.to {
+		return 0, errors.New("destination mismatch")
+	}
+	return pc.PacketConn.WriteTo(b, addr)
+}
+
+// fakeUDPConn is the UDP conn from the TUN, whose packets are sent by in
+// and replies are received by out.
+type fakeUDPConn struct {
+	net.Conn
+
+	id  stack.TransportEndpointID
+	in  chan []byte
+	out chan []byte
+}
+
+func newFakeUDPConn(src, dst *net.UDPAddr) *fakeUDPConn {
+	return &fakeUDPConn{
+		id: stack.TransportEndpointID{
+			LocalAddress:  tcpip.AddrFromSlice(dst.IP.To4()),
+			LocalPort:     uint16(dst.Port),
+			RemoteAddress: tcpip.AddrFromSlice(src.IP.To4()),
+			RemotePort:    uint16(src.Port),
+		},
+		in:  make(chan []byte, 1),
+		out: make(chan []byte, 1),
+	}
+}
+
+func (c *fakeUDPConn) ID() *stack.TransportEndpointID { return &c.id }
+
+func (c *fakeUDPConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	p, ok := <-c.in
+	if !ok {
+		return 0, nil, io.EOF
+	}
+	return copy(b, p), nil, nil
+}
+
+func (c *fakeUDPConn) Write(b []byte) (int, error) {
+	c.out <- append([]byte(nil), b...)
+	return len(b), nil
+}
+
+func (c *fakeUDPConn) WriteTo(b []byte, _ net.Addr) (int, error)   { return c.Write(b) }
+func (c *fakeUDPConn) WriteFrom(b []byte, _ net.Addr) (int, error) { return c.Write(b) }
+func (c *fakeUDPConn) Close() error                                { return nil }
+func (c *fakeUDPConn) LocalAddr() net.Addr                         { return nil }
+func (c *fakeUDPConn) RemoteAddr() net.Addr                        { return nil }
+func (c *fakeUDPConn) SetDeadline(time.Time) error                 { return nil }
+func (c *fakeUDPConn) SetReadDeadline(time.Time) error             { return nil }
+func (c *fakeUDPConn) SetWriteDeadline(time.Time) error            { return nil }
+
+// echo runs a UDP echo server.
+func echo(t *testing.T) net.PacketConn {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(buf[:n], from)
+		}
+	}()
+	return pc
+}
+
+func TestConeNATSingleDestination(t *testing.T) {
+	d := &boundDialer{Proxy: proxy.NewDirect(), dials: atomic.NewInt32(0)}
+	UpdateProxies(map[string]proxy.Proxy{"bound": d})
+	_, err := SetDefault("bound")
+	require.NoError(t, err)
+	defer UpdateProxies(map[string]proxy.Proxy{})
+
+	SetNATType(FullConeNAT)
+	defer SetNATType(SymmetricNAT)
+	defer func(timeout time.Duration) { _udpSessionTimeout = timeout }(_udpSessionTimeout)
+	_udpSessionTimeout = 100 * time.Millisecond
+
+	// The flows from the same source to two destinations are sent
+	// through the outbound, which falls back to symmetric NAT.
+	src := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		dst := echo(t)
+		defer dst.Close()
+
+		uc := newFakeUDPConn(src, dst.LocalAddr().(*net.UDPAddr))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handleUDPConn(uc)
+		}()
+
+		uc.in <- []byte("hello")
+		select {
+		case b := <-uc.out:
+			assert.Equal(t, "hello", string(b))
+		case <-time.After(time.Second):
+			t.Fatalf("no reply from %s", dst.LocalAddr())
+		}
+		close(uc.in)
+	}
+	wg.Wait()
+	assert.EqualValues(t, 2, d.dials.Load())
+}